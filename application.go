@@ -1,14 +1,21 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	toolbelt "github.com/delaneyj/toolbelt/id"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/starfederation/datastar-go/datastar"
 )
@@ -19,39 +26,163 @@ const htmlTemplate = `<!DOCTYPE html>
 	<meta charset="UTF-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
 	<title>MastersCalc</title>
+	<meta name="description" content="{{html .Description}}">
+	<meta property="og:type" content="website">
+	<meta property="og:site_name" content="{{html .SiteName}}">
+	<meta property="og:title" content="{{html .SiteName}}">
+	<meta property="og:description" content="{{html .Description}}">
+	<meta name="twitter:card" content="summary">
+	<meta name="twitter:title" content="{{html .SiteName}}">
+	<meta name="twitter:description" content="{{html .Description}}">
+	<link rel="icon" href="/favicon.ico" sizes="32x32">
+	<link rel="icon" href="/static/icon.svg" type="image/svg+xml">
+	<link rel="manifest" href="/manifest.json">
 	<link rel="stylesheet" type="text/css" href="/static/css/styles.css">
 	<script type="module" src="https://cdn.jsdelivr.net/gh/starfederation/datastar@1.0.0/bundles/datastar.js"></script>
+	<script>
+		if ('serviceWorker' in navigator) {
+			navigator.serviceWorker.register('/static/sw.js', { scope: '/masterscalc' });
+		}
+		addEventListener('DOMContentLoaded', () => {
+			const banner = document.getElementById('offline-banner');
+			const update = () => { banner.hidden = navigator.onLine; };
+			addEventListener('online', update);
+			addEventListener('offline', update);
+			update();
+		});
+	</script>
 </head>
 <body>
+<div class="offline-banner" id="offline-banner" hidden>You are offline. The crew shown may be out of date and changes will not be saved until you reconnect.</div>
+{{with .Announcement}}<div class="announcement" data-signals="{announcementDismissed: false}" data-show="!$announcementDismissed">
+	<span>{{html .}}</span>
+	<button type="button" class="announcement-dismiss" aria-label="Dismiss" data-on:click="$announcementDismissed = true">&times;</button>
+</div>{{end}}
+<div class="offline-banner" data-signals="{restarting: false}" data-show="$restarting" data-effect="$restarting && setTimeout(() => { $restarting = false; @get('{{.WatchURL}}') }, {{.ReconnectDelay}})" style="display: none">The server is restarting. Reconnecting…</div>
 <h1>MastersCalc</h1>
+<h2 class="crew-name" data-show="$crewName" data-text="$crewName" data-effect="document.title = $crewName ? $crewName + ' - MastersCalc' : 'MastersCalc'"></h2>
+<p><a href="/masterscalc/help">What are the masters categories?</a></p>
+<div class="form-group">
+	<label for="inputCrewName" class="form-label">Crew name (optional)</label>
+	<input id="inputCrewName" class="form-control" placeholder="e.g. Thames Masters 4x" maxlength="{{.MaxCrewNameLength}}" data-bind:crew-name data-on:change="@post('/masterscalc/crew-name')">
+</div>
 <div class="form-container">
-<form>
+<form data-signals="{name: '', birthYearOrAge: '', dateOfBirth: '', weight: '', notes: '', club: '', avatarUrl: '', duplicateWarning: '', confirmDuplicate: false, nameError: '', ageError: '', weightError: '', notesError: '', clubError: '', avatarError: ''}">
 	<div class="form-group">
 		<div class="form-text">Enter each crew member's details.</div>
 		<label for="inputName" class="form-label">Name</label>
-		<input id="inputName" class="form-control" placeholder="e.g. Bob" value="" data-bind:name>
+		<input id="inputName" class="form-control" placeholder="e.g. Bob" value="" maxlength="{{.MaxNameLength}}" data-bind:name>
+		<div class="form-text field-error" data-show="$nameError" data-text="$nameError"></div>
 	</div>
 	<div class="form-group">
 		<label for="inputYear" class="form-label">Year of Birth / Age on their Birthday this year</label>
 		<input id="inputYear" class="form-control" data-attr:placeholder="$example" type="number" min="1900" max="3000" data-bind:birth-year-or-age>
 	</div>
 	<div class="form-group">
-		<button type="button" class="btn btn-secondary" data-attr:disabled="$name.length === 0 || !$birthYearOrAge" data-on:click="@post('/masterscalc/rowers')">Add</button>
+		<label for="inputDateOfBirth" class="form-label">Date of Birth (optional, for an exact age)</label>
+		<input id="inputDateOfBirth" class="form-control" type="date" data-bind:date-of-birth>
+		<div class="form-text field-error" data-show="$ageError" data-text="$ageError"></div>
+	</div>
+	<div class="form-group">
+		<label for="inputWeight" class="form-label">Weight in kg (optional)</label>
+		<input id="inputWeight" class="form-control" placeholder="e.g. 72.5" type="number" min="1" max="250" step="0.1" data-bind:weight>
+		<div class="form-text field-error" data-show="$weightError" data-text="$weightError"></div>
+	</div>
+	<div class="form-group">
+		<label for="inputSide" class="form-label">Side</label>
+		<select id="inputSide" class="form-control" data-bind:side>
+			<option value="both">Both</option>
+			<option value="port">Port</option>
+			<option value="starboard">Starboard</option>
+			<option value="scull">Scull</option>
+		</select>
+	</div>
+	<div class="form-group">
+		<label for="inputNotes" class="form-label">Notes (optional)</label>
+		<input id="inputNotes" class="form-control" placeholder="e.g. bow side, available weekends" maxlength="{{.MaxNotesLength}}" data-bind:notes>
+		<div class="form-text field-error" data-show="$notesError" data-text="$notesError"></div>
+	</div>
+	<div class="form-group">
+		<label for="inputClub" class="form-label">Club (optional)</label>
+		<input id="inputClub" class="form-control" placeholder="e.g. Thames RC" maxlength="{{.MaxClubLength}}" data-bind:club>
+		<div class="form-text field-error" data-show="$clubError" data-text="$clubError"></div>
+	</div>
+	<div class="form-group">
+		<label for="inputAvatar" class="form-label">Photo URL (optional)</label>
+		<input id="inputAvatar" class="form-control" type="url" placeholder="e.g. https://example.org/bob.jpg" maxlength="{{.MaxAvatarURLLength}}" data-bind:avatar-url>
+		<div class="form-text field-error" data-show="$avatarError" data-text="$avatarError"></div>
+	</div>
+	<div class="form-group">
+		<button type="button" class="btn btn-secondary" data-attr:disabled="$name.length === 0 || (!$birthYearOrAge && !$dateOfBirth)" data-on:click="$confirmDuplicate = false; @post('/masterscalc/rowers')">Add</button>
+	</div>
+	<div class="form-group" data-show="$duplicateWarning">
+		<div class="form-text" data-text="$duplicateWarning"></div>
+		<button type="button" class="btn btn-secondary" data-on:click="$confirmDuplicate = true; @post('/masterscalc/rowers')">Add anyway</button>
 	</div>
 </form>
 </div>
-<div class="table-container">
+<div class="table-container" data-signals="{initialized: false}">
+<form method="get" action="/masterscalc" class="filter-form">
+	<input type="hidden" name="sort" value="{{.SortBy}}">
+	<input type="hidden" name="dir" value="{{.SortDir}}">
+	<label for="filterBand" class="form-label">Show band</label>
+	<select id="filterBand" name="band" onchange="this.form.submit()">
+		<option value="">All</option>
+		{{range .Bands}}<option value="{{.}}"{{if eq . $.Band}} selected{{end}}>{{.}}</option>{{end}}
+	</select>
+</form>
 <table>
 	<thead>
 		<tr>
-			<th>Name</th>
+			<th><a href="/masterscalc?sort=name&dir={{if and (eq .SortBy "name") (eq .SortDir "asc")}}desc{{else}}asc{{end}}{{with .Band}}&band={{urlquery .}}{{end}}">Name</a></th>
+			<th>Club</th>
 			<th>Born</th>
-			<th>Age</th>
-			<th>Masters Category</th>
+			<th><a href="/masterscalc?sort=age&dir={{if and (eq .SortBy "age") (eq .SortDir "asc")}}desc{{else}}asc{{end}}{{with .Band}}&band={{urlquery .}}{{end}}">Age</a></th>
+			<th><a href="/masterscalc?sort=band&dir={{if and (eq .SortBy "band") (eq .SortDir "asc")}}desc{{else}}asc{{end}}{{with .Band}}&band={{urlquery .}}{{end}}">Masters Category</a></th>
+			<th>Next Category</th>
+			<th>Side</th>
+			<th>Weight</th>
+			<th>Notes</th>
+			<th>Actions</th>
+		</tr>
+	</thead>
+	<tbody id="rower-table-body" data-init="@get('{{.WatchURL}}')"/>
+</table>
+<p class="form-text" data-show="!$initialized">Loading crew…</p>
+<a href="/masterscalc/rowers/print" target="_blank">Printable version</a>
+<a href="/masterscalc/rowers/export">Export entry CSV</a>
+<a href="/masterscalc/backup">Download backup</a>
+<a href="/masterscalc/history">History</a>
+<button type="button" class="btn btn-secondary" data-on:click="@post('/masterscalc/archive')">Archive crew</button>
+<div data-signals="{shareEditUrl: '', shareViewUrl: ''}">
+	<button type="button" class="btn btn-secondary" data-on:click="@post('/masterscalc/share')">Share crew</button>
+	<p class="form-text" data-show="$shareEditUrl !== ''">Anyone with <a data-attr:href="$shareEditUrl">the edit link</a> can change the crew with you; <a data-attr:href="$shareViewUrl">the view link</a> only shows it.</p>
+</div>
+</div>
+<div class="table-container">
+<h2>Leaderboard</h2>
+<form class="filter-form" data-signals="{timeCrew: '', timeBand: '', timeRaw: ''}">
+	<input class="form-control" placeholder="Crew" maxlength="{{.MaxNameLength}}" data-bind:time-crew>
+	<select class="form-control" data-bind:time-band>
+		<option value="">This crew's category</option>
+		{{range .Bands}}<option value="{{.}}">{{.}}</option>{{end}}
+	</select>
+	<input class="form-control" placeholder="Time, e.g. 3:45.2" data-bind:time-raw>
+	<button type="button" class="btn btn-secondary" data-attr:disabled="$timeCrew.length === 0 || $timeRaw.length === 0" data-on:click="@post('/masterscalc/times')">Add time</button>
+</form>
+<table>
+	<thead>
+		<tr>
+			<th>Rank</th>
+			<th>Crew</th>
+			<th>Category</th>
+			<th>Raw Time</th>
+			<th>Handicap</th>
+			<th>Corrected Time</th>
 			<th>Actions</th>
 		</tr>
 	</thead>
-	<tbody id="rower-table-body" data-init="@get('/masterscalc/rowers')"/>
+	<tbody id="leaderboard-body"/>
 </table>
 </div>
 <div class="card">
@@ -60,18 +191,69 @@ const htmlTemplate = `<!DOCTYPE html>
 		Average age: <span class="badge" data-text="$averageAge" />
 	</p>
 	<p class="lead">
-		Crew Masters Category: <span class="badge" data-text="$averageBand" />
+		Crew Masters Category: <span class="badge" data-text="$averageBandLabel" />
+	</p>
+	<p class="lead">
+		Crew Classification: <span class="badge" data-text="$crewClass" />
+	</p>
+	<p class="lead">
+		<label for="enteredBand">Entered as</label>
+		<select id="enteredBand" data-bind:entered-band data-on:change="@post('/masterscalc/category')">
+			<option value="">Computed category</option>
+			{{range .Bands}}<option value="{{.}}">{{.}}</option>{{end}}
+		</select>
+		<span class="badge" data-show="$enteredBandNote" data-text="$enteredBandNote" />
+		<span class="warning" data-show="$enteredBandWarning" data-text="$enteredBandWarning" />
+	</p>
+	<p class="lead">
+		<label for="tooYoungPolicy">Rowers under {{.MinAge}}</label>
+		<select id="tooYoungPolicy" data-bind:too-young-policy data-on:change="@post('/masterscalc/too-young-policy')">
+			<option value="reject">Not allowed</option>
+			<option value="list-excluded">Listed, not in the average</option>
+			<option value="list-included">Listed, in the average</option>
+		</select>
+	</p>
+	<p class="lead">
+		Sides: <span class="badge" data-text="$sideBalance" />
+		<span class="warning" data-show="$sideWarning" data-text="$sideWarning" />
+	</p>
+	<p class="lead">
+		Boats: <span class="badge" data-text="$boatClasses || 'none for this crew size'" />
+	</p>
+	<p class="lead" data-show="$compositeClubs">
+		Composite crew: <span class="badge" data-text="$compositeClubs" />
+		<span data-show="$compositeRule" data-text="'Category ' + $compositeRule" />
 	</p>
 	</div>
 </div>
 </body>
 </html>`
 
+const leaderboardTemplate = `<tbody id="leaderboard-body">
+	{{range .}}
+	<tr>
+		<td>{{.Rank}}</td>
+		<td>{{html .Crew}}</td>
+		<td>{{with .Band}}{{bandLabel .}}{{else}}—{{end}}</td>
+		<td>{{raceTime .Time}}</td>
+		<td>{{raceTime .Handicap}}</td>
+		<td>{{raceTime .Corrected}}</td>
+		<td>
+			<button class="remove-btn" data-on:click="@delete('/masterscalc/times/{{.Index}}')">Remove</button>
+		</td>
+	</tr>
+	{{end}}
+</tbody>`
+
 const rowerTableTemplate = `<tbody id="rower-table-body">
-	{{range $i, $rower := .}}
+	{{range .Rows}}
 	<tr>
 		<td>
-			{{.Name}}
+			{{with .AvatarURL}}<img class="avatar" src="{{html .}}" alt="" loading="lazy" referrerpolicy="no-referrer">{{end}}
+			{{html .Name}}
+		</td>
+		<td>
+			{{html .Club}}
 		</td>
 		<td>
 			{{.BirthYear}}
@@ -80,130 +262,525 @@ const rowerTableTemplate = `<tbody id="rower-table-body">
 			{{.Age}}
 		</td>
 		<td>
-			{{.Band}}
+			{{with .Band}}{{bandLabel .}}{{else}}—{{end}}
+		</td>
+		<td>
+			{{.NextBand}}
+		</td>
+		<td>
+			{{.Side}}
+		</td>
+		<td>
+			{{if .Weight}}{{printf "%.1f kg" .Weight}}{{end}}
+		</td>
+		<td>
+			{{html .Notes}}
 		</td>
 		<td>
-			<button class="remove-btn" data-on:click="@delete('/masterscalc/rowers/{{$i}}')">Remove</button>
+			<a class="remove-btn" href="/masterscalc/rowers/{{.Index}}/card" target="_blank">Card</a>
+			<button class="remove-btn" data-on:click="@post('/masterscalc/rowers/{{.Index}}/clone')">Clone</button>
+			<button class="remove-btn" data-on:click="@delete('/masterscalc/rowers/{{.Index}}')">Remove</button>
 		</td>
 	</tr>
+	{{else}}
+	<tr class="empty-state" data-show="$initialized">
+		<td colspan="10">{{if .Filtered}}No rowers in this category.{{else}}No rowers yet — add your first above.{{end}}</td>
+	</tr>
 	{{end}}
 </tbody>`
 
+const printTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>{{with .CrewName}}{{html .}}{{else}}MastersCalc Crew{{end}}</title>
+	<link rel="stylesheet" type="text/css" href="/static/css/print.css">
+</head>
+<body>
+<h1>{{with .CrewName}}{{html .}}{{else}}Crew{{end}}</h1>
+<table>
+	<thead>
+		<tr>
+			<th>Name</th>
+			<th>Club</th>
+			<th>Born</th>
+			<th>Age</th>
+			<th>Masters Category</th>
+			<th>Next Category</th>
+			<th>Side</th>
+			<th>Weight</th>
+			<th>Notes</th>
+		</tr>
+	</thead>
+	<tbody>
+	{{range .Rowers}}
+	<tr>
+		<td>{{html .Name}}</td>
+		<td>{{html .Club}}</td>
+		<td>{{.BirthYear}}</td>
+		<td>{{.Age}}</td>
+		<td>{{with .Band}}{{bandLabel .}}{{else}}—{{end}}</td>
+		<td>{{.NextBand}}</td>
+		<td>{{.Side}}</td>
+		<td>{{if .Weight}}{{printf "%.1f kg" .Weight}}{{end}}</td>
+		<td>{{html .Notes}}</td>
+	</tr>
+	{{end}}
+	</tbody>
+</table>
+<div class="summary">
+	<p>Average age: {{.Signals.AverageAge}}</p>
+	<p>Crew Masters Category: {{.Signals.AverageBandLabel}}</p>
+	<p>Crew Classification: {{.Signals.CrewClass}}</p>
+	{{with .Signals.EnteredBandNote}}<p>{{.}}.{{with $.Signals.EnteredBandWarning}} {{.}}{{end}}</p>{{end}}
+	<p>Sides: {{.Signals.SideBalance}} {{.Signals.SideWarning}}</p>
+	{{with .Signals.CompositeClubs}}<p>Composite crew: {{html .}}{{with $.Signals.CompositeRule}} (category {{.}}){{end}}</p>{{end}}
+</div>
+</body>
+</html>`
+
+const cardTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<title>MastersCalc Rower Card</title>
+	<link rel="stylesheet" type="text/css" href="/static/css/print.css">
+</head>
+<body>
+<div class="card">
+	{{with .AvatarURL}}<img class="avatar" src="{{html .}}" alt="" referrerpolicy="no-referrer">{{end}}
+	<h1>{{html .Name}}</h1>
+	{{with .Club}}<p>{{html .}}</p>{{end}}
+	<p>Age: {{.Age}}</p>
+	<p>Masters Category: {{with .Band}}{{bandLabel .}}{{else}}—{{end}}</p>
+</div>
+</body>
+</html>`
+
+const helpTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>MastersCalc Help</title>
+	<link rel="stylesheet" type="text/css" href="/static/css/styles.css">
+</head>
+<body>
+<h1>Masters Categories</h1>
+<div class="card">
+	<div class="card-body">
+	<p class="lead">
+		Rowers must be at least {{.MinAge}} to race masters. A crew's category comes from the average age of its rowers.
+	</p>
+	</div>
+</div>
+<div class="table-container">
+<table>
+	<thead>
+		<tr>
+			<th>Category</th>
+			<th>Minimum average age</th>
+			<th>Ages</th>
+		</tr>
+	</thead>
+	<tbody>
+	{{range .Bands}}
+	<tr>
+		<td>{{.Band}}</td>
+		<td>{{.MinAge}}</td>
+		<td>{{.Range}}</td>
+	</tr>
+	{{end}}
+	</tbody>
+</table>
+<a href="/masterscalc">Back to the calculator</a>
+</div>
+</body>
+</html>`
+
+const historyTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>MastersCalc History</title>
+	<link rel="stylesheet" type="text/css" href="/static/css/styles.css">
+</head>
+<body>
+<h1>Crew History</h1>
+<div class="table-container">
+<table>
+	<thead>
+		<tr>
+			<th>When</th>
+			<th>Change</th>
+		</tr>
+	</thead>
+	<tbody>
+	{{range .}}
+	<tr>
+		<td>{{.When.Format "2 Jan 2006 15:04"}}</td>
+		<td>{{html .Change}}</td>
+	</tr>
+	{{else}}
+	<tr class="empty-state">
+		<td colspan="2">No changes yet.</td>
+	</tr>
+	{{end}}
+	</tbody>
+</table>
+<a href="/masterscalc">Back to the calculator</a>
+</div>
+</body>
+</html>`
+
+// defaultMaxWatchers is the default cap on simultaneous watch connections.
+const defaultMaxWatchers = 1000
+
+type applicationConfig struct {
+	SessionName  string
+	ExportFields []exportField
+
+	// SiteName is the name shown in link previews.
+	SiteName string
+
+	// Announcement is shown in a banner at the top of the page, unless empty.
+	Announcement string
+
+	// MaxWatchers caps the number of simultaneous watch connections, over SSE
+	// and WebSocket together.
+	MaxWatchers int
+
+	// WatcherMaxStall is how long a write to a watcher may block before the
+	// watcher is stopped.
+	WatcherMaxStall time.Duration
+
+	// CORSOrigins are the other sites allowed to call the session-less API
+	// routes. Empty allows none.
+	CORSOrigins []string
+
+	// DemoMode starts each new session with a sample crew.
+	DemoMode bool
+}
+
 type application struct {
 	table        *template.Template
-	sessionStore *sessions.CookieStore
+	leaderboard  *template.Template
+	printPage    *template.Template
+	cardPage     *template.Template
+	helpPage     *template.Template
+	historyPage  *template.Template
+	mainPage     *template.Template
+	sessionStore sessions.Store
 	bus          *business
+	cfg          applicationConfig
+
+	// watchers holds a slot for each open watch connection.
+	watchers chan struct{}
+	janitor  *watcherJanitor
 }
 
-func newApplication(sessionStore *sessions.CookieStore, bus *business) (*application, error) {
-	table, err := template.New("rowerTable").Parse(rowerTableTemplate)
+func newApplication(sessionStore sessions.Store, bus *business, cfg applicationConfig) (*application, error) {
+	funcs := template.FuncMap{"bandLabel": bus.cfg.BandFormat.label, "raceTime": formatRaceTime}
+
+	table, err := template.New("rowerTable").Funcs(funcs).Parse(rowerTableTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse template: %w", err)
 	}
 
+	leaderboard, err := template.New("leaderboard").Funcs(funcs).Parse(leaderboardTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse leaderboard template: %w", err)
+	}
+
+	printPage, err := template.New("print").Funcs(funcs).Parse(printTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse print template: %w", err)
+	}
+
+	cardPage, err := template.New("card").Funcs(funcs).Parse(cardTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse card template: %w", err)
+	}
+
+	helpPage, err := template.New("help").Parse(helpTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse help template: %w", err)
+	}
+
+	historyPage, err := template.New("history").Parse(historyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse history template: %w", err)
+	}
+
+	mainPage, err := template.New("main").Parse(htmlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse main template: %w", err)
+	}
+
 	return &application{
 		table:        table,
+		leaderboard:  leaderboard,
+		printPage:    printPage,
+		cardPage:     cardPage,
+		helpPage:     helpPage,
+		historyPage:  historyPage,
+		mainPage:     mainPage,
 		sessionStore: sessionStore,
 		bus:          bus,
+		cfg:          cfg,
+		watchers:     make(chan struct{}, cfg.MaxWatchers),
+		janitor:      newWatcherJanitor(cfg.WatcherMaxStall),
 	}, nil
 }
 
-func (app *application) registerRoutes(mux *http.ServeMux) {
+// acquireWatcher takes a watch slot, reporting false if all are in use. The
+// returned func releases the slot.
+func (app *application) acquireWatcher() (release func(), ok bool) {
+	select {
+	case app.watchers <- struct{}{}:
+		return func() { <-app.watchers }, true
+	default:
+		return nil, false
+	}
+}
+
+// The patterns of the routes that stream the crew for as long as the client
+// stays connected, and so are exempt from the request timeout.
+const (
+	watchPattern          = "GET /masterscalc/rowers"
+	watchWebSocketPattern = "GET /masterscalc/rowers/ws"
+)
+
+// isStream reports whether r is for one of the streaming routes on mux.
+func isStream(mux *routeMux, r *http.Request) bool {
+	_, pattern := mux.Handler(r)
+	return pattern == watchPattern || pattern == watchWebSocketPattern
+}
+
+func (app *application) registerRoutes(mux *routeMux) {
 	mux.HandleFunc("GET /masterscalc", app.showMainPage)
-	mux.HandleFunc("GET /masterscalc/rowers", app.watch)
+	mux.HandleFunc("GET /masterscalc/help", app.showHelp)
+	handleCORS(mux, app.cfg.CORSOrigins, http.MethodGet, "/masterscalc/bands", app.listBands)
+	mux.HandleFunc("GET /masterscalc/history", app.showHistory)
+	mux.HandleFunc(watchPattern, app.watch)
 	mux.HandleFunc("POST /masterscalc/rowers", app.createRower)
+	mux.HandleFunc("GET /masterscalc/rowers/print", app.printRowers)
+	mux.HandleFunc("GET /masterscalc/rowers/{idx}/card", app.printRowerCard)
+	mux.HandleFunc("GET /masterscalc/rowers/export", app.exportRowers)
+	mux.HandleFunc("POST /masterscalc/rowers/import", app.importRowers)
+	mux.HandleFunc("GET /masterscalc/backup", app.backupCrew)
+	mux.HandleFunc("POST /masterscalc/restore", app.restoreBackup)
+	mux.HandleFunc(watchWebSocketPattern, app.watchWebSocket)
 	mux.HandleFunc("DELETE /masterscalc/rowers/{idx}", app.deleteRower)
+	mux.HandleFunc("POST /masterscalc/rowers/delete-batch", app.deleteRowers)
+	mux.HandleFunc("POST /masterscalc/rowers/{idx}/clone", app.cloneRower)
+	mux.HandleFunc("GET /masterscalc/lineup", app.suggestLineup)
+	handleCORS(mux, app.cfg.CORSOrigins, http.MethodPost, "/masterscalc/compute", app.computeCrew)
+	mux.HandleFunc("GET /masterscalc/target", app.targetBand)
+	mux.HandleFunc("POST /masterscalc/preview", app.previewCrew)
+	mux.HandleFunc("POST /masterscalc/times", app.addTime)
+	mux.HandleFunc("POST /masterscalc/category", app.setEnteredBand)
+	mux.HandleFunc("POST /masterscalc/crew-name", app.setCrewName)
+	mux.HandleFunc("POST /masterscalc/too-young-policy", app.setTooYoungPolicy)
+	mux.HandleFunc("DELETE /masterscalc/times/{idx}", app.deleteTime)
+	mux.HandleFunc("GET /masterscalc/archive", app.listArchives)
+	mux.HandleFunc("POST /masterscalc/archive", app.archiveCrew)
+	mux.HandleFunc("POST /masterscalc/archive/{id}/restore", app.restoreCrew)
+	mux.HandleFunc("POST /masterscalc/share", app.shareCrew)
+	mux.HandleFunc("GET /masterscalc/shared/{token}", app.openShareLink)
+}
+
+// restartReconnectDelay is how long the page waits to reconnect after the
+// server announces a restart, giving the new server time to start.
+const restartReconnectDelay = 2 * time.Second
+
+// defaultPageDescription summarizes the calculator for search results and
+// link previews of a session without a crew.
+const defaultPageDescription = "Work out a rowing crew's masters age category from its rowers' ages."
+
+// pageDescription summarizes the crew s for link previews, e.g. "4 rowers
+// averaging 47.5 years, category D."
+func pageDescription(s *state) string {
+	if len(s.Rowers) == 0 {
+		return defaultPageDescription
+	}
+	rowers := "rowers"
+	if len(s.Rowers) == 1 {
+		rowers = "rower"
+	}
+	desc := fmt.Sprintf("%d %s averaging %s years", len(s.Rowers), rowers, s.Signals.AverageAge)
+	if s.Signals.AverageBand != "" {
+		desc += ", category " + s.Signals.AverageBandLabel
+	}
+	if s.CrewName != "" {
+		desc = s.CrewName + ": " + desc
+	}
+	return desc + "."
 }
 
 func (app *application) showMainPage(w http.ResponseWriter, r *http.Request) {
 	slog.Info("Showing main page")
 
-	_, err := app.upsertSessionID(r, w)
+	sessionID, err := app.upsertSessionID(r, w)
 	if err != nil {
 		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.New("main").Parse(htmlTemplate)
+	s, err := app.bus.Get(r.Context(), sessionID)
 	if err != nil {
-		http.Error(w, "Error parsing template: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	err = tmpl.Execute(w, nil)
-	if err != nil {
-		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
-		return
+	query := r.URL.Query()
+	sortBy, sortDir := query.Get("sort"), query.Get("dir")
+	if !validSort(sortBy, sortDir) {
+		sortBy, sortDir = "", ""
 	}
-}
-
-func (app *application) watch(w http.ResponseWriter, r *http.Request) {
-	slog.Info("Watching rowers")
+	band := query.Get("band")
 
-	sessionID, err := app.upsertSessionID(r, w)
-	if err != nil {
-		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
-		return
+	watchQuery := url.Values{}
+	if sortBy != "" {
+		watchQuery.Set("sort", sortBy)
+		watchQuery.Set("dir", sortDir)
+	}
+	if band != "" {
+		watchQuery.Set("band", band)
+	}
+	watchURL := "/masterscalc/rowers"
+	if len(watchQuery) > 0 {
+		watchURL += "?" + watchQuery.Encode()
 	}
 
-	sse := datastar.NewSSE(w, r)
-
-	callback := func(s *state) error {
-		tableBuffer := new(strings.Builder)
-		if err := app.table.Execute(tableBuffer, s.Rowers); err != nil {
-			return fmt.Errorf("could not write table template: %w", err)
-		}
-
-		if err := sse.PatchElements(tableBuffer.String()); err != nil {
-			return fmt.Errorf("could not patch elements: %w", err)
-		}
+	bands := make([]string, len(ageBands))
+	for i, ageBand := range ageBands {
+		bands[i] = ageBand.Band
+	}
 
-		if err := sse.MarshalAndPatchSignals(&s.Signals); err != nil {
-			return fmt.Errorf("could not patch signals: %w", err)
-		}
-		return nil
+	data := struct {
+		SortBy             string
+		SortDir            string
+		Band               string
+		Bands              []string
+		WatchURL           string
+		MaxNameLength      int
+		MaxNotesLength     int
+		MaxClubLength      int
+		MaxCrewNameLength  int
+		MaxAvatarURLLength int
+		SiteName           string
+		Description        string
+		ReconnectDelay     int64
+		Announcement       string
+		MinAge             float64
+	}{
+		SortBy:             sortBy,
+		SortDir:            sortDir,
+		Band:               band,
+		Bands:              bands,
+		WatchURL:           watchURL,
+		MaxNameLength:      maxNameLength,
+		MaxNotesLength:     maxNotesLength,
+		MaxClubLength:      maxClubLength,
+		MaxCrewNameLength:  maxCrewNameLength,
+		MaxAvatarURLLength: maxAvatarURLLength,
+		SiteName:           app.cfg.SiteName,
+		Description:        pageDescription(s),
+		ReconnectDelay:     restartReconnectDelay.Milliseconds(),
+		Announcement:       app.cfg.Announcement,
+		MinAge:             minAge,
 	}
 
-	if err := app.bus.Watch(r.Context(), sessionID, callback); err != nil {
-		http.Error(w, "Error while watching: "+err.Error(), http.StatusInternalServerError)
+	err = app.mainPage.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (app *application) createRower(w http.ResponseWriter, r *http.Request) {
-	signals := struct {
-		Name           string `json:"name"`
-		BirthYearOrAge string `json:"birthYearOrAge"`
-	}{}
+func (app *application) showHelp(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		MinAge float64
+		Bands  []bandRange
+	}{
+		MinAge: minAge,
+		Bands:  bandRanges(),
+	}
 
-	if err := datastar.ReadSignals(r, &signals); err != nil {
-		slog.Error("Error reading signals", "error", err)
-		http.Error(w, "Error reading signals: "+err.Error(), http.StatusBadRequest)
+	if err := app.helpPage.Execute(w, data); err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// historyRow is an audit trail entry as shown on the history page.
+type historyRow struct {
+	When   time.Time
+	Change string
+}
 
+func (app *application) showHistory(w http.ResponseWriter, r *http.Request) {
 	sessionID, err := app.upsertSessionID(r, w)
 	if err != nil {
 		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := app.bus.Create(r.Context(), sessionID, signals.Name, signals.BirthYearOrAge); err != nil {
-		http.Error(w, "Error creating rower: "+err.Error(), http.StatusInternalServerError)
+	trail, err := app.bus.History(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Newest first.
+	rows := make([]historyRow, len(trail))
+	for i, event := range trail {
+		rows[len(trail)-1-i] = historyRow{When: event.Time, Change: describeChange(event)}
+	}
+
+	if err := app.historyPage.Execute(w, rows); err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func (app *application) deleteRower(w http.ResponseWriter, r *http.Request) {
-	idx := r.PathValue("idx")
-	if idx == "" {
-		http.Error(w, "Missing rower index", http.StatusBadRequest)
+// describeChange says what a change event did, for the history page.
+func describeChange(event changeEvent) string {
+	switch {
+	case event.Type == changeCreate && event.Rower != nil:
+		return fmt.Sprintf("Added %s (%s)", event.Rower.Name, cmp.Or(event.Rower.Band, "no band"))
+	case event.Type == changeDelete && event.Rower != nil:
+		return fmt.Sprintf("Removed %s (%s)", event.Rower.Name, cmp.Or(event.Rower.Band, "no band"))
+	case event.Detail != "":
+		return strings.ToUpper(event.Detail[:1]) + event.Detail[1:]
+	default:
+		return string(event.Type)
+	}
+}
+
+func (app *application) listBands(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.bus.Bands()); err != nil {
+		slog.Error("Error encoding bands", "error", err)
+	}
+}
+
+func (app *application) watch(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Watching rowers")
+
+	release, ok := app.acquireWatcher()
+	if !ok {
+		slog.Warn("Too many watchers, rejecting", "max", app.cfg.MaxWatchers)
+		http.Error(w, "Too many watchers, try again later", http.StatusServiceUnavailable)
 		return
 	}
+	defer release()
 
-	i, err := strconv.Atoi(idx)
+	view, err := parseTableView(r)
 	if err != nil {
-		http.Error(w, "Invalid rower index: "+err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -213,19 +790,905 @@ func (app *application) deleteRower(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.bus.Delete(r.Context(), sessionID, i); err != nil {
-		http.Error(w, "Error deleting rower: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-}
+	sse := datastar.NewSSE(w, r)
 
-func (app *application) upsertSessionID(r *http.Request, w http.ResponseWriter) (string, error) {
-	sess, err := app.sessionStore.Get(r, "connections")
-	if err != nil {
-		return "", fmt.Errorf("could not get session: %w", err)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var tracked *trackedWatcher
+	tracked, untrack := app.janitor.track(func() {
+		cancel()
+		// Cancelling does not interrupt a blocked write, but a deadline does.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now())
+	}, func() {
+		// Ending the stream lets the client reconnect once the server is back.
+		err := app.janitor.write(tracked, func() error {
+			return sse.MarshalAndPatchSignals(map[string]any{"restarting": true})
+		})
+		if err != nil {
+			slog.Warn("Error sending restart notice", "error", err)
+		}
+		cancel()
+	})
+	defer untrack()
+
+	callback := func(s *state) error {
+		table, err := app.renderTable(s, view)
+		if err != nil {
+			return err
+		}
+
+		return app.janitor.write(tracked, func() error {
+			if err := sse.PatchElements(table); err != nil {
+				return fmt.Errorf("could not patch elements: %w", err)
+			}
+
+			if err := sse.MarshalAndPatchSignals(&s.Signals); err != nil {
+				return fmt.Errorf("could not patch signals: %w", err)
+			}
+			return nil
+		})
 	}
 
-	id, ok := sess.Values["id"].(string)
+	initialized := func() error {
+		return app.janitor.write(tracked, func() error {
+			if err := sse.MarshalAndPatchSignals(map[string]any{"initialized": true}); err != nil {
+				return fmt.Errorf("could not patch signals: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if err := app.bus.Watch(ctx, sessionID, callback, initialized); err != nil {
+		http.Error(w, "Error while watching: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// tableView holds the display options for the rower table.
+type tableView struct {
+	SortBy  string
+	SortDir string
+	Band    string
+}
+
+func parseTableView(r *http.Request) (tableView, error) {
+	query := r.URL.Query()
+	view := tableView{
+		SortBy:  query.Get("sort"),
+		SortDir: query.Get("dir"),
+		Band:    query.Get("band"),
+	}
+	if !validSort(view.SortBy, view.SortDir) {
+		return tableView{}, fmt.Errorf("invalid sort: must be name, age or band with dir asc or desc")
+	}
+	return view, nil
+}
+
+// rowerTable is the data for rowerTableTemplate.
+type rowerTable struct {
+	Rows []rowerRow
+	// Filtered reports that rows are limited to one band, so an empty table
+	// does not mean an empty crew.
+	Filtered bool
+}
+
+// renderTable renders the crew table, sorted and filtered as in view, followed
+// by the leaderboard, each as an element to patch into the page.
+func (app *application) renderTable(s *state, view tableView) (string, error) {
+	tableBuffer := new(strings.Builder)
+	table := rowerTable{
+		Rows:     filterRowers(sortRowers(s.Rowers, view.SortBy, view.SortDir), view.Band),
+		Filtered: view.Band != "",
+	}
+	if err := app.table.Execute(tableBuffer, table); err != nil {
+		return "", fmt.Errorf("could not write table template: %w", err)
+	}
+	if err := app.leaderboard.Execute(tableBuffer, app.bus.Leaderboard(s)); err != nil {
+		return "", fmt.Errorf("could not write leaderboard template: %w", err)
+	}
+	return tableBuffer.String(), nil
+}
+
+func (app *application) printRowers(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.printPage.Execute(w, s); err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// printRowerCard renders a print-friendly card for one rower, such as a name
+// tag for an erg test.
+func (app *application) printRowerCard(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil {
+		http.Error(w, "Invalid rower index: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if i < 0 || i >= len(s.Rowers) {
+		http.Error(w, fmt.Sprintf("Error getting rower: %v: %d", ErrRowerNotFound, i), http.StatusNotFound)
+		return
+	}
+
+	if err := app.cardPage.Execute(w, s.Rowers[i]); err != nil {
+		http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *application) exportRowers(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(s.CrewName)))
+	if err := writeEntryCSV(w, s, app.cfg.ExportFields); err != nil {
+		slog.Error("Error writing export", "error", err)
+	}
+}
+
+// maxImportBytes bounds the size of an imported file.
+const maxImportBytes = 1 << 20
+
+// importReport is the outcome of an import.
+type importReport struct {
+	Imported        int      `json:"imported"`
+	Errors          []string `json:"errors"`
+	Warnings        []string `json:"warnings"`
+	UnmappedColumns []string `json:"unmappedColumns"`
+}
+
+func (app *application) importRowers(w http.ResponseWriter, r *http.Request) {
+	columns, err := importColumns(cmp.Or(r.URL.Query().Get("format"), "roster"), app.cfg.ExportFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	rowers, unmapped, err := readImport(r.Body, columns)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Imports must be at most %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Error reading import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ins := make([]rowerInput, len(rowers))
+	for i, rower := range rowers {
+		ins[i] = rower.Input
+	}
+	errs, err := app.bus.Import(r.Context(), sessionID, ins)
+	if errors.Is(err, ErrStateTooLarge) {
+		http.Error(w, "Error importing rowers: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error importing rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := importReport{Errors: []string{}, Warnings: []string{}, UnmappedColumns: unmapped}
+	if report.UnmappedColumns == nil {
+		report.UnmappedColumns = []string{}
+	}
+	for i, err := range errs {
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("line %d: %v", rowers[i].Line, err))
+			continue
+		}
+		if rowers[i].Warning != "" {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: %s", rowers[i].Line, rowers[i].Warning))
+		}
+		report.Imported++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("Error encoding import report", "error", err)
+	}
+}
+
+func (app *application) backupCrew(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backup, err := app.bus.Backup(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error backing up crew: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", crewFilename(backup.State.CrewName, "backup.json")))
+	if err := json.NewEncoder(w).Encode(backup); err != nil {
+		slog.Error("Error encoding backup", "error", err)
+	}
+}
+
+func (app *application) restoreBackup(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var backup crewBackup
+	if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, fmt.Sprintf("Backups must be at most %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Error reading backup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = app.bus.RestoreBackup(r.Context(), sessionID, &backup)
+	switch {
+	case errors.Is(err, ErrInvalidBackup):
+		http.Error(w, "Error restoring backup: "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrStateTooLarge):
+		http.Error(w, "Error restoring backup: "+err.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		http.Error(w, "Error restoring backup: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (app *application) createRower(w http.ResponseWriter, r *http.Request) {
+	signals := rowerInput{}
+	if !readSignals(w, r, &signals) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = app.bus.Create(r.Context(), sessionID, signals)
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		sse := datastar.NewSSE(w, r)
+		if err := sse.MarshalAndPatchSignals(fieldErrorSignals(verr)); err != nil {
+			slog.Error("Error patching signals", "error", err)
+		}
+		return
+	case errors.Is(err, ErrUnconfirmedDuplicateName):
+		sse := datastar.NewSSE(w, r)
+		if err := sse.MarshalAndPatchSignals(map[string]any{"duplicateWarning": signals.Name + " is already in the crew."}); err != nil {
+			slog.Error("Error patching signals", "error", err)
+		}
+		return
+	case errors.Is(err, ErrDuplicateName):
+		http.Error(w, "Error creating rower: "+err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrStateTooLarge):
+		http.Error(w, "Error creating rower: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "Error creating rower: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	signalsPatch := fieldErrorSignals(nil)
+	for _, input := range formInputs {
+		signalsPatch[input] = ""
+	}
+	signalsPatch["duplicateWarning"] = ""
+	signalsPatch["confirmDuplicate"] = false
+	sse := datastar.NewSSE(w, r)
+	if err := sse.MarshalAndPatchSignals(signalsPatch); err != nil {
+		slog.Error("Error patching signals", "error", err)
+	}
+}
+
+// formInputs are the signals bound to the add rower form's text inputs.
+var formInputs = []string{"name", "birthYearOrAge", "dateOfBirth", "weight", "notes", "club", "avatarUrl"}
+
+// maxSignalsBytes bounds the size of the signals a request may send.
+const maxSignalsBytes = 64 << 10
+
+// signalsValidator is implemented by signals that check their values once read.
+type signalsValidator interface {
+	validateSignals() error
+}
+
+// readSignals reads the request's Datastar signals into v and validates them,
+// writing an error response that says what is wrong and returning false if they
+// are malformed or invalid.
+func readSignals(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSignalsBytes)
+	}
+
+	if err := datastar.ReadSignals(r, v); err != nil {
+		slog.Error("Error reading signals", "error", err)
+		var maxBytesErr *http.MaxBytesError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			http.Error(w, fmt.Sprintf("Signals must be at most %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			http.Error(w, fmt.Sprintf("Invalid signal %s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value), http.StatusBadRequest)
+		default:
+			http.Error(w, "Error reading signals: "+err.Error(), http.StatusBadRequest)
+		}
+		return false
+	}
+
+	if validator, ok := v.(signalsValidator); ok {
+		if err := validator.validateSignals(); err != nil {
+			// A rower's own input gets its field errors, as the form would
+			// show them. A whole crew's wraps them with the rower's position,
+			// which only the message keeps.
+			if verr, ok := err.(*validationError); ok {
+				writeFieldErrors(w, verr)
+				return false
+			}
+			http.Error(w, "Invalid signals: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// fieldErrorSignals returns the per-field error signals with verr's message on
+// its field and every other field cleared. A nil verr clears them all.
+func fieldErrorSignals(verr *validationError) map[string]any {
+	signals := map[string]any{}
+	for _, field := range []string{fieldName, fieldAge, fieldWeight, fieldNotes, fieldClub, fieldAvatar} {
+		signals[field+"Error"] = ""
+	}
+	if verr != nil {
+		signals[verr.Field+"Error"] = verr.Error()
+	}
+	return signals
+}
+
+// writeFieldErrors rejects a request with a 400 carrying the field error
+// signals for verr as JSON, which Datastar merges into the page's signals.
+func writeFieldErrors(w http.ResponseWriter, verr *validationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(fieldErrorSignals(verr)); err != nil {
+		slog.Error("Error encoding field errors", "error", err)
+	}
+}
+
+func (app *application) deleteRower(w http.ResponseWriter, r *http.Request) {
+	idx := r.PathValue("idx")
+	if idx == "" {
+		http.Error(w, "Missing rower index", http.StatusBadRequest)
+		return
+	}
+
+	i, err := strconv.Atoi(idx)
+	if err != nil {
+		http.Error(w, "Invalid rower index: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.Delete(r.Context(), sessionID, i); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrRowerNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, "Error deleting rower: "+err.Error(), status)
+		return
+	}
+}
+
+// deleteBatchInput lists the rowers to delete, by index.
+type deleteBatchInput struct {
+	Indices []int `json:"indices"`
+}
+
+// deleteBatchReport is the outcome of a batch deletion.
+type deleteBatchReport struct {
+	Deleted int   `json:"deleted"`
+	Skipped []int `json:"skipped"`
+}
+
+func (app *application) deleteRowers(w http.ResponseWriter, r *http.Request) {
+	in := deleteBatchInput{}
+	if !readSignals(w, r, &in) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deleted, skipped, err := app.bus.DeleteMany(r.Context(), sessionID, in.Indices)
+	if err != nil {
+		http.Error(w, "Error deleting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := deleteBatchReport{Deleted: deleted, Skipped: skipped}
+	if report.Skipped == nil {
+		report.Skipped = []int{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("Error encoding delete report", "error", err)
+	}
+}
+
+func (app *application) cloneRower(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil {
+		http.Error(w, "Invalid rower index: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.Clone(r.Context(), sessionID, i); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrRowerNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, "Error cloning rower: "+err.Error(), status)
+		return
+	}
+}
+
+func (app *application) addTime(w http.ResponseWriter, r *http.Request) {
+	signals := raceTimeInput{}
+	if !readSignals(w, r, &signals) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.AddTime(r.Context(), sessionID, signals); err != nil {
+		status := http.StatusInternalServerError
+		if verr := (*validationError)(nil); errors.As(err, &verr) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "Error adding time: "+err.Error(), status)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+	if err := sse.MarshalAndPatchSignals(map[string]any{"timeCrew": "", "timeRaw": ""}); err != nil {
+		slog.Error("Error patching signals", "error", err)
+	}
+}
+
+// enteredBandInput is the category override sent by the summary's select.
+type enteredBandInput struct {
+	EnteredBand string `json:"enteredBand"`
+}
+
+func (app *application) setEnteredBand(w http.ResponseWriter, r *http.Request) {
+	signals := enteredBandInput{}
+	if !readSignals(w, r, &signals) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.SetEnteredBand(r.Context(), sessionID, signals.EnteredBand); err != nil {
+		http.Error(w, "Error setting entered category: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// crewNameInput is the crew name sent by the page's crew name input.
+type crewNameInput struct {
+	CrewName string `json:"crewName"`
+}
+
+func (app *application) setCrewName(w http.ResponseWriter, r *http.Request) {
+	signals := crewNameInput{}
+	if !readSignals(w, r, &signals) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.SetCrewName(r.Context(), sessionID, signals.CrewName); err != nil {
+		http.Error(w, "Error setting crew name: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// tooYoungPolicyInput is the too young policy sent by the summary's select.
+type tooYoungPolicyInput struct {
+	TooYoungPolicy string `json:"tooYoungPolicy"`
+}
+
+func (app *application) setTooYoungPolicy(w http.ResponseWriter, r *http.Request) {
+	signals := tooYoungPolicyInput{}
+	if !readSignals(w, r, &signals) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.SetTooYoungPolicy(r.Context(), sessionID, signals.TooYoungPolicy); err != nil {
+		http.Error(w, "Error setting too young policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+func (app *application) deleteTime(w http.ResponseWriter, r *http.Request) {
+	i, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil {
+		http.Error(w, "Invalid time index: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.DeleteTime(r.Context(), sessionID, i); err != nil {
+		http.Error(w, "Error deleting time: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *application) suggestLineup(w http.ResponseWriter, r *http.Request) {
+	boat := r.URL.Query().Get("boat")
+	if boat == "" {
+		http.Error(w, "Missing boat class", http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lineup, err := app.bus.SuggestLineup(s, boat)
+	if err != nil {
+		if errors.Is(err, ErrNoLineup) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Error suggesting lineup: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lineup); err != nil {
+		slog.Error("Error encoding lineup", "error", err)
+	}
+}
+
+func (app *application) targetBand(w http.ResponseWriter, r *http.Request) {
+	band := r.URL.Query().Get("band")
+	if band == "" {
+		http.Error(w, "Missing target band", http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	plan, err := app.bus.TargetBand(sessionID, s, band)
+	if err != nil {
+		if errors.Is(err, ErrEmptyCrew) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Error planning target band: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		slog.Error("Error encoding target plan", "error", err)
+	}
+}
+
+// previewCrew classifies the session's crew as it would be with the posted
+// rower added, without saving anything.
+func (app *application) previewCrew(w http.ResponseWriter, r *http.Request) {
+	in := rowerInput{}
+	if !readSignals(w, r, &in) {
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err := app.bus.Get(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Preview only fails on an invalid rower.
+	crew, err := app.bus.Preview(s, in)
+	if err != nil {
+		http.Error(w, "Invalid rower: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(crew); err != nil {
+		slog.Error("Error encoding crew", "error", err)
+	}
+}
+
+// computeInput is a whole crew posted for a stateless computation.
+type computeInput struct {
+	Rowers []rowerInput `json:"rowers"`
+}
+
+func (in computeInput) validateSignals() error {
+	for i, rower := range in.Rowers {
+		if err := rower.validateSignals(); err != nil {
+			return fmt.Errorf("rower %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// computeCrew classifies a crew posted in full. It uses neither the session nor
+// the store, so embedders can keep the crew client-side without cookies.
+func (app *application) computeCrew(w http.ResponseWriter, r *http.Request) {
+	in := computeInput{}
+	if !readSignals(w, r, &in) {
+		return
+	}
+
+	// Compute only fails on invalid rowers.
+	crew, err := app.bus.Compute(in.Rowers)
+	if err != nil {
+		http.Error(w, "Invalid crew: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(crew); err != nil {
+		slog.Error("Error encoding crew", "error", err)
+	}
+}
+
+func (app *application) listArchives(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	crews, err := app.bus.Archives(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error listing archives: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(crews); err != nil {
+		slog.Error("Error encoding archives", "error", err)
+	}
+}
+
+func (app *application) archiveCrew(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := app.bus.Archive(r.Context(), sessionID); err != nil {
+		http.Error(w, "Error archiving crew: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *application) restoreCrew(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		http.Error(w, "Invalid archive id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.bus.Restore(r.Context(), sessionID, id); err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			http.Error(w, "Archive not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error restoring crew: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// sharePath is the path of the share link with token.
+func sharePath(token string) string {
+	return "/masterscalc/shared/" + url.PathEscape(token)
+}
+
+func (app *application) shareCrew(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := app.bus.Share(r.Context(), sessionID)
+	if err != nil {
+		http.Error(w, "Error sharing crew: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sse := datastar.NewSSE(w, r)
+	if err := sse.MarshalAndPatchSignals(map[string]any{"shareEditUrl": sharePath(tokens.Edit), "shareViewUrl": sharePath(tokens.View)}); err != nil {
+		slog.Error("Error patching signals", "error", err)
+	}
+}
+
+// openShareLink moves the session onto the crew of an edit link, so it sees
+// and makes the same changes as everyone else on it, or shows the crew of a
+// view link read-only.
+func (app *application) openShareLink(w http.ResponseWriter, r *http.Request) {
+	key, role, err := app.bus.SharedCrew(r.Context(), r.PathValue("token"))
+	if errors.Is(err, ErrInvalidShareLink) {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error opening share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if role == shareView {
+		s, err := app.bus.Get(r.Context(), key)
+		if err != nil {
+			http.Error(w, "Error getting rowers: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := app.printPage.Execute(w, s); err != nil {
+			http.Error(w, "Error executing template: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	sess, err := app.session(r)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sess.Values["id"] = key
+	if err := sess.Save(r, w); err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Joined shared crew")
+	http.Redirect(w, r, "/masterscalc", http.StatusSeeOther)
+}
+
+// session returns the request's session, or a new one if it has none.
+func (app *application) session(r *http.Request) (*sessions.Session, error) {
+	sess, err := app.sessionStore.Get(r, app.cfg.SessionName)
+	if err != nil {
+		// A cookie that fails to decode was most likely signed with a previous
+		// SESSION_SECRET, so start a fresh session rather than failing the request.
+		var cookieErr securecookie.Error
+		if !errors.As(err, &cookieErr) || !cookieErr.IsDecode() {
+			return nil, fmt.Errorf("could not get session: %w", err)
+		}
+		slog.Warn("Discarding undecodable session cookie", "error", err, "client", clientIP(r))
+	}
+	return sess, nil
+}
+
+func (app *application) upsertSessionID(r *http.Request, w http.ResponseWriter) (string, error) {
+	sess, err := app.session(r)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := sess.Values["id"].(string)
 
 	if !ok {
 		id = toolbelt.NextEncodedID()
@@ -233,6 +1696,11 @@ func (app *application) upsertSessionID(r *http.Request, w http.ResponseWriter)
 		if err := sess.Save(r, w); err != nil {
 			return "", fmt.Errorf("could not save session: %w", err)
 		}
+		if app.cfg.DemoMode {
+			if err := app.bus.SeedDemo(r.Context(), id); err != nil {
+				return "", fmt.Errorf("could not seed demo crew: %w", err)
+			}
+		}
 	}
 
 	return id, nil
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// testApplicationConfig returns the application configuration loadConfig
+// defaults to.
+func testApplicationConfig() applicationConfig {
+	return applicationConfig{
+		SessionName:     "mc_session",
+		ExportFields:    defaultExportFields,
+		MaxWatchers:     defaultMaxWatchers,
+		WatcherMaxStall: defaultWatcherMaxStall,
+	}
+}
+
+// testSessionKey decodes testSessionSecret.
+func testSessionKey(t testing.TB) []byte {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(testSessionSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestApp returns the routes of an application over bus, with sessions in
+// cookies signed with testSessionKey.
+func newTestApp(t testing.TB, bus *business, cfg applicationConfig) *routeMux {
+	t.Helper()
+	app, err := newApplication(sessions.NewCookieStore(testSessionKey(t)), bus, cfg)
+	if err != nil {
+		t.Fatalf("newApplication: %v", err)
+	}
+	mux := newRouteMux()
+	app.registerRoutes(mux)
+	return mux
+}
+
+// testClient sends requests to a handler, keeping the cookies it sets like a
+// browser would.
+type testClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *testClient {
+	return &testClient{t: t, handler: handler, cookies: map[string]*http.Cookie{}}
+}
+
+// do sends a request with body, which is sent as JSON when not empty.
+func (c *testClient) do(method, target, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+	return w
+}
+
+// mustDo sends a request like do, failing the test unless it gets want.
+func (c *testClient) mustDo(method, target, body string, want int) *httptest.ResponseRecorder {
+	c.t.Helper()
+	w := c.do(method, target, body)
+	if w.Code != want {
+		c.t.Fatalf("%s %s: status %d, want %d: %s", method, target, w.Code, want, w.Body)
+	}
+	return w
+}
+
+func TestSessionCookieName(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.SessionName = "crew_session"
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg)
+
+	w := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "crew_session" {
+		t.Fatalf("cookies = %v, want one named crew_session", cookies)
+	}
+}
+
+func TestSessionWithExpiredState(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	c := newTestClient(t, newTestApp(t, bus, testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex Morgan","birthYearOrAge":"44"}`, http.StatusOK)
+
+	// The cookie outlives the state, as it does once the state TTL passes.
+	ctx := context.Background()
+	keys, err := bus.s.Keys(ctx, "")
+	if err != nil || len(keys) == 0 {
+		t.Fatalf("Keys = %v, %v, want the crew's key", keys, err)
+	}
+	for _, key := range keys {
+		if err := bus.s.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if strings.Contains(body, "Alex Morgan") {
+		t.Errorf("print page still shows the expired crew:\n%s", body)
+	}
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Blake","birthYearOrAge":"52"}`, http.StatusOK)
+	if body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); !strings.Contains(body, "<td>Blake</td>") {
+		t.Errorf("print page does not show the new crew:\n%s", body)
+	}
+}
+
+func TestSessionSignedWithOldKeyStartsNewSession(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+
+	old := sessions.NewCookieStore([]byte("an older session key, now rotated"))
+	req := httptest.NewRequest(http.MethodGet, "/masterscalc", nil)
+	sess, err := old.New(req, "mc_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Values["id"] = "old-session"
+	oldCookie := httptest.NewRecorder()
+	if err := sess.Save(req, oldCookie); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, mux)
+	for _, cookie := range oldCookie.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+	w := c.mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == oldCookie.Result().Cookies()[0].Value {
+		t.Fatalf("cookies = %v, want a new session cookie", cookies)
+	}
+}
+
+func TestPrintRowers(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	c := newTestClient(t, mux)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex Morgan","birthYearOrAge":"44"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"<script>alert(1)</script>","birthYearOrAge":"52"}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+
+	for _, want := range []string{
+		"<td>Alex Morgan</td>",
+		"<td>&lt;script&gt;alert(1)&lt;/script&gt;</td>",
+		"Average age: 48.0",
+		"Crew Masters Category: C",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("print page does not contain %q", want)
+		}
+	}
+	for _, unwanted := range []string{"<script", "datastar", "data-on:"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("print page contains %q", unwanted)
+		}
+	}
+}
+
+func TestRowerTableEscapesNotes(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	c := newTestClient(t, mux)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44","notes":"<b>bow</b> & stroke"}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if !strings.Contains(body, "&lt;b&gt;bow&lt;/b&gt; &amp; stroke") {
+		t.Errorf("print page does not contain the escaped notes:\n%s", body)
+	}
+}
+
+func TestRenderTableEmptyState(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	app, err := newApplication(sessions.NewCookieStore(testSessionKey(t)), bus, testApplicationConfig())
+	if err != nil {
+		t.Fatalf("newApplication: %v", err)
+	}
+
+	table, err := app.renderTable(&state{}, tableView{})
+	if err != nil {
+		t.Fatalf("renderTable: %v", err)
+	}
+	if !strings.Contains(table, "No rowers yet — add your first above.") {
+		t.Errorf("empty table does not show the empty state:\n%s", table)
+	}
+
+	mustCreate(t, bus, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	s := mustGet(t, bus, "crew")
+	table, err = app.renderTable(s, tableView{})
+	if err != nil {
+		t.Fatalf("renderTable: %v", err)
+	}
+	if strings.Contains(table, "empty-state") {
+		t.Errorf("table with a rower still shows the empty state:\n%s", table)
+	}
+
+	if err := bus.SetTooYoungPolicy(context.Background(), "crew", string(tooYoungListIncluded)); err != nil {
+		t.Fatalf("SetTooYoungPolicy: %v", err)
+	}
+	mustCreate(t, bus, "crew", rowerInput{Name: "Sam", BirthYearOrAge: "20"})
+	table, err = app.renderTable(mustGet(t, bus, "crew"), tableView{})
+	if err != nil {
+		t.Fatalf("renderTable: %v", err)
+	}
+	if !strings.Contains(table, "<td>\n\t\t\t—\n\t\t</td>") {
+		t.Errorf("table does not show a dash for the rower without a band:\n%s", table)
+	}
+
+	table, err = app.renderTable(s, tableView{Band: "K"})
+	if err != nil {
+		t.Fatalf("renderTable: %v", err)
+	}
+	if !strings.Contains(table, "No rowers in this category.") || strings.Contains(table, "No rowers yet") {
+		t.Errorf("filtered table does not show the filtered empty state:\n%s", table)
+	}
+}
+
+func TestShowHelp(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	body := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc/help", "", http.StatusOK).Body.String()
+
+	if !strings.Contains(body, "at least 27 to race masters") {
+		t.Error("help page does not give the minimum age")
+	}
+	for _, ageBand := range ageBands {
+		want := fmt.Sprintf("<td>%s</td>\n\t\t<td>%g</td>", ageBand.Band, ageBand.MinAge)
+		if !strings.Contains(body, want) {
+			t.Errorf("help page does not list band %s from %g", ageBand.Band, ageBand.MinAge)
+		}
+	}
+}
+
+func TestMainPageNameMaxLength(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	body := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK).Body.String()
+
+	if want := fmt.Sprintf(`id="inputName" class="form-control" placeholder="e.g. Bob" value="" maxlength="%d"`, maxNameLength); !strings.Contains(body, want) {
+		t.Errorf("main page does not limit the name input to %d characters", maxNameLength)
+	}
+}
+
+func TestMainPageAnnouncement(t *testing.T) {
+	tests := []struct {
+		name         string
+		announcement string
+		want         string
+	}{
+		{name: "set", announcement: "Maintenance at 6pm <today>", want: "<span>Maintenance at 6pm &lt;today&gt;</span>"},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testApplicationConfig()
+			cfg.Announcement = tt.announcement
+			mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg)
+			body := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK).Body.String()
+
+			shown := strings.Contains(body, `class="announcement"`)
+			if shown != (tt.want != "") {
+				t.Errorf("announcement shown = %v, want %v", shown, tt.want != "")
+			}
+			if tt.want != "" && !strings.Contains(body, tt.want) {
+				t.Errorf("main page does not contain %s", tt.want)
+			}
+		})
+	}
+}
+
+func TestMainPageLinkPreview(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.SiteName = `Tideway "Masters"`
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg)
+	body := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK).Body.String()
+
+	for _, want := range []string{
+		`<meta property="og:site_name" content="Tideway &#34;Masters&#34;">`,
+		`<meta property="og:title" content="Tideway &#34;Masters&#34;">`,
+		`<meta property="og:description" content="` + template.HTMLEscapeString(defaultPageDescription) + `">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("main page does not contain %s", want)
+		}
+	}
+}
+
+func TestPageDescription(t *testing.T) {
+	tests := []struct {
+		name string
+		s    state
+		want string
+	}{
+		{name: "no crew", want: defaultPageDescription},
+		{
+			name: "one rower too young for a band",
+			s:    state{Rowers: []rower{{Name: "Sam", Age: 20}}, Signals: rowerSignals{AverageAge: "20.0"}},
+			want: "1 rower averaging 20.0 years.",
+		},
+		{
+			name: "named crew",
+			s: state{
+				CrewName: "Thames Masters 2x",
+				Rowers:   []rower{{Name: "Alex", Age: 61}, {Name: "Blake", Age: 63}},
+				Signals:  rowerSignals{AverageAge: "62.0", AverageBand: "F", AverageBandLabel: "F (60-64)"},
+			},
+			want: "Thames Masters 2x: 2 rowers averaging 62.0 years, category F (60-64).",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageDescription(&tt.s); got != tt.want {
+				t.Errorf("pageDescription = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMainPageLinkPreviewDescribesCrew(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Blake","birthYearOrAge":"51"}`, http.StatusOK)
+	body := c.mustDo(http.MethodGet, "/masterscalc", "", http.StatusOK).Body.String()
+
+	const want = "2 rowers averaging 47.5 years, category C."
+	for _, tag := range []string{
+		`<meta name="description" content="` + want + `">`,
+		`<meta property="og:description" content="` + want + `">`,
+		`<meta name="twitter:description" content="` + want + `">`,
+	} {
+		if !strings.Contains(body, tag) {
+			t.Errorf("main page does not contain %s", tag)
+		}
+	}
+}
+
+func TestWatchMaxWatchers(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.MaxWatchers = 1
+	srv := httptest.NewServer(newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg))
+	defer srv.Close()
+
+	watch := func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/masterscalc/rowers", nil)
+		if err != nil {
+			return nil, err
+		}
+		return srv.Client().Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	first, err := watch(ctx)
+	if err != nil {
+		t.Fatalf("first watch: %v", err)
+	}
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("first watch: status %d, want 200", first.StatusCode)
+	}
+
+	second, err := watch(t.Context())
+	if err != nil {
+		t.Fatalf("second watch: %v", err)
+	}
+	_ = second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second watch: status %d, want 503", second.StatusCode)
+	}
+
+	// The slot is released once the first watcher goes away.
+	cancel()
+	_ = first.Body.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ctx, cancel := context.WithCancel(t.Context())
+		third, err := watch(ctx)
+		if err != nil {
+			cancel()
+			t.Fatalf("third watch: %v", err)
+		}
+		status := third.StatusCode
+		cancel()
+		_ = third.Body.Close()
+		if status == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("watch still gets status %d after the first disconnected", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchShutdownNotice(t *testing.T) {
+	app, err := newApplication(sessions.NewCookieStore(testSessionKey(t)), newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	if err != nil {
+		t.Fatalf("newApplication: %v", err)
+	}
+	mux := newRouteMux()
+	app.registerRoutes(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	srv.Config.RegisterOnShutdown(app.janitor.Shutdown)
+
+	resp, err := srv.Client().Get(srv.URL + "/masterscalc/rowers")
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer resp.Body.Close()
+	stream := bufio.NewReader(resp.Body)
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the crew was sent: %v", err)
+		}
+		if strings.Contains(line, `"initialized":true`) {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- srv.Config.Shutdown(ctx) }()
+
+	rest, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if !strings.Contains(string(rest), `"restarting":true`) {
+		t.Errorf("stream closed without the restart notice:\n%s", rest)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestWatchKeepsFormInput(t *testing.T) {
+	srv := httptest.NewServer(newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	defer srv.Close()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := srv.Client()
+	client.Jar = jar
+
+	// One tab watches the crew while someone types into its form.
+	watch, err := client.Get(srv.URL + "/masterscalc/rowers")
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer watch.Body.Close()
+
+	// Another tab of the same session adds a rower, which clears its own form.
+	resp, err := client.Post(srv.URL+"/masterscalc/rowers", "application/json", strings.NewReader(`{"name":"Alex","birthYearOrAge":"44"}`))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if !strings.Contains(string(body), `"name":""`) {
+		t.Errorf("create response does not clear the form:\n%s", body)
+	}
+
+	stream := bufio.NewReader(watch.Body)
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended before the update: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: signals ") {
+			continue
+		}
+		for _, input := range formInputs {
+			if strings.Contains(line, `"`+input+`":`) {
+				t.Errorf("crew update sets the %s form input: %s", input, line)
+			}
+		}
+		if strings.Contains(line, `"averageBand":"C"`) {
+			break
+		}
+	}
+}
+
+func TestCloneRower(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	c := newTestClient(t, newTestApp(t, bus, testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+
+	c.mustDo(http.MethodPost, "/masterscalc/rowers/0/clone", "", http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers/5/clone", "", http.StatusNotFound)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers/first/clone", "", http.StatusBadRequest)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if !strings.Contains(body, "<td>Alex (copy)</td>") {
+		t.Errorf("print page does not list the clone:\n%s", body)
+	}
+}
+
+func TestCreateRowerFieldErrors(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+
+	// Malformed input is rejected before it reaches the business rules.
+	w := c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"","birthYearOrAge":"44"}`, http.StatusBadRequest)
+	var signals map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &signals); err != nil {
+		t.Fatalf("could not decode the field errors %s: %v", w.Body, err)
+	}
+	if signals["nameError"] == "" || signals["ageError"] != "" {
+		t.Errorf("field errors = %v, want only nameError", signals)
+	}
+
+	// Input that breaks a business rule is reported in a signal patch.
+	w = c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Kit","birthYearOrAge":"20"}`, http.StatusOK)
+	if body := w.Body.String(); !strings.Contains(body, `"ageError":"Kit aged 20 is too young`) || !strings.Contains(body, `"nameError":""`) {
+		t.Errorf("signal patch does not carry the age error:\n%s", body)
+	}
+}
+
+func TestCreateRowerSignalValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "number as a number", body: `{"name":"Alex","birthYearOrAge":44}`, wantStatus: http.StatusOK},
+		{name: "non-numeric age", body: `{"name":"Alex","birthYearOrAge":"forty"}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge must be a whole number, got \"forty\""`},
+		{name: "empty age", body: `{"name":"Alex","birthYearOrAge":""}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge or dateOfBirth is required"`},
+		{name: "empty name", body: `{"name":"","birthYearOrAge":"44"}`, wantStatus: http.StatusBadRequest, wantBody: `"nameError":"name is required"`},
+		{name: "blank name", body: `{"name":"   ","birthYearOrAge":"44"}`, wantStatus: http.StatusBadRequest, wantBody: `"nameError":"name is required"`},
+		{name: "missing age", body: `{"name":"Alex"}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge or dateOfBirth is required"`},
+		{name: "blank age", body: `{"name":"Alex","birthYearOrAge":"  "}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge or dateOfBirth is required"`},
+		{name: "zero age", body: `{"name":"Alex","birthYearOrAge":0}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge must be positive, got 0"`},
+		{name: "negative age", body: `{"name":"Alex","birthYearOrAge":"-44"}`, wantStatus: http.StatusBadRequest, wantBody: `"ageError":"birthYearOrAge must be positive, got -44"`},
+		{name: "non-numeric weight", body: `{"name":"Alex","birthYearOrAge":"44","weight":"heavy"}`, wantStatus: http.StatusBadRequest, wantBody: `"weightError":"weight must be a number, got \"heavy\""`},
+		{name: "wrong type", body: `{"name":5,"birthYearOrAge":"44"}`, wantStatus: http.StatusBadRequest, wantBody: "Invalid signal name: expected string, got number"},
+		{name: "age object", body: `{"name":"Alex","birthYearOrAge":{}}`, wantStatus: http.StatusBadRequest, wantBody: "expected a string or number"},
+		{name: "malformed", body: `{"name":`, wantStatus: http.StatusBadRequest, wantBody: "Error reading signals"},
+		{name: "too large", body: `{"name":"` + strings.Repeat("x", maxSignalsBytes) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+			w := c.mustDo(http.MethodPost, "/masterscalc/rowers", tt.body, tt.wantStatus)
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRowerTableEscapesClub(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44","club":"<i>Tideway</i>"}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if !strings.Contains(body, "&lt;i&gt;Tideway&lt;/i&gt;") || strings.Contains(body, "<i>Tideway") {
+		t.Errorf("print page does not escape the club:\n%s", body)
+	}
+}
+
+func TestComputeCrew(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	mux := newTestApp(t, bus, testApplicationConfig())
+
+	req := httptest.NewRequest(http.MethodPost, "/masterscalc/compute", strings.NewReader(`{"rowers":[{"name":"Alex","birthYearOrAge":"44"},{"name":"Blake","birthYearOrAge":"52"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("compute set cookies %v, want none", cookies)
+	}
+
+	var crew computedCrew
+	if err := json.NewDecoder(w.Body).Decode(&crew); err != nil {
+		t.Fatalf("decode crew: %v", err)
+	}
+	if crew.AverageAge != "48.0" || crew.AverageBand != "C" {
+		t.Errorf("AverageAge, AverageBand = %q, %q, want 48.0, C", crew.AverageAge, crew.AverageBand)
+	}
+	if len(crew.Rowers) != 2 || crew.Rowers[0].Band != "C" || crew.Rowers[1].Band != "D" {
+		t.Errorf("Rowers = %+v, want Alex in C and Blake in D", crew.Rowers)
+	}
+
+	keys, err := bus.s.Keys(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("compute stored keys %v, want none", keys)
+	}
+}
+
+func TestComputeCrewInvalidRower(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	req := httptest.NewRequest(http.MethodPost, "/masterscalc/compute", strings.NewReader(`{"rowers":[{"name":"Alex","birthYearOrAge":"12"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
+
+func TestPreviewCrew(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	c := newTestClient(t, newTestApp(t, bus, testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+
+	w := c.mustDo(http.MethodPost, "/masterscalc/preview", `{"name":"Sam","birthYearOrAge":"72"}`, http.StatusOK)
+	var crew computedCrew
+	if err := json.NewDecoder(w.Body).Decode(&crew); err != nil {
+		t.Fatalf("decode crew: %v", err)
+	}
+	if crew.AverageAge != "58.0" || crew.AverageBand != "E" || len(crew.Rowers) != 2 {
+		t.Errorf("preview = %+v, want two rowers averaging 58.0 in E", crew)
+	}
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if strings.Contains(body, "<td>Sam</td>") {
+		t.Error("preview saved the candidate")
+	}
+	c.mustDo(http.MethodPost, "/masterscalc/preview", `{"name":"Sam","birthYearOrAge":"12"}`, http.StatusBadRequest)
+}
+
+func TestListBands(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.BandFormat = bandFormatMasters
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, cfg), testApplicationConfig()))
+	w := c.mustDo(http.MethodGet, "/masterscalc/bands", "", http.StatusOK)
+
+	var bands []bandDefinition
+	if err := json.NewDecoder(w.Body).Decode(&bands); err != nil {
+		t.Fatalf("decode bands: %v", err)
+	}
+	if len(bands) != len(ageBands) {
+		t.Fatalf("got %d bands, want %d", len(bands), len(ageBands))
+	}
+	for i, band := range bands {
+		if band.Band != ageBands[i].Band || band.MinAge != ageBands[i].MinAge {
+			t.Errorf("band %d = %s from %g, want %s from %g", i, band.Band, band.MinAge, ageBands[i].Band, ageBands[i].MinAge)
+		}
+		if want := "Masters " + band.Band; band.Label != want {
+			t.Errorf("band %s label = %q, want %q", band.Band, band.Label, want)
+		}
+		if i == len(bands)-1 {
+			if band.MaxAge != nil {
+				t.Errorf("top band %s has max age %g, want none", band.Band, *band.MaxAge)
+			}
+			continue
+		}
+		if band.MaxAge == nil || *band.MaxAge != bands[i+1].MinAge-1 {
+			t.Errorf("band %s max age = %v, want %g", band.Band, band.MaxAge, bands[i+1].MinAge-1)
+		}
+	}
+	if a := bands[0]; a.MinAge != 27 || *a.MaxAge != 35 {
+		t.Errorf("band A = %g to %g, want 27 to 35", a.MinAge, *a.MaxAge)
+	}
+}
+
+func TestDeleteRowers(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Blake","birthYearOrAge":"52"}`, http.StatusOK)
+
+	w := c.mustDo(http.MethodPost, "/masterscalc/rowers/delete-batch", `{"indices":[1,1,5]}`, http.StatusOK)
+	if got, want := strings.TrimSpace(w.Body.String()), `{"deleted":1,"skipped":[5]}`; got != want {
+		t.Errorf("report = %s, want %s", got, want)
+	}
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if !strings.Contains(body, "<td>Alex</td>") || strings.Contains(body, "<td>Blake</td>") {
+		t.Errorf("print page does not show only Alex:\n%s", body)
+	}
+}
+
+func BenchmarkRenderTable(b *testing.B) {
+	bus := newTestBusiness(b, testBusinessConfig())
+	app, err := newApplication(sessions.NewCookieStore(testSessionKey(b)), bus, testApplicationConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := benchmarkCrew(b, bus)
+	for b.Loop() {
+		if _, err := app.renderTable(s, tableView{SortBy: "age", SortDir: "desc"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMainPage compares serving the main page from the template parsed
+// once at startup with parsing it again for every request.
+func BenchmarkMainPage(b *testing.B) {
+	mux := newTestApp(b, newTestBusiness(b, testBusinessConfig()), testApplicationConfig())
+	serve := func(b *testing.B) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/masterscalc", nil))
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d", w.Code)
+		}
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			serve(b)
+		}
+	})
+	b.Run("parsed per request", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := template.New("main").Parse(htmlTemplate); err != nil {
+				b.Fatal(err)
+			}
+			serve(b)
+		}
+	})
+}
+
+func TestPrintRowerCard(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44","club":"Tideway"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"<i>Blake</i>","birthYearOrAge":"61","club":"Thames & Co"}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/1/card", "", http.StatusOK).Body.String()
+	for _, want := range []string{
+		"<h1>&lt;i&gt;Blake&lt;/i&gt;</h1>",
+		"<p>Thames &amp; Co</p>",
+		"<p>Age: 61</p>",
+		"<p>Masters Category: F</p>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("card does not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Alex") {
+		t.Error("card for rower 1 shows rower 0")
+	}
+
+	c.mustDo(http.MethodGet, "/masterscalc/rowers/2/card", "", http.StatusNotFound)
+	c.mustDo(http.MethodGet, "/masterscalc/rowers/-1/card", "", http.StatusNotFound)
+	c.mustDo(http.MethodGet, "/masterscalc/rowers/x/card", "", http.StatusBadRequest)
+}
+
+func TestRowerTableAvatarAndName(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	c := newTestClient(t, newTestApp(t, bus, testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"<b>Alex</b>","birthYearOrAge":"44","avatarUrl":" https://example.org/a.png?size=64&round=1 "}`, http.StatusOK)
+
+	// The session's crew is the only one in the store.
+	keys, err := bus.s.Keys(context.Background(), "")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Keys = %v, %v, want the crew's key", keys, err)
+	}
+	s := mustGet(t, bus, keys[0])
+	if got, want := s.Rowers[0].AvatarURL, "https://example.org/a.png?size=64&round=1"; got != want {
+		t.Errorf("AvatarURL = %q, want %q", got, want)
+	}
+
+	app, err := newApplication(sessions.NewCookieStore(testSessionKey(t)), bus, testApplicationConfig())
+	if err != nil {
+		t.Fatalf("newApplication: %v", err)
+	}
+	table, err := app.renderTable(s, tableView{})
+	if err != nil {
+		t.Fatalf("renderTable: %v", err)
+	}
+	if !strings.Contains(table, `src="https://example.org/a.png?size=64&amp;round=1"`) {
+		t.Errorf("table does not show the avatar:\n%s", table)
+	}
+	if !strings.Contains(table, "&lt;b&gt;Alex&lt;/b&gt;") || strings.Contains(table, "<b>Alex") {
+		t.Errorf("table does not escape the name:\n%s", table)
+	}
+
+	card := c.mustDo(http.MethodGet, "/masterscalc/rowers/0/card", "", http.StatusOK).Body.String()
+	if !strings.Contains(card, `src="https://example.org/a.png?size=64&amp;round=1"`) {
+		t.Errorf("card does not show the avatar:\n%s", card)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// defaultAuditMaxEntries is how many changes each session's audit trail keeps
+// unless configured otherwise.
+const defaultAuditMaxEntries = 100
+
+// appendAudit adds events to the audit trail for key, dropping the oldest
+// entries beyond AuditMaxEntries.
+func (b *business) appendAudit(ctx context.Context, key string, events []changeEvent) error {
+	unlock := b.auditLocks.Lock(key)
+	defer unlock()
+
+	trail, err := b.History(ctx, key)
+	if err != nil {
+		return err
+	}
+	trail = append(trail, events...)
+	if extra := len(trail) - b.cfg.AuditMaxEntries; extra > 0 {
+		trail = slices.Delete(trail, 0, extra)
+	}
+
+	x, err := json.Marshal(trail)
+	if err != nil {
+		return fmt.Errorf("could not marshal audit trail: %w", err)
+	}
+	if err := b.audit.Put(ctx, key, x); err != nil {
+		return fmt.Errorf("could not save audit trail: %w", err)
+	}
+	return nil
+}
+
+// History returns the audit trail for key, oldest change first.
+func (b *business) History(ctx context.Context, key string) ([]changeEvent, error) {
+	value, err := b.audit.Get(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get audit trail: %w", err)
+	}
+
+	var trail []changeEvent
+	if err := json.Unmarshal(value, &trail); err != nil {
+		return nil, fmt.Errorf("could not unmarshal audit trail: %w", err)
+	}
+	return trail, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// historyOf describes each change in the audit trail for key, oldest first.
+func historyOf(t *testing.T, b *business, key string) []string {
+	t.Helper()
+	trail, err := b.History(context.Background(), key)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	var changes []string
+	for _, event := range trail {
+		changes = append(changes, describeChange(event))
+	}
+	return changes
+}
+
+func TestAuditTrail(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"}, rowerInput{Name: "Blake", BirthYearOrAge: "52"})
+	if err := b.Delete(ctx, "crew", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	// A rejected rower leaves no entry.
+	if err := b.Create(ctx, "crew", rowerInput{Name: "Casey", BirthYearOrAge: "20"}); err == nil {
+		t.Fatal("Create of a rower aged 20 succeeded")
+	}
+	mustCreate(t, b, "other", rowerInput{Name: "Dana", BirthYearOrAge: "61"})
+
+	want := []string{"Added Alex (C)", "Added Blake (D)", "Removed Alex (C)"}
+	if got := historyOf(t, b, "crew"); !slices.Equal(got, want) {
+		t.Errorf("crew history = %v, want %v", got, want)
+	}
+	if got, want := historyOf(t, b, "other"), []string{"Added Dana (F)"}; !slices.Equal(got, want) {
+		t.Errorf("other history = %v, want %v", got, want)
+	}
+	trail, err := b.History(ctx, "crew")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	for _, event := range trail {
+		if !event.Time.Equal(testNow) || event.Session != "crew" {
+			t.Errorf("event %+v, want it at %s for crew", event, testNow)
+		}
+	}
+}
+
+func TestAuditTrailCapped(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.AuditMaxEntries = 2
+	b := newTestBusiness(t, cfg)
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex", BirthYearOrAge: "44"},
+		rowerInput{Name: "Blake", BirthYearOrAge: "52"},
+		rowerInput{Name: "Casey", BirthYearOrAge: "61"},
+	)
+
+	want := []string{"Added Blake (D)", "Added Casey (F)"}
+	if got := historyOf(t, b, "crew"); !slices.Equal(got, want) {
+		t.Errorf("history = %v, want the newest %v", got, want)
+	}
+}
+
+func TestShowHistory(t *testing.T) {
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"<b>Blake</b>","birthYearOrAge":"52"}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/history", "", http.StatusOK).Body.String()
+	alex := strings.Index(body, "Added Alex (C)")
+	blake := strings.Index(body, "Added &lt;b&gt;Blake&lt;/b&gt; (D)")
+	if alex < 0 || blake < 0 {
+		t.Fatalf("history page does not list both changes, escaped:\n%s", body)
+	}
+	if blake > alex {
+		t.Error("history page does not list the newest change first")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// backupVersion is the version of the backups written. It is raised when the
+// state changes in a way older servers would misread, so a backup can be
+// migrated or turned away rather than restored wrongly.
+const backupVersion = 1
+
+// ErrInvalidBackup is returned when a backup can't be restored as it stands.
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// crewBackup is a session's whole crew, as downloaded for safekeeping or to
+// move it to another device.
+type crewBackup struct {
+	Version int   `json:"version"`
+	State   state `json:"state"`
+}
+
+// Backup returns the crew for key as a backup.
+func (b *business) Backup(ctx context.Context, key string) (*crewBackup, error) {
+	s, err := b.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// A backup may be handed around, so it must not carry the share links.
+	s.Share = shareSecrets{}
+	return &crewBackup{Version: backupVersion, State: *s}, nil
+}
+
+// RestoreBackup replaces the crew for key with the one in backup. The backup
+// comes from the client, so it is checked as if each part had been entered
+// afresh: rowers are classified again as of today, and the signals, which are
+// derived from the crew, are recalculated rather than restored. Rowers listed
+// without a band are kept whatever the crew's too young policy, as when the
+// policy is changed.
+func (b *business) RestoreBackup(ctx context.Context, key string, backup *crewBackup) error {
+	if backup.Version < 1 || backup.Version > backupVersion {
+		return fmt.Errorf("%w: version %d is not supported, the latest is %d", ErrInvalidBackup, backup.Version, backupVersion)
+	}
+	restored, err := b.checkBackup(&backup.State)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+	}
+
+	err = b.mutate(ctx, key, func(s *state) error {
+		slog.Info("Restored crew from backup", "rowers", len(restored.Rowers))
+		s.Rowers = restored.Rowers
+		s.CrewName = restored.CrewName
+		s.Times = restored.Times
+		s.EnteredBand = restored.EnteredBand
+		s.TooYoungPolicy = restored.TooYoungPolicy
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: "restored crew from a backup"})
+	return nil
+}
+
+// checkBackup validates the backed up crew in s, returning it as it will be
+// restored.
+func (b *business) checkBackup(s *state) (*state, error) {
+	restored := &state{Rowers: make([]rower, 0, len(s.Rowers))}
+
+	for i, r := range s.Rowers {
+		in := rowerInput{
+			Name:           r.Name,
+			BirthYearOrAge: signalString(strconv.Itoa(r.BirthYear)),
+			DateOfBirth:    r.DateOfBirth,
+			Notes:          r.Notes,
+			Club:           r.Club,
+			Side:           string(r.Side),
+			AvatarURL:      r.AvatarURL,
+		}
+		if r.Weight != 0 {
+			in.Weight = signalString(strconv.FormatFloat(r.Weight, 'f', -1, 64))
+		}
+		if err := in.validateSignals(); err != nil {
+			return nil, fmt.Errorf("rower %d: %w", i+1, err)
+		}
+		parsed, err := b.parseRower(in)
+		if err != nil {
+			return nil, fmt.Errorf("rower %d: %w", i+1, err)
+		}
+		restored.Rowers = append(restored.Rowers, parsed)
+	}
+
+	restored.CrewName = strings.TrimSpace(s.CrewName)
+	if utf8.RuneCountInString(restored.CrewName) > maxCrewNameLength {
+		return nil, fmt.Errorf("crew name must be at most %d characters", maxCrewNameLength)
+	}
+
+	for i, t := range s.Times {
+		crew := strings.TrimSpace(t.Crew)
+		if crew == "" || utf8.RuneCountInString(crew) > maxNameLength {
+			return nil, fmt.Errorf("race time %d: crew name must be 1 to %d characters", i+1, maxNameLength)
+		}
+		if !knownBand(t.Band) {
+			return nil, fmt.Errorf("race time %d: unknown band %q", i+1, t.Band)
+		}
+		if t.Time <= 0 {
+			return nil, fmt.Errorf("race time %d: time must be more than zero", i+1)
+		}
+		restored.Times = append(restored.Times, raceTime{Crew: crew, Band: t.Band, Time: t.Time})
+	}
+
+	if s.EnteredBand != "" && !knownBand(s.EnteredBand) {
+		return nil, fmt.Errorf("unknown entered band %q", s.EnteredBand)
+	}
+	restored.EnteredBand = s.EnteredBand
+
+	if s.TooYoungPolicy != "" {
+		policy, err := parseTooYoungPolicy(string(s.TooYoungPolicy))
+		if err != nil {
+			return nil, err
+		}
+		restored.TooYoungPolicy = policy
+	}
+	return restored, nil
+}
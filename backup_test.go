@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fullCrew saves a crew at key that uses every part of the state.
+func fullCrew(t *testing.T, b *business, key string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := b.SetTooYoungPolicy(ctx, key, string(tooYoungListIncluded)); err != nil {
+		t.Fatalf("SetTooYoungPolicy: %v", err)
+	}
+	mustCreate(t, b, key,
+		rowerInput{Name: "Alex Morgan", BirthYearOrAge: "44", Club: "Tideway", Side: "port", Weight: "71.5", Notes: "stroke", AvatarURL: "https://example.org/alex.png"},
+		rowerInput{Name: "Blake Hill", DateOfBirth: "1974-07-30", Club: "Thames", Side: "starboard"},
+		rowerInput{Name: "Sam Cruz", BirthYearOrAge: "20", Side: "scull"},
+	)
+	if err := b.SetCrewName(ctx, key, "Thames Masters 4x"); err != nil {
+		t.Fatalf("SetCrewName: %v", err)
+	}
+	if err := b.SetEnteredBand(ctx, key, "B"); err != nil {
+		t.Fatalf("SetEnteredBand: %v", err)
+	}
+	if err := b.AddTime(ctx, key, raceTimeInput{Crew: "Tideway", Band: "D", Time: "7:12.4"}); err != nil {
+		t.Fatalf("AddTime: %v", err)
+	}
+	if _, err := b.Share(ctx, key); err != nil {
+		t.Fatalf("Share: %v", err)
+	}
+}
+
+// sessionFree returns s without what differs between sessions holding the
+// same crew: when it was saved and the session's example input.
+func sessionFree(s state) state {
+	s.SavedAt = time.Time{}
+	s.Signals.Example = ""
+	return s
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	bus := newTestBusiness(t, testBusinessConfig())
+	fullCrew(t, bus, "crew")
+	backup, err := bus.Backup(context.Background(), "crew")
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	data, err := json.Marshal(backup)
+	if err != nil {
+		t.Fatalf("marshal backup: %v", err)
+	}
+	if backup.State.Share != (shareSecrets{}) {
+		t.Error("backup carries the crew's share links")
+	}
+
+	// Restore the backup into another session, as on another device, and
+	// download it again.
+	c := newTestClient(t, newTestApp(t, bus, testApplicationConfig()))
+	c.mustDo(http.MethodPost, "/masterscalc/restore", string(data), http.StatusOK)
+	w := c.mustDo(http.MethodGet, "/masterscalc/backup", "", http.StatusOK)
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="Thames-Masters-4x-backup.json"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	var restored crewBackup
+	if err := json.NewDecoder(w.Body).Decode(&restored); err != nil {
+		t.Fatalf("decode backup: %v", err)
+	}
+
+	if restored.Version != backupVersion {
+		t.Errorf("Version = %d, want %d", restored.Version, backupVersion)
+	}
+	if got, want := sessionFree(restored.State), sessionFree(backup.State); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored crew:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestRestoreInvalidBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup func(*crewBackup)
+	}{
+		{name: "newer version", backup: func(b *crewBackup) { b.Version = backupVersion + 1 }},
+		{name: "no version", backup: func(b *crewBackup) { b.Version = 0 }},
+		{name: "rower without a name", backup: func(b *crewBackup) { b.State.Rowers[0].Name = " " }},
+		{name: "unknown entered band", backup: func(b *crewBackup) { b.State.EnteredBand = "Z" }},
+		{name: "race time of zero", backup: func(b *crewBackup) { b.State.Times[0].Time = 0 }},
+		{name: "unknown too young policy", backup: func(b *crewBackup) { b.State.TooYoungPolicy = "ignore" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := newTestBusiness(t, testBusinessConfig())
+			fullCrew(t, b, "crew")
+			backup, err := b.Backup(ctx, "crew")
+			if err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+			mustCreate(t, b, "other", rowerInput{Name: "Kim", BirthYearOrAge: "61"})
+
+			tt.backup(backup)
+			if err := b.RestoreBackup(ctx, "other", backup); !errors.Is(err, ErrInvalidBackup) {
+				t.Fatalf("RestoreBackup = %v, want %v", err, ErrInvalidBackup)
+			}
+			if s := mustGet(t, b, "other"); len(s.Rowers) != 1 || s.Rowers[0].Name != "Kim" {
+				t.Errorf("crew after a rejected restore = %+v, want it unchanged", s.Rowers)
+			}
+		})
+	}
+
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	w := c.mustDo(http.MethodPost, "/masterscalc/restore", `{"version":99,"state":{}}`, http.StatusBadRequest)
+	if !strings.Contains(w.Body.String(), "version 99 is not supported") {
+		t.Errorf("response = %q, want it to name the version", w.Body)
+	}
+	c.mustDo(http.MethodPost, "/masterscalc/restore", `{"version":`, http.StatusBadRequest)
+}
@@ -1,20 +1,47 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"log/slog"
-	"math/rand/v2"
+	"math"
+	"net/url"
 	"slices"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 type state struct {
 	Rowers  []rower      `json:"rowers"`
 	Signals rowerSignals `json:"signals"`
+
+	// CrewName labels the crew, e.g. "Thames Masters 4x".
+	CrewName string `json:"crewName,omitempty"`
+
+	// SavedAt is when the crew was last saved.
+	SavedAt time.Time `json:"savedAt,omitzero"`
+
+	// Times are race times entered for the leaderboard.
+	Times []raceTime `json:"times,omitempty"`
+
+	// EnteredBand is the category the crew is entered in when it differs from
+	// the computed one, such as a crew entering up a category.
+	EnteredBand string `json:"enteredBand,omitempty"`
+
+	// TooYoungPolicy overrides the configured policy for rowers too young
+	// for a masters category. Empty uses the configured one.
+	TooYoungPolicy tooYoungPolicy `json:"tooYoungPolicy,omitempty"`
+
+	// Share holds the secrets of the crew's share links once it is shared.
+	Share shareSecrets `json:"share,omitzero"`
 }
 
 type rower struct {
@@ -22,93 +49,1016 @@ type rower struct {
 	BirthYear int
 	Age       int
 	Band      string
+	Weight    float64
+	Notes     string
+	Side      side
+	Club      string
+
+	// DateOfBirth is set (as YYYY-MM-DD) when the rower was entered with a
+	// full date of birth, in which case Band is classified from ExactAge.
+	DateOfBirth string  `json:",omitempty"`
+	ExactAge    float64 `json:",omitempty"`
+
+	// AvatarURL links to a picture of the rower. Only the URL is stored, as
+	// images would soon outgrow the store's size limits.
+	AvatarURL string `json:",omitempty"`
 }
 
+// preciseAge returns the rower's exact age if a date of birth was given, and
+// their age this year otherwise.
+func (r rower) preciseAge() float64 {
+	if r.DateOfBirth != "" {
+		return r.ExactAge
+	}
+	return float64(r.Age)
+}
+
+// rowerRow is a rower as displayed, remembering its position in the stored crew.
+type rowerRow struct {
+	Index int
+	rower
+}
+
+type rowerInput struct {
+	Name           string       `json:"name"`
+	BirthYearOrAge signalString `json:"birthYearOrAge"`
+	DateOfBirth    string       `json:"dateOfBirth"`
+	Weight         signalString `json:"weight"`
+	Notes          string       `json:"notes"`
+	Club           string       `json:"club"`
+	Side           string       `json:"side"`
+	AvatarURL      string       `json:"avatarUrl"`
+
+	// ConfirmDuplicate adds the rower even if the crew already has someone
+	// with the same name.
+	ConfirmDuplicate bool `json:"confirmDuplicate"`
+}
+
+// validateSignals checks that the input is complete and its numbers parse, so
+// that malformed requests are rejected before reaching the business rules.
+// The errors name the field at fault, mirroring the form's own checks for
+// clients that skip them.
+func (in rowerInput) validateSignals() error {
+	if strings.TrimSpace(in.Name) == "" {
+		return &validationError{Field: fieldName, Err: errors.New("name is required")}
+	}
+	if strings.TrimSpace(string(in.BirthYearOrAge)) == "" && in.DateOfBirth == "" {
+		return &validationError{Field: fieldAge, Err: errors.New("birthYearOrAge or dateOfBirth is required")}
+	}
+	if in.BirthYearOrAge != "" {
+		n, err := strconv.Atoi(string(in.BirthYearOrAge))
+		if err != nil {
+			return &validationError{Field: fieldAge, Err: fmt.Errorf("birthYearOrAge must be a whole number, got %q", in.BirthYearOrAge)}
+		}
+		if n < 1 {
+			return &validationError{Field: fieldAge, Err: fmt.Errorf("birthYearOrAge must be positive, got %d", n)}
+		}
+	}
+	if in.Weight != "" {
+		if _, err := strconv.ParseFloat(string(in.Weight), 64); err != nil {
+			return &validationError{Field: fieldWeight, Err: fmt.Errorf("weight must be a number, got %q", in.Weight)}
+		}
+	}
+	return nil
+}
+
+// signalString is a string signal that also accepts a JSON number, as clients
+// may send the value of a number input either way.
+type signalString string
+
+func (s *signalString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '"' && string(data) != "null" {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("expected a string or number, got %s", data)
+		}
+		*s = signalString(n)
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	*s = signalString(str)
+	return nil
+}
+
+// rowerSignals are the crew-wide signals sent to every watcher. They leave out
+// the form inputs, so an update to the crew doesn't clobber what someone is
+// typing; the form is cleared only for the client that added a rower.
 type rowerSignals struct {
-	Name           string `json:"name"`
-	BirthYearOrAge string `json:"birthYearOrAge"`
-	AverageAge     string `json:"averageAge"`
-	AverageBand    string `json:"averageBand"`
-	Example        string `json:"example"`
+	CrewName         string `json:"crewName"`
+	AverageAge       string `json:"averageAge"`
+	AverageBand      string `json:"averageBand"`
+	AverageBandLabel string `json:"averageBandLabel"`
+	CrewClass        string `json:"crewClass"`
+	SideBalance      string `json:"sideBalance"`
+	SideWarning      string `json:"sideWarning"`
+	CompositeClubs   string `json:"compositeClubs"`
+	CompositeRule    string `json:"compositeRule"`
+	Example          string `json:"example"`
+
+	// BoatClasses lists the boats the crew is the right size for.
+	BoatClasses string `json:"boatClasses"`
+
+	// EnteredBand is the category override, EnteredBandNote sets it beside
+	// the computed category and EnteredBandWarning flags an entry below it.
+	EnteredBand        string `json:"enteredBand"`
+	EnteredBandNote    string `json:"enteredBandNote"`
+	EnteredBandWarning string `json:"enteredBandWarning"`
+
+	// TooYoungPolicy is the policy in effect for the crew.
+	TooYoungPolicy string `json:"tooYoungPolicy"`
+}
+
+// side is the side of the boat a rower can row on.
+type side string
+
+const (
+	sidePort      side = "port"
+	sideStarboard side = "starboard"
+	sideBoth      side = "both"
+	sideScull     side = "scull"
+)
+
+func parseSide(s string) (side, error) {
+	switch sd := side(s); sd {
+	case "":
+		return sideBoth, nil
+	case sidePort, sideStarboard, sideBoth, sideScull:
+		return sd, nil
+	default:
+		return "", fmt.Errorf("invalid side %q: must be port, starboard, both or scull", s)
+	}
+}
+
+// roundingMode selects how the crew's average age is rounded before it is
+// matched against the age bands.
+type roundingMode string
+
+const (
+	roundingNone  roundingMode = "none"
+	roundingFloor roundingMode = "floor"
+	roundingRound roundingMode = "round"
+)
+
+func parseRoundingMode(mode string) (roundingMode, error) {
+	switch m := roundingMode(mode); m {
+	case roundingNone, roundingFloor, roundingRound:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid rounding mode %q: must be none, floor or round", mode)
+	}
+}
+
+// ageBasis selects the age a rower with a date of birth is classified by. A
+// birth year or age alone always gives the age reached during the year.
+type ageBasis string
+
+const (
+	// ageBasisToday uses the rower's exact age today, so they move up a
+	// category on the birthday that takes them into it.
+	ageBasisToday ageBasis = "today"
+	// ageBasisYearEnd uses the age the rower reaches during the calendar
+	// year, their age on 31 December, as World Rowing masters racing does, so
+	// everyone born in the same year is in the same category all year.
+	ageBasisYearEnd ageBasis = "year-end"
+)
+
+func parseAgeBasis(v string) (ageBasis, error) {
+	switch a := ageBasis(v); a {
+	case ageBasisToday, ageBasisYearEnd:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid age basis %q: must be today or year-end", v)
+	}
+}
+
+// ageFromDateOfBirth returns the age at now, by the configured basis, of a
+// rower born on dob.
+func (b *business) ageFromDateOfBirth(dob, now time.Time) float64 {
+	if b.cfg.AgeBasis == ageBasisYearEnd {
+		return float64(now.Year() - dob.Year())
+	}
+	return preciseAge(dob, now)
+}
+
+// compositeRule selects how the category of a composite crew, one drawing
+// rowers from more than one club, is determined.
+type compositeRule string
+
+const (
+	// compositeAverage treats a composite crew like any other.
+	compositeAverage compositeRule = "average"
+	// compositeYoungest gives a composite crew its youngest rower's band.
+	compositeYoungest compositeRule = "youngest"
+	// compositeDowngrade puts a composite crew one band younger than its
+	// average age would.
+	compositeDowngrade compositeRule = "downgrade"
+)
+
+func parseCompositeRule(rule string) (compositeRule, error) {
+	switch r := compositeRule(rule); r {
+	case compositeAverage, compositeYoungest, compositeDowngrade:
+		return r, nil
+	default:
+		return "", fmt.Errorf("invalid composite rule %q: must be average, youngest or downgrade", rule)
+	}
+}
+
+// band returns the effective band of a composite crew whose average age puts
+// it in averageBand.
+func (r compositeRule) band(rowers []rower, averageBand string) string {
+	switch r {
+	case compositeYoungest:
+		if len(rowers) == 0 {
+			return ""
+		}
+		youngest := slices.MinFunc(rowers, func(a, b rower) int { return cmp.Compare(a.preciseAge(), b.preciseAge()) })
+		return calculateBand(youngest.preciseAge())
+	case compositeDowngrade:
+		for i, ageBand := range ageBands {
+			if ageBand.Band == averageBand && i > 0 {
+				return ageBands[i-1].Band
+			}
+		}
+	}
+	return averageBand
+}
+
+// describe explains how the rule affected a composite crew's category, or
+// returns "" if the crew is categorised as usual.
+func (r compositeRule) describe() string {
+	switch r {
+	case compositeYoungest:
+		return "from the youngest rower"
+	case compositeDowngrade:
+		return "one younger than the average age"
+	default:
+		return ""
+	}
+}
+
+// bandFormat selects how bands are labelled on the page.
+type bandFormat string
+
+const (
+	bandFormatLetter  bandFormat = "letter"
+	bandFormatMasters bandFormat = "masters"
+	bandFormatRange   bandFormat = "range"
+)
+
+func parseBandFormat(format string) (bandFormat, error) {
+	switch f := bandFormat(format); f {
+	case bandFormatLetter, bandFormatMasters, bandFormatRange:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid band format %q: must be letter, masters or range", format)
+	}
+}
+
+// label formats band, e.g. "C", "Masters C" or "C (43-49)". An empty band,
+// meaning no category, stays empty.
+func (f bandFormat) label(band string) string {
+	if band == "" {
+		return ""
+	}
+	switch f {
+	case bandFormatMasters:
+		return "Masters " + band
+	case bandFormatRange:
+		for _, r := range bandRanges() {
+			if r.Band == band {
+				return fmt.Sprintf("%s (%s)", band, r.Range)
+			}
+		}
+	}
+	return band
+}
+
+func (m roundingMode) apply(age float64) float64 {
+	switch m {
+	case roundingFloor:
+		return math.Floor(age)
+	case roundingRound:
+		return math.Floor(age + 0.5)
+	default:
+		return age
+	}
+}
+
+// duplicateNamePolicy selects what happens when a rower is added with the same
+// name as someone already in the crew.
+type duplicateNamePolicy string
+
+const (
+	duplicateNamesAllow duplicateNamePolicy = "allow"
+	duplicateNamesWarn  duplicateNamePolicy = "warn"
+	duplicateNamesBlock duplicateNamePolicy = "block"
+)
+
+func parseDuplicateNamePolicy(policy string) (duplicateNamePolicy, error) {
+	switch p := duplicateNamePolicy(policy); p {
+	case duplicateNamesAllow, duplicateNamesWarn, duplicateNamesBlock:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid duplicate name policy %q: must be allow, warn or block", policy)
+	}
+}
+
+// tooYoungPolicy selects what happens when a rower is too young for a masters
+// category.
+type tooYoungPolicy string
+
+const (
+	// tooYoungReject refuses the rower.
+	tooYoungReject tooYoungPolicy = "reject"
+	// tooYoungListExcluded lists the rower without a band and leaves them out
+	// of the average, as for a training squad.
+	tooYoungListExcluded tooYoungPolicy = "list-excluded"
+	// tooYoungListIncluded lists the rower without a band but still counts
+	// their age in the average.
+	tooYoungListIncluded tooYoungPolicy = "list-included"
+)
+
+func parseTooYoungPolicy(policy string) (tooYoungPolicy, error) {
+	switch p := tooYoungPolicy(policy); p {
+	case tooYoungReject, tooYoungListExcluded, tooYoungListIncluded:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid too young policy %q: must be reject, list-excluded or list-included", policy)
+	}
+}
+
+var (
+	// ErrDuplicateName is returned when a duplicate name is blocked outright.
+	ErrDuplicateName = errors.New("a rower with this name is already in the crew")
+	// ErrUnconfirmedDuplicateName is returned when a duplicate name needs the
+	// user to confirm it before the rower is added.
+	ErrUnconfirmedDuplicateName = errors.New("a rower with this name is already in the crew, add anyway?")
+	// ErrRowerNotFound is returned when a rower index is outside the crew.
+	ErrRowerNotFound = errors.New("rower not found")
+	// ErrStateTooLarge is returned when a crew would no longer fit in the
+	// store.
+	ErrStateTooLarge = errors.New("too many rowers for storage")
+)
+
+// validationError is an invalid rower input, naming the form field at fault so
+// the page can show the message next to it.
+type validationError struct {
+	Field string
+	Err   error
+}
+
+func (e *validationError) Error() string { return e.Err.Error() }
+
+func (e *validationError) Unwrap() error { return e.Err }
+
+// The form fields a validationError can refer to. The age field covers both
+// the birth year or age and the date of birth.
+const (
+	fieldName   = "name"
+	fieldAge    = "age"
+	fieldWeight = "weight"
+	fieldNotes  = "notes"
+	fieldClub   = "club"
+	fieldAvatar = "avatar"
+)
+
+type businessConfig struct {
+	Rounding       roundingMode
+	DuplicateNames duplicateNamePolicy
+
+	// MaxAge is the oldest plausible age for a rower. It bounds both validation
+	// and the generated example input.
+	MaxAge int
+
+	// WriteBatchWindow is how long a write waits for others to the same
+	// session to join its batch.
+	WriteBatchWindow time.Duration
+
+	// WriteTimeout, when positive, bounds each batch of writes. The batch
+	// outlives the request that started it, so it needs its own deadline.
+	WriteTimeout time.Duration
+
+	// AveragePrecision is the number of decimals the average age is shown
+	// with. It does not affect the band, which uses the exact average.
+	AveragePrecision int
+
+	// CompositeRule decides the category of crews drawn from several clubs.
+	CompositeRule compositeRule
+
+	// Handicaps are the time allowances, per band, used by the leaderboard.
+	Handicaps handicaps
+
+	// Features is the rollout of the feature flags across sessions.
+	Features featureRollout
+
+	// WatchCoalesceWindow, when positive, batches a watcher's updates within
+	// this long of each other into a single render of the latest crew.
+	WatchCoalesceWindow time.Duration
+
+	// AgeBasis is the age rowers with a date of birth are classified by.
+	AgeBasis ageBasis
+
+	// TTLRefresh, when positive, re-saves a crew read over this long after it
+	// was last saved, renewing its TTL while it is being viewed.
+	TTLRefresh time.Duration
+
+	// MaxStateBytes is the largest stored crew, as serialized, that the store
+	// takes. Zero leaves the limit to the store.
+	MaxStateBytes int
+
+	// AuditMaxEntries caps each session's audit trail; the oldest entries are
+	// dropped first.
+	AuditMaxEntries int
+
+	// BoatClasses are the boats a lineup can be suggested for, with the
+	// number of rowers and coxes each takes.
+	BoatClasses []boatClass
+
+	// BandFormat is how bands are labelled in the table and summary.
+	BandFormat bandFormat
+
+	// TooYoungPolicy is the default policy for rowers too young for a
+	// masters category; each crew can choose its own.
+	TooYoungPolicy tooYoungPolicy
+
+	// TooYoungMessage renders the error shown for a rower too young for a
+	// masters category. Nil uses defaultTooYoungMessage.
+	TooYoungMessage *template.Template
+}
+
+// defaultTooYoungMessage is the template for the too young error when none is
+// configured.
+const defaultTooYoungMessage = "{{.Name}} aged {{.Age}} is too young for a masters category"
+
+// tooYoungData is what a too young message template is rendered with.
+type tooYoungData struct {
+	Name   string
+	Age    int
+	MinAge float64
+}
+
+// parseTooYoungMessage parses a too young message template, rendering it once
+// so that unknown fields are reported at startup rather than on a request.
+func parseTooYoungMessage(text string) (*template.Template, error) {
+	t, err := template.New("tooYoung").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(io.Discard, tooYoungData{Name: "Example", Age: 20, MinAge: minAge}); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 type business struct {
-	s *store
+	s       store
+	archive store
+	audit   store
+	events  publisher
+	cfg     businessConfig
+	// auditLocks serializes appends to each session's audit trail.
+	auditLocks *keyedMutex
+	writes     *writeBatcher
+	now        func() time.Time
 }
 
-func newBusiness(s *store) *business {
-	return &business{s: s}
+// newBusiness creates the business layer over the live, archive and audit
+// stores, publishing changes to events. A nil events publishes nothing.
+func newBusiness(s store, archive store, audit store, events publisher, cfg businessConfig) *business {
+	if cfg.TooYoungMessage == nil {
+		cfg.TooYoungMessage = template.Must(parseTooYoungMessage(defaultTooYoungMessage))
+	}
+	if events == nil {
+		events = noopPublisher{}
+	}
+	return &business{
+		s:          s,
+		archive:    archive,
+		audit:      audit,
+		events:     events,
+		cfg:        cfg,
+		auditLocks: newKeyedMutex(),
+		writes:     newWriteBatcher(cfg.WriteBatchWindow),
+		now:        time.Now,
+	}
 }
 
-func (b *business) Create(ctx context.Context, key, name, birthYearOrAgeStr string) error {
-	s, err := b.getState(ctx, key)
+func (b *business) Create(ctx context.Context, key string, in rowerInput) error {
+	rower, err := b.parseRower(in)
+	if err != nil {
+		return err
+	}
+
+	err = b.mutate(ctx, key, func(s *state) error {
+		if err := b.admitRower(s, rower); err != nil {
+			return err
+		}
+		if b.cfg.DuplicateNames != duplicateNamesAllow && hasRowerNamed(s.Rowers, in.Name) {
+			if b.cfg.DuplicateNames == duplicateNamesBlock {
+				return ErrDuplicateName
+			}
+			if !in.ConfirmDuplicate {
+				return ErrUnconfirmedDuplicateName
+			}
+		}
+
+		slog.Info("Created rower", "rower", rower)
+		s.Rowers = append(s.Rowers, rower)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeCreate, Rower: &rower})
+	return nil
+}
+
+// computedCrew is a crew with its computed averages, as returned by Compute.
+type computedCrew struct {
+	Rowers           []rower `json:"rowers"`
+	AverageAge       string  `json:"averageAge"`
+	AverageBand      string  `json:"averageBand"`
+	AverageBandLabel string  `json:"averageBandLabel"`
+	CrewClass        string  `json:"crewClass"`
+	SideBalance      string  `json:"sideBalance"`
+	SideWarning      string  `json:"sideWarning"`
+	CompositeClubs   string  `json:"compositeClubs"`
+	CompositeRule    string  `json:"compositeRule"`
+}
+
+// Compute classifies a crew given in full, without reading or writing the
+// store, for clients that keep the crew themselves.
+func (b *business) Compute(ins []rowerInput) (*computedCrew, error) {
+	s := &state{Rowers: make([]rower, 0, len(ins))}
+	for i, in := range ins {
+		rower, err := b.parseRower(in)
+		if err == nil {
+			err = b.admitRower(s, rower)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rower %d: %w", i+1, err)
+		}
+		s.Rowers = append(s.Rowers, rower)
+	}
+	return b.compute(s), nil
+}
+
+// Preview classifies the crew s as it would be with the rower described by in
+// added, without changing s or the store, so a coach can see the effect of a
+// candidate before adding them.
+func (b *business) Preview(s *state, in rowerInput) (*computedCrew, error) {
+	rower, err := b.parseRower(in)
 	if err != nil {
-		return fmt.Errorf("could not get state: %w", err)
+		return nil, err
+	}
+	if err := b.admitRower(s, rower); err != nil {
+		return nil, err
+	}
+
+	preview := *s
+	preview.Rowers = append(slices.Clone(s.Rowers), rower)
+	return b.compute(&preview), nil
+}
+
+// compute updates the signals of s and returns it as a computedCrew.
+func (b *business) compute(s *state) *computedCrew {
+	b.updateSignals("", s)
+	return &computedCrew{
+		Rowers:           s.Rowers,
+		AverageAge:       s.Signals.AverageAge,
+		AverageBand:      s.Signals.AverageBand,
+		AverageBandLabel: s.Signals.AverageBandLabel,
+		CrewClass:        s.Signals.CrewClass,
+		SideBalance:      s.Signals.SideBalance,
+		SideWarning:      s.Signals.SideWarning,
+		CompositeClubs:   s.Signals.CompositeClubs,
+		CompositeRule:    s.Signals.CompositeRule,
 	}
+}
 
-	birthYearOrAge, err := strconv.Atoi(birthYearOrAgeStr)
+// parseRower validates in and creates the rower it describes. A rower too
+// young for a masters category is returned without a band; admitRower decides
+// whether the crew takes them.
+func (b *business) parseRower(in rowerInput) (rower, error) {
+	weight, err := parseWeight(string(in.Weight))
 	if err != nil {
-		return fmt.Errorf("invalid birth year or age: %w", err)
+		return rower{}, &validationError{Field: fieldWeight, Err: err}
 	}
 
-	rower, err := newRower(name, birthYearOrAge)
+	side, err := parseSide(in.Side)
 	if err != nil {
-		return fmt.Errorf("could not create rower: %w", err)
+		return rower{}, err
 	}
 
-	slog.Info("Created rower", "rower", rower)
-	s.Rowers = append(s.Rowers, rower)
+	notes := strings.TrimSpace(in.Notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return rower{}, &validationError{Field: fieldNotes, Err: fmt.Errorf("notes must be at most %d characters", maxNotesLength)}
+	}
 
-	updateSignals(s)
+	club := strings.TrimSpace(in.Club)
+	if utf8.RuneCountInString(club) > maxClubLength {
+		return rower{}, &validationError{Field: fieldClub, Err: fmt.Errorf("club must be at most %d characters", maxClubLength)}
+	}
 
-	if err := b.putState(ctx, key, s); err != nil {
-		return fmt.Errorf("could not save state: %w", err)
+	avatarURL, err := parseAvatarURL(in.AvatarURL)
+	if err != nil {
+		return rower{}, &validationError{Field: fieldAvatar, Err: err}
 	}
 
+	var rower rower
+	if in.DateOfBirth != "" {
+		dob, err := time.Parse(dateOfBirthLayout, in.DateOfBirth)
+		if err != nil {
+			return rower, &validationError{Field: fieldAge, Err: fmt.Errorf("invalid date of birth: %w", err)}
+		}
+		rower, err = b.newRowerFromDateOfBirth(in.Name, dob, weight)
+		if err != nil {
+			return rower, fmt.Errorf("could not create rower: %w", err)
+		}
+	} else {
+		birthYearOrAge, err := strconv.Atoi(string(in.BirthYearOrAge))
+		if err != nil {
+			return rower, &validationError{Field: fieldAge, Err: fmt.Errorf("invalid birth year or age: %w", err)}
+		}
+		rower, err = b.newRower(in.Name, birthYearOrAge, weight)
+		if err != nil {
+			return rower, fmt.Errorf("could not create rower: %w", err)
+		}
+	}
+	rower.Notes = notes
+	rower.Club = club
+	rower.AvatarURL = avatarURL
+	rower.Side = side
+	return rower, nil
+}
+
+// admitRower checks that the crew s takes r under its too young policy.
+func (b *business) admitRower(s *state, r rower) error {
+	if r.Band == "" && b.tooYoungPolicyOf(s) == tooYoungReject {
+		return &validationError{Field: fieldAge, Err: b.tooYoungError(r.Name, r.Age)}
+	}
 	return nil
 }
 
+// tooYoungPolicyOf returns the too young policy in effect for the crew s.
+func (b *business) tooYoungPolicyOf(s *state) tooYoungPolicy {
+	return cmp.Or(s.TooYoungPolicy, b.cfg.TooYoungPolicy, tooYoungReject)
+}
+
+// averagedRowers returns the rowers counted in the crew's average age, leaving
+// out those without a band when the policy excludes them.
+func (b *business) averagedRowers(s *state) []rower {
+	if b.tooYoungPolicyOf(s) != tooYoungListExcluded {
+		return s.Rowers
+	}
+	return slices.DeleteFunc(slices.Clone(s.Rowers), func(r rower) bool { return r.Band == "" })
+}
+
 func (b *business) Delete(ctx context.Context, key string, index int) error {
+	var deleted rower
+	err := b.mutate(ctx, key, func(s *state) error {
+		if index < 0 || index >= len(s.Rowers) {
+			return fmt.Errorf("%w: %d", ErrRowerNotFound, index)
+		}
+
+		deleted = s.Rowers[index]
+		slog.Info("Deleted rower", "rower", deleted)
+		s.Rowers = slices.Delete(s.Rowers, index, index+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeDelete, Rower: &deleted})
+	return nil
+}
+
+// DeleteMany removes the rowers at indices in a single write. Repeated indices
+// are removed once, and indices outside the crew are skipped and returned.
+func (b *business) DeleteMany(ctx context.Context, key string, indices []int) (deleted int, skipped []int, err error) {
+	var events []changeEvent
+	err = b.mutate(ctx, key, func(s *state) error {
+		deleted, skipped, events = 0, nil, nil
+		remove := make([]bool, len(s.Rowers))
+		for _, index := range indices {
+			if index < 0 || index >= len(s.Rowers) {
+				if !slices.Contains(skipped, index) {
+					skipped = append(skipped, index)
+				}
+				continue
+			}
+			if !remove[index] {
+				remove[index] = true
+				deleted++
+			}
+		}
+		if deleted == 0 {
+			return errNothingDeleted
+		}
+
+		kept := s.Rowers[:0]
+		for i, r := range s.Rowers {
+			if remove[i] {
+				slog.Info("Deleted rower", "rower", r)
+				events = append(events, changeEvent{Type: changeDelete, Rower: &r})
+				continue
+			}
+			kept = append(kept, r)
+		}
+		s.Rowers = kept
+		return nil
+	})
+	if errors.Is(err, errNothingDeleted) {
+		err = nil
+	}
+	if err == nil {
+		b.publish(ctx, key, events...)
+	}
+	return deleted, skipped, err
+}
+
+// errNothingDeleted leaves the state unsaved when no index matched a rower.
+var errNothingDeleted = errors.New("nothing deleted")
+
+// Clone appends a copy of the rower at index, named as a copy so it can be
+// told apart and edited.
+func (b *business) Clone(ctx context.Context, key string, index int) error {
+	var clone rower
+	err := b.mutate(ctx, key, func(s *state) error {
+		if index < 0 || index >= len(s.Rowers) {
+			return fmt.Errorf("%w: %d", ErrRowerNotFound, index)
+		}
+
+		clone = s.Rowers[index]
+		clone.Name = copyName(clone.Name)
+		slog.Info("Cloned rower", "rower", clone)
+		s.Rowers = append(s.Rowers, clone)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeCreate, Rower: &clone})
+	return nil
+}
+
+// copyName appends " (copy)" to name, shortening name if needed to stay within
+// maxNameLength.
+func copyName(name string) string {
+	const suffix = " (copy)"
+	runes := []rune(name)
+	if limit := maxNameLength - len(suffix); len(runes) > limit {
+		runes = runes[:limit]
+	}
+	return string(runes) + suffix
+}
+
+// archivedCrew describes a crew saved to the archive.
+type archivedCrew struct {
+	ID         string    `json:"id"`
+	ArchivedAt time.Time `json:"archivedAt"`
+	CrewName   string    `json:"crewName,omitempty"`
+	Rowers     int       `json:"rowers"`
+}
+
+// Archive copies the crew for key to the longer-lived archive store and
+// returns the ID it was archived under.
+func (b *business) Archive(ctx context.Context, key string) (string, error) {
 	s, err := b.getState(ctx, key)
 	if err != nil {
-		return fmt.Errorf("could not get state: %w", err)
+		return "", fmt.Errorf("could not get state: %w", err)
 	}
 
-	if index < 0 || index >= len(s.Rowers) {
-		return fmt.Errorf("row not found: %d", index)
+	x, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal state: %w", err)
 	}
 
-	slog.Info("Deleted rower", "rower", s.Rowers[index])
-	s.Rowers = slices.Delete(s.Rowers, index, index+1)
+	id := strconv.FormatInt(b.now().UnixMilli(), 10)
+	if err := b.archive.Put(ctx, archiveKey(key, id), x); err != nil {
+		return "", fmt.Errorf("could not archive state: %w", err)
+	}
 
-	updateSignals(s)
+	slog.Info("Archived crew", "id", id, "rowers", len(s.Rowers))
+	return id, nil
+}
 
-	if err := b.putState(ctx, key, s); err != nil {
-		return fmt.Errorf("could not save state: %w", err)
+// Archives lists the archived crews for key, newest first.
+func (b *business) Archives(ctx context.Context, key string) ([]archivedCrew, error) {
+	keys, err := b.archive.Keys(ctx, archiveKey(key, ""))
+	if err != nil {
+		return nil, fmt.Errorf("could not list archives: %w", err)
+	}
+
+	crews := make([]archivedCrew, 0, len(keys))
+	for _, k := range keys {
+		id := strings.TrimPrefix(k, archiveKey(key, ""))
+		millis, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s, err := b.getArchivedState(ctx, key, id)
+		if err != nil {
+			if errors.Is(err, ErrKeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		crews = append(crews, archivedCrew{
+			ID:         id,
+			ArchivedAt: time.UnixMilli(millis).UTC(),
+			CrewName:   s.CrewName,
+			Rowers:     len(s.Rowers),
+		})
+	}
+
+	slices.SortFunc(crews, func(a, b archivedCrew) int { return b.ArchivedAt.Compare(a.ArchivedAt) })
+	return crews, nil
+}
+
+// Restore replaces the crew for key with the archived crew id.
+func (b *business) Restore(ctx context.Context, key, id string) error {
+	archived, err := b.getArchivedState(ctx, key, id)
+	if err != nil {
+		return err
 	}
 
+	err = b.mutate(ctx, key, func(s *state) error {
+		slog.Info("Restored crew", "id", id, "rowers", len(archived.Rowers))
+		s.Rowers = archived.Rowers
+		s.CrewName = archived.CrewName
+		s.Times = archived.Times
+		s.EnteredBand = archived.EnteredBand
+		s.TooYoungPolicy = archived.TooYoungPolicy
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: "restored archived crew " + id})
 	return nil
 }
 
-func (b *business) Watch(ctx context.Context, key string, callback func(*state) error) error {
+func (b *business) getArchivedState(ctx context.Context, key, id string) (*state, error) {
+	value, err := b.archive.Get(ctx, archiveKey(key, id))
+	if err != nil {
+		return nil, fmt.Errorf("could not get archived state: %w", err)
+	}
 	s := &state{}
-	updateSignals(s)
+	if err := json.Unmarshal(value, s); err != nil {
+		return nil, fmt.Errorf("could not unmarshal archived state: %w", err)
+	}
+	return s, nil
+}
+
+// archiveKey is the archive store key for crew id of session key. An empty id
+// gives the prefix shared by all of the session's archives.
+func archiveKey(key, id string) string {
+	return key + "." + id
+}
+
+// mutate applies fn to the stored state for key and saves the result. Writes
+// for the same key are serialized, and writes that arrive while an earlier
+// one is in flight are batched into a single read and write, so concurrent
+// requests from one session don't overwrite each other's changes: a Create
+// racing a Delete sees the other's result, whichever runs first. The
+// serialization is per process, so instances sharing a store can still lose
+// updates. fn must leave the state untouched when it returns an error.
+func (b *business) mutate(ctx context.Context, key string, fn func(*state) error) error {
+	// The batch may carry other requests' writes, so it must not be abandoned
+	// if this request goes away, but is still bounded by its own deadline.
+	ctx = context.WithoutCancel(ctx)
+	return b.writes.Do(key, fn, func(fns []func(*state) error) []error {
+		if b.cfg.WriteTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, b.cfg.WriteTimeout)
+			defer cancel()
+		}
+		return b.commit(ctx, key, fns)
+	})
+}
+
+// commit applies a batch of writes to the stored state for key, returning the
+// result of each.
+func (b *business) commit(ctx context.Context, key string, fns []func(*state) error) []error {
+	errs := make([]error, len(fns))
+
+	s, err := b.getState(ctx, key)
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("could not get state: %w", err)
+		}
+		return errs
+	}
+
+	applied := 0
+	for i, fn := range fns {
+		if errs[i] = fn(s); errs[i] == nil {
+			applied++
+		}
+	}
+	if applied == 0 {
+		return errs
+	}
+
+	b.updateSignals(key, s)
+
+	if err := b.putState(ctx, key, s); err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = fmt.Errorf("could not save state: %w", err)
+			}
+		}
+		return errs
+	}
+
+	slog.Debug("Saved state", "key", key, "writes", applied)
+	return errs
+}
+
+func (b *business) Get(ctx context.Context, key string) (*state, error) {
+	s, err := b.getState(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not get state: %w", err)
+	}
+	b.refreshIfStale(ctx, key, s)
+	b.updateSignals(key, s)
+	return s, nil
+}
+
+// Watch calls callback with the crew at key and again on every change until ctx
+// is cancelled. initialized is called once, after the stored crew has been
+// delivered, so the page can tell an empty crew from one still loading.
+func (b *business) Watch(ctx context.Context, key string, callback func(*state) error, initialized func() error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	s := &state{}
+	b.updateSignals(key, s)
 	if err := callback(s); err != nil {
 		return fmt.Errorf("could not execute callback: %w", err)
 	}
+	if ctx.Err() != nil {
+		return nil
+	}
 
 	callbackWrapper := func(value []byte) error {
+		if ctx.Err() != nil {
+			return nil
+		}
 		s := &state{}
-		if err := json.Unmarshal(value, s); err != nil {
+		if value == nil {
+			b.updateSignals(key, s)
+		} else if err := json.Unmarshal(value, s); err != nil {
 			return fmt.Errorf("could not unmarshal state: %w", err)
 		}
+		b.refreshIfStale(ctx, key, s)
 		if err := callback(s); err != nil {
 			return fmt.Errorf("could not execute callback: %w", err)
 		}
 		return nil
 	}
 
-	if err := b.s.Watch(ctx, key, callbackWrapper); err != nil {
+	initializedWrapper := func() error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return initialized()
+	}
+
+	if b.cfg.TTLRefresh > 0 {
+		go b.keepAlive(ctx, key)
+	}
+
+	if b.cfg.WatchCoalesceWindow <= 0 {
+		if err := b.s.Watch(ctx, key, callbackWrapper, initializedWrapper); err != nil {
+			return fmt.Errorf("could not watch key: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	coalescer := newWatchCoalescer(b.cfg.WatchCoalesceWindow, callbackWrapper, cancel)
+	// The stored crew is rendered before initialized, without waiting for the
+	// window, so the page doesn't briefly show it as empty.
+	initializedFlush := func() error {
+		if err := coalescer.flush(); err != nil {
+			return err
+		}
+		return initializedWrapper()
+	}
+	err := b.s.Watch(ctx, key, coalescer.update, initializedFlush)
+	if stopErr := coalescer.stop(); err == nil && stopErr != nil {
+		err = stopErr
+	}
+	if err != nil {
 		return fmt.Errorf("could not watch key: %w", err)
 	}
 	return nil
@@ -130,29 +1080,172 @@ func (b *business) getState(ctx context.Context, key string) (*state, error) {
 }
 
 func (b *business) putState(ctx context.Context, key string, s *state) error {
+	s.SavedAt = b.now()
 	x, err := json.Marshal(s)
 	if err != nil {
 		return fmt.Errorf("could not marshal state: %w", err)
 	}
+	// Checked up front, as the store's own error for an oversized value says
+	// nothing about the crew.
+	if b.cfg.MaxStateBytes > 0 && len(x) > b.cfg.MaxStateBytes {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrStateTooLarge, len(x), b.cfg.MaxStateBytes)
+	}
 	if err := b.s.Put(ctx, key, x); err != nil {
 		return fmt.Errorf("could not save state: %w", err)
 	}
 	return nil
 }
 
-func updateSignals(s *state) {
-	averageAge := calculateAverageAge(s.Rowers)
-	averageBand := calculateBand(averageAge)
-
-	exampleInputAge := int(minAge + rand.Float64()*(maxAge-minAge))
-	exampleInputYear := time.Now().Year() - exampleInputAge
+func (b *business) updateSignals(key string, s *state) {
+	averaged := b.averagedRowers(s)
+	averageAge := calculateAverageAge(averaged)
+	averageBand := b.crewBand(key, s)
+	clubs := compositeClubs(s.Rowers)
+	compositeRule := ""
+	if clubs != nil {
+		compositeRule = b.cfg.CompositeRule.describe()
+	}
+	crewClass := calculateCrewClass(averaged, averageBand)
+	sideBalance, sideWarning := calculateSideBalance(s.Rowers)
 
-	slog.Info("Updated averages", "averageAge", averageAge, "averageBand", averageBand)
+	slog.Info("Updated averages", "averageAge", averageAge, "averageBand", averageBand, "crewClass", crewClass)
 	s.Signals = rowerSignals{
-		AverageAge:  fmt.Sprintf("%.1f", averageAge),
+		CrewName:    s.CrewName,
+		AverageAge:  strconv.FormatFloat(averageAge, 'f', b.cfg.AveragePrecision, 64),
 		AverageBand: averageBand,
-		Example:     fmt.Sprintf("e.g. %d or %d", exampleInputYear, exampleInputAge),
+		// The label is for display; AverageBand stays the bare letter for
+		// exports.
+		AverageBandLabel: b.cfg.BandFormat.label(averageBand),
+		CrewClass:        crewClass,
+		SideBalance:      sideBalance,
+		SideWarning:      sideWarning,
+		CompositeClubs:   strings.Join(clubs, ", "),
+		CompositeRule:    compositeRule,
+		Example:          b.exampleInput(key),
+		BoatClasses:      strings.Join(b.fittingBoatClasses(len(s.Rowers)), ", "),
+		EnteredBand:      s.EnteredBand,
+		TooYoungPolicy:   string(b.tooYoungPolicyOf(s)),
+	}
+	if s.EnteredBand != "" && averageBand != "" {
+		s.Signals.EnteredBandNote = fmt.Sprintf("Computed %s, entered as %s", b.cfg.BandFormat.label(averageBand), b.cfg.BandFormat.label(s.EnteredBand))
+		// Bands are single letters in order, so they compare as strings.
+		if s.EnteredBand < averageBand {
+			s.Signals.EnteredBandWarning = fmt.Sprintf("A crew can't enter below its computed category %s.", b.cfg.BandFormat.label(averageBand))
+		}
+	}
+}
+
+// SetEnteredBand overrides the category the crew for key is entered in. An
+// empty band clears the override. A band below the computed category is kept
+// but flagged, since the crew may still change.
+func (b *business) SetEnteredBand(ctx context.Context, key, band string) error {
+	band = strings.ToUpper(strings.TrimSpace(band))
+	if band != "" && !knownBand(band) {
+		return fmt.Errorf("unknown band %q", band)
+	}
+
+	err := b.mutate(ctx, key, func(s *state) error {
+		slog.Info("Set entered band", "band", band)
+		s.EnteredBand = band
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	detail := "cleared the entered category"
+	if band != "" {
+		detail = "entered as " + band
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: detail})
+	return nil
+}
+
+// crewBand returns the category of the crew s: the band of its average age,
+// rounded as configured for key, adjusted by the composite rule when its
+// rowers come from more than one club.
+func (b *business) crewBand(key string, s *state) string {
+	averaged := b.averagedRowers(s)
+	band := calculateBand(b.rounding(key).apply(calculateAverageAge(averaged)))
+	if compositeClubs(s.Rowers) != nil {
+		band = b.cfg.CompositeRule.band(averaged, band)
+	}
+	return band
+}
+
+// SetCrewName names the crew for key. An empty name clears it.
+func (b *business) SetCrewName(ctx context.Context, key, name string) error {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxCrewNameLength {
+		return fmt.Errorf("crew name must be at most %d characters", maxCrewNameLength)
 	}
+
+	err := b.mutate(ctx, key, func(s *state) error {
+		slog.Info("Set crew name", "name", name)
+		s.CrewName = name
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	detail := "cleared the crew name"
+	if name != "" {
+		detail = "named the crew " + name
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: detail})
+	return nil
+}
+
+// SetTooYoungPolicy sets the too young policy for the crew for key. An empty
+// policy goes back to the configured one. Rowers already listed without a band
+// are kept whatever the policy.
+func (b *business) SetTooYoungPolicy(ctx context.Context, key, policy string) error {
+	var p tooYoungPolicy
+	if policy != "" {
+		var err error
+		if p, err = parseTooYoungPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	err := b.mutate(ctx, key, func(s *state) error {
+		slog.Info("Set too young policy", "policy", p)
+		s.TooYoungPolicy = p
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	detail := "reset the too young policy"
+	if p != "" {
+		detail = "set the too young policy to " + string(p)
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: detail})
+	return nil
+}
+
+// rounding returns the rounding mode for the session key, which a feature flag
+// may change from the configured one.
+func (b *business) rounding(key string) roundingMode {
+	if b.cfg.Features.enabled(featureRoundHalfUp, key) {
+		return roundingRound
+	}
+	return b.cfg.Rounding
+}
+
+// exampleInput returns the placeholder for the age input, showing how an age
+// translates to a birth year. The age is the first of a band within MaxAge,
+// chosen from the session key so it stays the same while the form is filled in.
+func (b *business) exampleInput(key string) string {
+	var ages []int
+	for _, ageBand := range ageBands {
+		if int(ageBand.MinAge) <= b.cfg.MaxAge {
+			ages = append(ages, int(ageBand.MinAge))
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	age := ages[h.Sum32()%uint32(len(ages))]
+	return fmt.Sprintf("e.g. %d → born %d", age, b.now().Year()-age)
 }
 
 var ageBands = []struct {
@@ -173,39 +1266,279 @@ var ageBands = []struct {
 }
 
 var minAge = ageBands[0].MinAge
-var maxAge = ageBands[len(ageBands)-1].MinAge
 
-func newRower(name string, birthYearOrAge int) (rower, error) {
+// knownBand reports whether band is one of the age bands.
+func knownBand(band string) bool {
+	for _, ageBand := range ageBands {
+		if ageBand.Band == band {
+			return true
+		}
+	}
+	return false
+}
+
+// bandRange is an age band together with the ages it covers.
+type bandRange struct {
+	Band   string
+	MinAge float64
+	Range  string
+}
+
+// bandRanges describes each age band, deriving its upper age from the next
+// band's minimum. The top band is open-ended.
+func bandRanges() []bandRange {
+	ranges := make([]bandRange, len(ageBands))
+	for i, ageBand := range ageBands {
+		r := fmt.Sprintf("%g+", ageBand.MinAge)
+		if i+1 < len(ageBands) {
+			r = fmt.Sprintf("%g-%g", ageBand.MinAge, ageBands[i+1].MinAge-1)
+		}
+		ranges[i] = bandRange{Band: ageBand.Band, MinAge: ageBand.MinAge, Range: r}
+	}
+	return ranges
+}
+
+// bandDefinition is an age band as published to clients.
+type bandDefinition struct {
+	Band   string  `json:"band"`
+	Label  string  `json:"label"`
+	MinAge float64 `json:"minAge"`
+	// MaxAge is nil for the open-ended top band.
+	MaxAge *float64 `json:"maxAge"`
+}
+
+// Bands returns the age bands in ascending order, labelled in the configured
+// band format.
+func (b *business) Bands() []bandDefinition {
+	bands := make([]bandDefinition, len(ageBands))
+	for i, ageBand := range ageBands {
+		bands[i] = bandDefinition{Band: ageBand.Band, Label: b.cfg.BandFormat.label(ageBand.Band), MinAge: ageBand.MinAge}
+		if i+1 < len(ageBands) {
+			maxAge := ageBands[i+1].MinAge - 1
+			bands[i].MaxAge = &maxAge
+		}
+	}
+	return bands
+}
+
+// defaultMaxAge is the oldest plausible age accepted for a rower unless
+// configured otherwise.
+const defaultMaxAge = 100
+
+// bandMinAge returns the minimum age of band, or -1 for a rower too young
+// for any band.
+func bandMinAge(band string) float64 {
+	for _, ageBand := range ageBands {
+		if ageBand.Band == band {
+			return ageBand.MinAge
+		}
+	}
+	return -1
+}
+
+// lightweightMaxAverageWeight is the highest average crew weight, in kg, that
+// still qualifies a crew as lightweight.
+const lightweightMaxAverageWeight = 75.0
+
+const maxWeight = 250.0
+
+const maxNotesLength = 200
+
+const maxClubLength = 64
+
+// maxAvatarURLLength is the longest avatar URL accepted. The form enforces the
+// same limit.
+const maxAvatarURLLength = 512
+
+// parseAvatarURL checks that an avatar URL is an absolute http or https URL,
+// which a browser loads as an image without running it. An empty URL is no
+// avatar.
+func parseAvatarURL(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", nil
+	}
+	if len(v) > maxAvatarURLLength {
+		return "", fmt.Errorf("avatar URL must be at most %d characters", maxAvatarURLLength)
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid avatar URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid avatar URL %q: must be an http or https address", v)
+	}
+	return u.String(), nil
+}
+
+// maxCrewNameLength is the longest crew name accepted, in characters. The form
+// enforces the same limit.
+const maxCrewNameLength = 64
+
+// maxNameLength is the longest rower name accepted, in characters. The form
+// enforces the same limit.
+const maxNameLength = 64
+
+func parseWeight(weightStr string) (float64, error) {
+	if weightStr == "" {
+		return 0, nil
+	}
+	weight, err := strconv.ParseFloat(weightStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid weight: %w", err)
+	}
+	if weight <= 0 || weight > maxWeight {
+		return 0, fmt.Errorf("invalid weight: %g", weight)
+	}
+	return weight, nil
+}
+
+func (b *business) newRower(name string, birthYearOrAge int, weight float64) (rower, error) {
 	birthYear := birthYearOrAge
-	thisYear := time.Now().Year()
+	thisYear := b.now().Year()
 	if birthYearOrAge < 200 {
 		birthYear = thisYear - birthYearOrAge
 	}
 	age := thisYear - birthYear
 	if age < 1 {
-		return rower{}, fmt.Errorf("invalid birth year or age: %d", birthYearOrAge)
+		return rower{}, &validationError{Field: fieldAge, Err: fmt.Errorf("invalid birth year or age: %d", birthYearOrAge)}
 	}
-	band := calculateBand(float64(age))
-	if band == "" {
-		return rower{}, fmt.Errorf("%s aged %d is too young for a masters category", name, age)
+	band, err := b.checkRower(name, age, float64(age))
+	if err != nil {
+		return rower{}, err
 	}
 	return rower{
 		Name:      name,
 		BirthYear: birthYear,
 		Age:       age,
 		Band:      band,
+		Weight:    weight,
+	}, nil
+}
+
+// newRowerFromDateOfBirth creates a rower whose band is classified from their
+// age by the configured basis: by default their precise age today, so a rower
+// days away from a band boundary stays in the band they are actually in.
+func (b *business) newRowerFromDateOfBirth(name string, dob time.Time, weight float64) (rower, error) {
+	now := b.now()
+	if !dob.Before(now) {
+		return rower{}, &validationError{Field: fieldAge, Err: fmt.Errorf("invalid date of birth: %s", dob.Format(dateOfBirthLayout))}
+	}
+	exactAge := b.ageFromDateOfBirth(dob, now)
+	age := int(exactAge)
+	if age < 1 {
+		return rower{}, &validationError{Field: fieldAge, Err: fmt.Errorf("invalid date of birth: %s", dob.Format(dateOfBirthLayout))}
+	}
+	band, err := b.checkRower(name, age, exactAge)
+	if err != nil {
+		return rower{}, err
+	}
+	return rower{
+		Name:        name,
+		BirthYear:   dob.Year(),
+		Age:         age,
+		Band:        band,
+		Weight:      weight,
+		DateOfBirth: dob.Format(dateOfBirthLayout),
+		ExactAge:    exactAge,
 	}, nil
 }
 
+// checkRower validates a new rower's name and age, returning the band for
+// exactAge. The band is empty for a rower too young for a masters category.
+func (b *business) checkRower(name string, age int, exactAge float64) (string, error) {
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return "", &validationError{Field: fieldName, Err: fmt.Errorf("name must be at most %d characters", maxNameLength)}
+	}
+	if age > b.cfg.MaxAge {
+		return "", &validationError{Field: fieldAge, Err: fmt.Errorf("%s aged %d is older than the maximum age of %d", name, age, b.cfg.MaxAge)}
+	}
+	return calculateBand(exactAge), nil
+}
+
+// tooYoungError renders the configured too young message for a rower.
+func (b *business) tooYoungError(name string, age int) error {
+	var msg strings.Builder
+	if err := b.cfg.TooYoungMessage.Execute(&msg, tooYoungData{Name: name, Age: age, MinAge: minAge}); err != nil {
+		slog.Error("Error rendering too young message", "error", err)
+		return fmt.Errorf("%s aged %d is too young for a masters category", name, age)
+	}
+	return errors.New(msg.String())
+}
+
+const dateOfBirthLayout = "2006-01-02"
+
+// preciseAge returns the age in years at now of someone born on dob, with the
+// fraction of the year since their last birthday.
+func preciseAge(dob, now time.Time) float64 {
+	years := now.Year() - dob.Year()
+	birthday := dob.AddDate(years, 0, 0)
+	if birthday.After(now) {
+		years--
+		birthday = dob.AddDate(years, 0, 0)
+	}
+	next := dob.AddDate(years+1, 0, 0)
+	return float64(years) + float64(now.Sub(birthday))/float64(next.Sub(birthday))
+}
+
+// NextBand describes how long until the rower moves up a category, e.g.
+// "2 yrs to D", or "—" when they are already in the top band.
+func (r rower) NextBand() string {
+	age := r.preciseAge()
+	for _, ageBand := range ageBands {
+		if ageBand.MinAge > age {
+			years := int(math.Ceil(ageBand.MinAge - age))
+			unit := "yrs"
+			if years == 1 {
+				unit = "yr"
+			}
+			return fmt.Sprintf("%d %s to %s", years, unit, ageBand.Band)
+		}
+	}
+	return "—"
+}
+
+// hasRowerNamed reports whether any rower has name, ignoring case and
+// surrounding whitespace.
+func hasRowerNamed(rowers []rower, name string) bool {
+	name = strings.TrimSpace(name)
+	return slices.ContainsFunc(rowers, func(r rower) bool {
+		return strings.EqualFold(strings.TrimSpace(r.Name), name)
+	})
+}
+
+// compositeClubs returns the clubs of a composite crew, one drawing rowers from
+// more than one club, in the order they first appear. It returns nil for a
+// single-club crew. Rowers without a club are ignored and clubs are compared
+// case-insensitively.
+func compositeClubs(rowers []rower) []string {
+	var clubs []string
+	seen := map[string]bool{}
+	for _, r := range rowers {
+		if r.Club == "" || seen[strings.ToLower(r.Club)] {
+			continue
+		}
+		seen[strings.ToLower(r.Club)] = true
+		clubs = append(clubs, r.Club)
+	}
+	if len(clubs) < 2 {
+		return nil
+	}
+	return clubs
+}
+
+// calculateAverageAge averages the ages the rowers are classified by, so
+// rowers entered with a date of birth count their age by the configured basis
+// rather than in whole years.
 func calculateAverageAge(rowers []rower) float64 {
 	if len(rowers) == 0 {
 		return 0.0
 	}
-	totalAge := 0
+	totalAge := 0.0
 	for _, r := range rowers {
-		totalAge += r.Age
+		totalAge += r.preciseAge()
 	}
-	return float64(totalAge) / float64(len(rowers))
+	return totalAge / float64(len(rowers))
 }
 
 func calculateBand(age float64) string {
@@ -218,3 +1551,123 @@ func calculateBand(age float64) string {
 	}
 	return band
 }
+
+// calculateCrewClass combines the crew's masters band with its lightweight
+// status, e.g. "Masters C Lightweight". Weight is ignored when no rower has
+// one recorded, and reported as incomplete when only some do.
+func calculateCrewClass(rowers []rower, band string) string {
+	if band == "" {
+		return ""
+	}
+	class := "Masters " + band
+
+	weighed := 0
+	totalWeight := 0.0
+	for _, r := range rowers {
+		if r.Weight > 0 {
+			weighed++
+			totalWeight += r.Weight
+		}
+	}
+	switch {
+	case weighed == 0:
+		return class
+	case weighed < len(rowers):
+		return class + " (weight incomplete)"
+	case totalWeight/float64(weighed) <= lightweightMaxAverageWeight:
+		return class + " Lightweight"
+	default:
+		return class
+	}
+}
+
+// validSort reports whether by and dir name a supported ordering. An empty by
+// keeps the stored order.
+func validSort(by, dir string) bool {
+	switch by {
+	case "":
+		return dir == ""
+	case "name", "age", "band":
+		return dir == "" || dir == "asc" || dir == "desc"
+	default:
+		return false
+	}
+}
+
+// sortRowers returns the rowers ordered by name, age or band, leaving the
+// stored order untouched. Ties keep their stored order.
+func sortRowers(rowers []rower, by, dir string) []rowerRow {
+	rows := make([]rowerRow, len(rowers))
+	for i, r := range rowers {
+		rows[i] = rowerRow{Index: i, rower: r}
+	}
+
+	var cmp func(a, b rowerRow) int
+	switch by {
+	case "name":
+		cmp = func(a, b rowerRow) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }
+	case "age":
+		cmp = func(a, b rowerRow) int { return a.Age - b.Age }
+	case "band":
+		cmp = func(a, b rowerRow) int {
+			if ma, mb := bandMinAge(a.Band), bandMinAge(b.Band); ma != mb {
+				return int(ma - mb)
+			}
+			return a.Age - b.Age
+		}
+	default:
+		return rows
+	}
+	if dir == "desc" {
+		asc := cmp
+		cmp = func(a, b rowerRow) int { return asc(b, a) }
+	}
+
+	slices.SortStableFunc(rows, cmp)
+	return rows
+}
+
+// filterRowers keeps only the rows in band. An empty band keeps every row and
+// an unknown band keeps none.
+func filterRowers(rows []rowerRow, band string) []rowerRow {
+	if band == "" {
+		return rows
+	}
+	return slices.DeleteFunc(rows, func(r rowerRow) bool { return r.Band != band })
+}
+
+// calculateSideBalance summarises how many rowers can row on each side and
+// warns when the crew cannot be split evenly between port and starboard.
+// Rowers recorded before sides existed count as able to row either side.
+func calculateSideBalance(rowers []rower) (balance, warning string) {
+	counts := map[side]int{}
+	for _, r := range rowers {
+		sd := r.Side
+		if sd == "" {
+			sd = sideBoth
+		}
+		counts[sd]++
+	}
+
+	sweep := counts[sidePort] + counts[sideStarboard] + counts[sideBoth]
+	if sweep == 0 {
+		if counts[sideScull] > 0 {
+			return fmt.Sprintf("%d sculling", counts[sideScull]), ""
+		}
+		return "", ""
+	}
+
+	balance = fmt.Sprintf("%d port / %d starboard / %d either", counts[sidePort], counts[sideStarboard], counts[sideBoth])
+	half := sweep / 2
+	switch {
+	case counts[sideScull] > 0:
+		warning = "Crew mixes sweep and sculling rowers"
+	case sweep%2 != 0:
+		warning = "Odd number of sweep rowers"
+	case counts[sidePort] > half:
+		warning = fmt.Sprintf("Too many port-side rowers: %d of %d seats", counts[sidePort], half)
+	case counts[sideStarboard] > half:
+		warning = fmt.Sprintf("Too many starboard-side rowers: %d of %d seats", counts[sideStarboard], half)
+	}
+	return balance, warning
+}
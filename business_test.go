@@ -0,0 +1,1427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// testNow is the time the tests run at, so that ages and bands don't change
+// with the year.
+var testNow = time.Date(2026, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+// testBusinessConfig returns the business configuration loadConfig defaults to.
+func testBusinessConfig() businessConfig {
+	return businessConfig{
+		Rounding:         roundingNone,
+		AgeBasis:         ageBasisToday,
+		DuplicateNames:   duplicateNamesWarn,
+		TooYoungPolicy:   tooYoungReject,
+		MaxAge:           defaultMaxAge,
+		BandFormat:       bandFormatLetter,
+		CompositeRule:    compositeAverage,
+		AveragePrecision: 1,
+		Handicaps:        defaultHandicaps,
+		AuditMaxEntries:  defaultAuditMaxEntries,
+		BoatClasses:      defaultBoatClasses,
+	}
+}
+
+// newTestBusiness returns a business over memory stores whose clock is fixed
+// at testNow.
+func newTestBusiness(t testing.TB, cfg businessConfig) *business {
+	t.Helper()
+	b := newBusiness(newMemoryStore(time.Hour), newMemoryStore(time.Hour), newMemoryStore(time.Hour), nil, cfg)
+	b.now = func() time.Time { return testNow }
+	return b
+}
+
+// mustCreate adds the rowers to the crew at key, failing the test on error.
+func mustCreate(t testing.TB, b *business, key string, ins ...rowerInput) {
+	t.Helper()
+	for _, in := range ins {
+		if err := b.Create(context.Background(), key, in); err != nil {
+			t.Fatalf("Create(%q): %v", in.Name, err)
+		}
+	}
+}
+
+// mustGet returns the crew at key, failing the test on error.
+func mustGet(t testing.TB, b *business, key string) *state {
+	t.Helper()
+	s, err := b.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return s
+}
+
+func TestCrewClass(t *testing.T) {
+	tests := []struct {
+		name   string
+		rowers []rowerInput
+		want   string
+	}{
+		{
+			name: "lightweight",
+			rowers: []rowerInput{
+				{Name: "A", BirthYearOrAge: "44", Weight: "70"},
+				{Name: "B", BirthYearOrAge: "46", Weight: "74"},
+			},
+			want: "Masters C Lightweight",
+		},
+		{
+			name: "heavyweight",
+			rowers: []rowerInput{
+				{Name: "A", BirthYearOrAge: "44", Weight: "80"},
+				{Name: "B", BirthYearOrAge: "46", Weight: "74"},
+			},
+			want: "Masters C",
+		},
+		{
+			name: "weight incomplete",
+			rowers: []rowerInput{
+				{Name: "A", BirthYearOrAge: "44", Weight: "70"},
+				{Name: "B", BirthYearOrAge: "46"},
+			},
+			want: "Masters C (weight incomplete)",
+		},
+		{
+			name: "no weights",
+			rowers: []rowerInput{
+				{Name: "A", BirthYearOrAge: "44"},
+				{Name: "B", BirthYearOrAge: "46"},
+			},
+			want: "Masters C",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			mustCreate(t, b, "crew", tt.rowers...)
+			if got := mustGet(t, b, "crew").Signals.CrewClass; got != tt.want {
+				t.Errorf("CrewClass = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// watchCountingStore counts the watches started on the store it wraps.
+type watchCountingStore struct {
+	store
+	watches atomic.Int32
+}
+
+func (s *watchCountingStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	s.watches.Add(1)
+	return s.store.Watch(ctx, key, callback, initialized)
+}
+
+func TestWatchCancelledBeforeStart(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	counting := &watchCountingStore{store: b.s}
+	b.s = counting
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	callbacks := 0
+	err := b.Watch(ctx, "crew", func(*state) error { callbacks++; return nil }, func() error { return nil })
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if callbacks != 0 {
+		t.Errorf("callback called %d times, want 0", callbacks)
+	}
+	if n := counting.watches.Load(); n != 0 {
+		t.Errorf("store watched %d times, want 0", n)
+	}
+}
+
+func TestWatchCancelledByInitialCallback(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	counting := &watchCountingStore{store: b.s}
+	b.s = counting
+
+	// The client goes away while the initial crew is being sent.
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.Watch(ctx, "crew", func(*state) error { cancel(); return nil }, func() error { return nil })
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if n := counting.watches.Load(); n != 0 {
+		t.Errorf("store watched %d times, want 0", n)
+	}
+}
+
+func TestWatchDeliversToEveryWatcher(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two clients watch the same crew, as for a crew shared by its key.
+	const watchers = 2
+	var initialized sync.WaitGroup
+	updated := make(chan int, watchers)
+	errs := make(chan error, watchers)
+	for i := range watchers {
+		initialized.Add(1)
+		go func() {
+			seen := false
+			errs <- b.Watch(ctx, "crew", func(s *state) error {
+				if !seen && hasRowerNamed(s.Rowers, "Alex") {
+					seen = true
+					updated <- i
+				}
+				return nil
+			}, func() error { initialized.Done(); return nil })
+		}()
+	}
+	initialized.Wait()
+
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	for range watchers {
+		select {
+		case <-updated:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a watcher did not receive the edit")
+		}
+	}
+	cancel()
+	for range watchers {
+		if err := <-errs; err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	}
+}
+
+func TestCreateNotes(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44", Notes: "  bow side, available weekends  "})
+
+	if got := mustGet(t, b, "crew").Rowers[0].Notes; got != "bow side, available weekends" {
+		t.Errorf("Notes = %q, want them trimmed and kept", got)
+	}
+
+	err := b.Create(context.Background(), "crew", rowerInput{Name: "Sam", BirthYearOrAge: "44", Notes: strings.Repeat("x", maxNotesLength+1)})
+	var verr *validationError
+	if !errors.As(err, &verr) || verr.Field != fieldNotes {
+		t.Errorf("Create with long notes: %v, want a notes field error", err)
+	}
+	if n := len(mustGet(t, b, "crew").Rowers); n != 1 {
+		t.Errorf("%d rowers after the rejected Create, want 1", n)
+	}
+}
+
+func TestSortRowers(t *testing.T) {
+	rowers := []rower{
+		{Name: "Charlie", Age: 52},
+		{Name: "alex", Age: 44},
+		{Name: "Blake", Age: 61},
+		{Name: "Dana", Age: 44},
+	}
+	names := func(rows []rowerRow) []string {
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		by, dir string
+		want    []string
+	}{
+		{by: "", dir: "", want: []string{"Charlie", "alex", "Blake", "Dana"}},
+		{by: "age", dir: "asc", want: []string{"alex", "Dana", "Charlie", "Blake"}},
+		{by: "age", dir: "desc", want: []string{"Blake", "Charlie", "alex", "Dana"}},
+		{by: "name", dir: "", want: []string{"alex", "Blake", "Charlie", "Dana"}},
+		{by: "name", dir: "desc", want: []string{"Dana", "Charlie", "Blake", "alex"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by+" "+tt.dir, func(t *testing.T) {
+			rows := sortRowers(rowers, tt.by, tt.dir)
+			if got := names(rows); !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+			for _, r := range rows {
+				if rowers[r.Index].Name != r.Name {
+					t.Errorf("row %q has index %d, which is %q", r.Name, r.Index, rowers[r.Index].Name)
+				}
+			}
+		})
+	}
+	if rowers[0].Name != "Charlie" || rowers[3].Name != "Dana" {
+		t.Errorf("sortRowers changed the stored order: %v", rowers)
+	}
+
+	// Rows sort by their band first, so two rowers of the same age in
+	// different bands come apart, and by age within a band.
+	banded := []rower{
+		{Name: "Erin", Age: 44, Band: "C"},
+		{Name: "Frankie", Age: 42, Band: "C"},
+		{Name: "Gray", Age: 42, Band: "B"},
+		{Name: "Harper", Age: 26, Band: ""},
+		{Name: "Indy", Age: 35, Band: "B"},
+	}
+	for dir, want := range map[string][]string{
+		"asc":  {"Harper", "Indy", "Gray", "Frankie", "Erin"},
+		"desc": {"Erin", "Frankie", "Gray", "Indy", "Harper"},
+	} {
+		if got := names(sortRowers(banded, "band", dir)); !slices.Equal(got, want) {
+			t.Errorf("band %s order = %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestValidSort(t *testing.T) {
+	for _, tt := range []struct {
+		by, dir string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "asc", false},
+		{"age", "desc", true},
+		{"band", "", true},
+		{"name", "sideways", false},
+		{"weight", "asc", false},
+	} {
+		if got := validSort(tt.by, tt.dir); got != tt.want {
+			t.Errorf("validSort(%q, %q) = %t, want %t", tt.by, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestFilterRowers(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex", BirthYearOrAge: "44"},
+		rowerInput{Name: "Blake", BirthYearOrAge: "61"},
+		rowerInput{Name: "Casey", BirthYearOrAge: "47"},
+	)
+	s := mustGet(t, b, "crew")
+	names := func(rows []rowerRow) []string {
+		var got []string
+		for _, r := range rows {
+			got = append(got, r.Name)
+		}
+		return got
+	}
+
+	for band, want := range map[string][]string{
+		"":  {"Alex", "Blake", "Casey"},
+		"C": {"Alex", "Casey"},
+		"K": nil,
+	} {
+		if got := names(filterRowers(sortRowers(s.Rowers, "", ""), band)); !slices.Equal(got, want) {
+			t.Errorf("band %q rows = %v, want %v", band, got, want)
+		}
+	}
+	if s.Signals.AverageAge != "50.7" {
+		t.Errorf("AverageAge = %q, want 50.7 for the whole crew", s.Signals.AverageAge)
+	}
+}
+
+func TestNextBand(t *testing.T) {
+	tests := []struct {
+		name  string
+		rower rower
+		want  string
+	}{
+		{name: "mid band", rower: rower{Age: 38}, want: "5 yrs to C"},
+		{name: "a year short", rower: rower{Age: 42}, want: "1 yr to C"},
+		{name: "at a boundary", rower: rower{Age: 43}, want: "7 yrs to D"},
+		{name: "top band", rower: rower{Age: 88}, want: "—"},
+		{name: "date of birth just short", rower: rower{Age: 43, DateOfBirth: "1983-07-01", ExactAge: 42.96}, want: "1 yr to C"},
+		{name: "date of birth just over", rower: rower{Age: 43, DateOfBirth: "1983-06-01", ExactAge: 43.04}, want: "7 yrs to D"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rower.NextBand(); got != tt.want {
+				t.Errorf("NextBand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAveragePrecision(t *testing.T) {
+	tests := []struct {
+		precision int
+		want      string
+	}{
+		{precision: 0, want: "43"},
+		{precision: 1, want: "42.7"},
+		{precision: 2, want: "42.67"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.precision), func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.AveragePrecision = tt.precision
+			b := newTestBusiness(t, cfg)
+			mustCreate(t, b, "crew",
+				rowerInput{Name: "Alex", BirthYearOrAge: "42"},
+				rowerInput{Name: "Blake", BirthYearOrAge: "43"},
+				rowerInput{Name: "Casey", BirthYearOrAge: "43"},
+			)
+			signals := mustGet(t, b, "crew").Signals
+			if signals.AverageAge != tt.want {
+				t.Errorf("AverageAge = %q, want %q", signals.AverageAge, tt.want)
+			}
+			// The band comes from the unrounded 42.67, not the 43 shown.
+			if signals.AverageBand != "B" {
+				t.Errorf("AverageBand = %q, want B", signals.AverageBand)
+			}
+		})
+	}
+}
+
+func TestRoundingMode(t *testing.T) {
+	tests := []struct {
+		mode roundingMode
+		want string
+	}{
+		{mode: roundingNone, want: "B"},
+		{mode: roundingFloor, want: "B"},
+		{mode: roundingRound, want: "C"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.Rounding = tt.mode
+			b := newTestBusiness(t, cfg)
+			// An average of 42.5 sits half a year below band C.
+			mustCreate(t, b, "crew", rowerInput{Name: "A", BirthYearOrAge: "42"}, rowerInput{Name: "B", BirthYearOrAge: "43"})
+
+			if got := mustGet(t, b, "crew").Signals.AverageBand; got != tt.want {
+				t.Errorf("AverageBand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	for _, mode := range []roundingMode{roundingNone, roundingFloor, roundingRound} {
+		if got, err := parseRoundingMode(string(mode)); err != nil || got != mode {
+			t.Errorf("parseRoundingMode(%q) = %q, %v", mode, got, err)
+		}
+	}
+	if _, err := parseRoundingMode("ceil"); err == nil {
+		t.Error("parseRoundingMode accepted ceil")
+	}
+}
+
+func TestParseBandFormat(t *testing.T) {
+	for _, format := range []bandFormat{bandFormatLetter, bandFormatMasters, bandFormatRange} {
+		if got, err := parseBandFormat(string(format)); err != nil || got != format {
+			t.Errorf("parseBandFormat(%q) = %q, %v", format, got, err)
+		}
+	}
+	if _, err := parseBandFormat("roman"); err == nil {
+		t.Error("parseBandFormat accepted roman")
+	}
+}
+
+func TestCreateDuplicateName(t *testing.T) {
+	tests := []struct {
+		policy    duplicateNamePolicy
+		want      error
+		confirmed error
+	}{
+		{policy: duplicateNamesAllow, want: nil, confirmed: nil},
+		{policy: duplicateNamesWarn, want: ErrUnconfirmedDuplicateName, confirmed: nil},
+		{policy: duplicateNamesBlock, want: ErrDuplicateName, confirmed: ErrDuplicateName},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.DuplicateNames = tt.policy
+			b := newTestBusiness(t, cfg)
+			mustCreate(t, b, "crew", rowerInput{Name: "Bob", BirthYearOrAge: "44"})
+
+			// The check ignores case and surrounding whitespace.
+			err := b.Create(context.Background(), "crew", rowerInput{Name: " bob ", BirthYearOrAge: "50"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Create = %v, want %v", err, tt.want)
+			}
+			err = b.Create(context.Background(), "crew", rowerInput{Name: "BOB", BirthYearOrAge: "50", ConfirmDuplicate: true})
+			if !errors.Is(err, tt.confirmed) {
+				t.Errorf("Create confirmed = %v, want %v", err, tt.confirmed)
+			}
+
+			wantRowers := 1
+			if tt.want == nil {
+				wantRowers++
+			}
+			if tt.confirmed == nil {
+				wantRowers++
+			}
+			if n := len(mustGet(t, b, "crew").Rowers); n != wantRowers {
+				t.Errorf("crew has %d rowers, want %d", n, wantRowers)
+			}
+		})
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.MaxAge = 60
+	b := newTestBusiness(t, cfg)
+
+	mustCreate(t, b, "crew", rowerInput{Name: "A", BirthYearOrAge: "60"})
+	err := b.Create(context.Background(), "crew", rowerInput{Name: "B", BirthYearOrAge: "61"})
+	var verr *validationError
+	if !errors.As(err, &verr) || verr.Field != fieldAge {
+		t.Errorf("Create aged 61: %v, want an age field error", err)
+	}
+	// The default maximum accepts the same rower.
+	mustCreate(t, newTestBusiness(t, testBusinessConfig()), "crew", rowerInput{Name: "B", BirthYearOrAge: "61"})
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		example := b.exampleInput(key)
+		var age, born int
+		if _, err := fmt.Sscanf(example, "e.g. %d → born %d", &age, &born); err != nil {
+			t.Fatalf("exampleInput(%q) = %q: %v", key, example, err)
+		}
+		if age > cfg.MaxAge || born != testNow.Year()-age {
+			t.Errorf("exampleInput(%q) = %q, want an age of at most %d", key, example, cfg.MaxAge)
+		}
+	}
+}
+
+// TestExampleInputInValidBand checks that, for every MAX_AGE loadConfig
+// accepts, the example age is one a rower could be entered with, in a band.
+func TestExampleInputInValidBand(t *testing.T) {
+	for maxAge := int(minAge); maxAge <= defaultMaxAge; maxAge++ {
+		cfg, err := loadConfig(testGetenv(map[string]string{"MAX_AGE": strconv.Itoa(maxAge)}))
+		if err != nil {
+			t.Fatalf("loadConfig with MAX_AGE %d: %v", maxAge, err)
+		}
+		b := newTestBusiness(t, cfg.Business)
+		for i := range 20 {
+			key := fmt.Sprintf("session-%d", i)
+			example := b.exampleInput(key)
+			var age, born int
+			if _, err := fmt.Sscanf(example, "e.g. %d → born %d", &age, &born); err != nil {
+				t.Fatalf("MAX_AGE %d: exampleInput(%q) = %q: %v", maxAge, key, example, err)
+			}
+			r, err := b.parseRower(rowerInput{Name: "Example", BirthYearOrAge: signalString(strconv.Itoa(age))})
+			if err != nil {
+				t.Errorf("MAX_AGE %d: example age %d is rejected: %v", maxAge, age, err)
+				continue
+			}
+			if r.Band == "" {
+				t.Errorf("MAX_AGE %d: example age %d is in no band", maxAge, age)
+			}
+		}
+	}
+	if _, err := loadConfig(testGetenv(map[string]string{"MAX_AGE": strconv.Itoa(int(minAge) - 1)})); err == nil {
+		t.Errorf("loadConfig accepted a MAX_AGE below %g, which leaves no example age", minAge)
+	}
+}
+
+func TestCalculateSideBalance(t *testing.T) {
+	tests := []struct {
+		name        string
+		sides       []side
+		wantBalance string
+		wantWarning string
+	}{
+		{name: "empty", sides: nil},
+		{
+			name:        "balanced",
+			sides:       []side{sidePort, sidePort, sideStarboard, sideStarboard},
+			wantBalance: "2 port / 2 starboard / 0 either",
+		},
+		{
+			name:        "balanced with either",
+			sides:       []side{sidePort, sidePort, sideStarboard, sideBoth, ""},
+			wantBalance: "2 port / 1 starboard / 2 either",
+			wantWarning: "Odd number of sweep rowers",
+		},
+		{
+			name:        "too many port",
+			sides:       []side{sidePort, sidePort, sidePort, sideStarboard},
+			wantBalance: "3 port / 1 starboard / 0 either",
+			wantWarning: "Too many port-side rowers: 3 of 2 seats",
+		},
+		{
+			name:        "too many starboard",
+			sides:       []side{sideBoth, sideStarboard, sideStarboard, sideStarboard},
+			wantBalance: "0 port / 3 starboard / 1 either",
+			wantWarning: "Too many starboard-side rowers: 3 of 2 seats",
+		},
+		{
+			name:        "sculling",
+			sides:       []side{sideScull, sideScull},
+			wantBalance: "2 sculling",
+		},
+		{
+			name:        "mixed",
+			sides:       []side{sideScull, sidePort},
+			wantBalance: "1 port / 0 starboard / 0 either",
+			wantWarning: "Crew mixes sweep and sculling rowers",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rowers := make([]rower, len(tt.sides))
+			for i, sd := range tt.sides {
+				rowers[i] = rower{Side: sd}
+			}
+			balance, warning := calculateSideBalance(rowers)
+			if balance != tt.wantBalance || warning != tt.wantWarning {
+				t.Errorf("calculateSideBalance = %q, %q, want %q, %q", balance, warning, tt.wantBalance, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCreateConcurrently(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	const rowers = 50
+
+	var wg sync.WaitGroup
+	for i := range rowers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Create(context.Background(), "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44"}); err != nil {
+				t.Errorf("Create: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := mustGet(t, b, "crew")
+	if len(s.Rowers) != rowers {
+		t.Fatalf("crew has %d rowers, want %d", len(s.Rowers), rowers)
+	}
+	for i := range rowers {
+		name := fmt.Sprintf("Rower %d", i)
+		if !hasRowerNamed(s.Rowers, name) {
+			t.Errorf("%s was lost", name)
+		}
+	}
+}
+
+// slowGetStore delays returning every read, so that concurrent
+// read-modify-writes overlap if they aren't serialized.
+type slowGetStore struct {
+	store
+}
+
+func (s slowGetStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.store.Get(ctx, key)
+	time.Sleep(time.Millisecond)
+	return value, err
+}
+
+func TestMutateConcurrently(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	b.s = slowGetStore{b.s}
+	const writes = 50
+
+	var wg sync.WaitGroup
+	for i := range writes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.mutate(context.Background(), "crew", func(s *state) error {
+				s.Times = append(s.Times, raceTime{Crew: fmt.Sprint(i), Band: "A", Time: time.Minute})
+				return nil
+			})
+			if err != nil {
+				t.Errorf("mutate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := mustGet(t, b, "crew")
+	for i := range writes {
+		if !slices.ContainsFunc(s.Times, func(rt raceTime) bool { return rt.Crew == fmt.Sprint(i) }) {
+			t.Errorf("write %d was lost", i)
+		}
+	}
+	if len(s.Times) != writes {
+		t.Errorf("crew has %d times, want %d", len(s.Times), writes)
+	}
+}
+
+// stalledPutStore blocks every write until its context is done.
+type stalledPutStore struct {
+	store
+}
+
+func (s stalledPutStore) Put(ctx context.Context, key string, value []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMutateWriteTimeout(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.WriteTimeout = 10 * time.Millisecond
+	b := newTestBusiness(t, cfg)
+	b.s = stalledPutStore{b.s}
+
+	// The request's own context is never cancelled, so only the write
+	// deadline can end the write.
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Create(context.Background(), "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Create = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Create did not return once the write deadline passed")
+	}
+}
+
+func TestCreateRacingDelete(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	b.s = slowGetStore{b.s}
+	const crews = 20
+
+	var wg sync.WaitGroup
+	for i := range crews {
+		key := fmt.Sprintf("crew%d", i)
+		mustCreate(t, b, key, rowerInput{Name: "Old", BirthYearOrAge: "44"})
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := b.Delete(ctx, key, 0); err != nil {
+				t.Errorf("Delete: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := b.Create(ctx, key, rowerInput{Name: "New", BirthYearOrAge: "52"}); err != nil {
+				t.Errorf("Create: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Whichever runs first, Old is deleted and New is kept.
+	for i := range crews {
+		s := mustGet(t, b, fmt.Sprintf("crew%d", i))
+		if len(s.Rowers) != 1 || s.Rowers[0].Name != "New" {
+			t.Errorf("crew%d has rowers %v, want only New", i, s.Rowers)
+		}
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	tests := []struct {
+		name        string
+		indices     []int
+		wantDeleted int
+		wantSkipped []int
+		wantNames   []string
+		wantPuts    int32
+	}{
+		{name: "mixed", indices: []int{3, 0, -1, 3, 7, 7}, wantDeleted: 2, wantSkipped: []int{-1, 7}, wantNames: []string{"Blake", "Casey"}, wantPuts: 1},
+		{name: "all", indices: []int{0, 1, 2, 3}, wantDeleted: 4, wantPuts: 1},
+		{name: "none valid", indices: []int{4, -2}, wantSkipped: []int{4, -2}, wantNames: []string{"Alex", "Blake", "Casey", "Dana"}},
+		{name: "empty", wantNames: []string{"Alex", "Blake", "Casey", "Dana"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			mustCreate(t, b, "crew",
+				rowerInput{Name: "Alex", BirthYearOrAge: "44"},
+				rowerInput{Name: "Blake", BirthYearOrAge: "52"},
+				rowerInput{Name: "Casey", BirthYearOrAge: "61"},
+				rowerInput{Name: "Dana", BirthYearOrAge: "47"},
+			)
+			counting := &putCountingStore{store: b.s}
+			b.s = counting
+
+			deleted, skipped, err := b.DeleteMany(context.Background(), "crew", tt.indices)
+			if err != nil {
+				t.Fatalf("DeleteMany: %v", err)
+			}
+			if deleted != tt.wantDeleted || !slices.Equal(skipped, tt.wantSkipped) {
+				t.Errorf("DeleteMany = %d, %v, want %d, %v", deleted, skipped, tt.wantDeleted, tt.wantSkipped)
+			}
+			var names []string
+			for _, r := range mustGet(t, b, "crew").Rowers {
+				names = append(names, r.Name)
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("rowers = %v, want %v", names, tt.wantNames)
+			}
+			if n := counting.puts.Load(); n != tt.wantPuts {
+				t.Errorf("store written %d times, want %d", n, tt.wantPuts)
+			}
+		})
+	}
+}
+
+func TestSetEnteredBand(t *testing.T) {
+	tests := []struct {
+		name        string
+		band        string
+		wantBand    string
+		wantNote    string
+		wantWarning string
+	}{
+		{name: "up", band: "d", wantBand: "D", wantNote: "Computed C, entered as D"},
+		{name: "same", band: "C", wantBand: "C", wantNote: "Computed C, entered as C"},
+		{name: "down", band: "B", wantBand: "B", wantNote: "Computed C, entered as B", wantWarning: "A crew can't enter below its computed category C."},
+		{name: "cleared", band: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"}, rowerInput{Name: "Sam", BirthYearOrAge: "46"})
+			if err := b.SetEnteredBand(context.Background(), "crew", "K"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.SetEnteredBand(context.Background(), "crew", tt.band); err != nil {
+				t.Fatalf("SetEnteredBand: %v", err)
+			}
+
+			s := mustGet(t, b, "crew")
+			if s.EnteredBand != tt.wantBand || s.Signals.EnteredBand != tt.wantBand {
+				t.Errorf("EnteredBand = %q, signal %q, want %q", s.EnteredBand, s.Signals.EnteredBand, tt.wantBand)
+			}
+			if s.Signals.EnteredBandNote != tt.wantNote || s.Signals.EnteredBandWarning != tt.wantWarning {
+				t.Errorf("note, warning = %q, %q, want %q, %q", s.Signals.EnteredBandNote, s.Signals.EnteredBandWarning, tt.wantNote, tt.wantWarning)
+			}
+			// The override is shown beside the computed category, not in place
+			// of it.
+			if s.Signals.AverageBand != "C" {
+				t.Errorf("AverageBand = %q, want C", s.Signals.AverageBand)
+			}
+		})
+	}
+}
+
+func TestSetEnteredBandUnknown(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	if err := b.SetEnteredBand(context.Background(), "crew", "Z"); err == nil {
+		t.Error("SetEnteredBand with an unknown band succeeded")
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"}, rowerInput{Name: "Sam", BirthYearOrAge: "52"})
+	if err := b.SetCrewName(ctx, "crew", "Thames Masters 2x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetEnteredBand(ctx, "crew", "D"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetTooYoungPolicy(ctx, "crew", string(tooYoungListExcluded)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddTime(ctx, "crew", raceTimeInput{Crew: "Thames", Time: "7:30"}); err != nil {
+		t.Fatal(err)
+	}
+	archived := mustGet(t, b, "crew")
+
+	first, err := b.Archive(ctx, "crew")
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	if err := b.SetCrewName(ctx, "crew", "Renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetEnteredBand(ctx, "crew", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetTooYoungPolicy(ctx, "crew", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteTime(ctx, "crew", 0); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, b, "crew", rowerInput{Name: "Jo", BirthYearOrAge: "61"})
+
+	b.now = func() time.Time { return testNow.Add(time.Minute) }
+	second, err := b.Archive(ctx, "crew")
+	if err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+	// Another session's archive must not be listed.
+	mustCreate(t, b, "other", rowerInput{Name: "Kim", BirthYearOrAge: "40"})
+	if _, err := b.Archive(ctx, "other"); err != nil {
+		t.Fatalf("Archive: %v", err)
+	}
+
+	crews, err := b.Archives(ctx, "crew")
+	if err != nil {
+		t.Fatalf("Archives: %v", err)
+	}
+	want := []archivedCrew{
+		{ID: second, ArchivedAt: testNow.Add(time.Minute), CrewName: "Renamed", Rowers: 3},
+		{ID: first, ArchivedAt: testNow, CrewName: "Thames Masters 2x", Rowers: 2},
+	}
+	if !slices.Equal(crews, want) {
+		t.Errorf("Archives = %+v, want %+v", crews, want)
+	}
+
+	if err := b.Restore(ctx, "crew", first); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	restored := mustGet(t, b, "crew")
+	if len(restored.Rowers) != 2 || restored.Rowers[0].Name != "Alex" || restored.Rowers[1].Name != "Sam" {
+		t.Errorf("restored rowers = %+v, want Alex and Sam", restored.Rowers)
+	}
+	if restored.CrewName != archived.CrewName || restored.EnteredBand != archived.EnteredBand || restored.TooYoungPolicy != archived.TooYoungPolicy {
+		t.Errorf("restored crew = %q, %q, %q, want %q, %q, %q",
+			restored.CrewName, restored.EnteredBand, restored.TooYoungPolicy,
+			archived.CrewName, archived.EnteredBand, archived.TooYoungPolicy)
+	}
+	if !slices.Equal(restored.Times, archived.Times) {
+		t.Errorf("restored times = %+v, want %+v", restored.Times, archived.Times)
+	}
+	if restored.Signals.CrewName != "Thames Masters 2x" || restored.Signals.EnteredBand != "D" {
+		t.Errorf("restored signals = %+v, want them recomputed for the restored crew", restored.Signals)
+	}
+
+	if err := b.Restore(ctx, "crew", "12345"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Restore of a missing archive = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestCreateNameLength(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	// The limit counts characters, not bytes.
+	mustCreate(t, b, "crew", rowerInput{Name: strings.Repeat("é", maxNameLength), BirthYearOrAge: "44"})
+
+	err := b.Create(context.Background(), "crew", rowerInput{Name: strings.Repeat("x", maxNameLength+1), BirthYearOrAge: "44"})
+	var verr *validationError
+	if !errors.As(err, &verr) || verr.Field != fieldName {
+		t.Errorf("Create with a long name: %v, want a name field error", err)
+	}
+}
+
+func TestCreateDateOfBirthNearBoundary(t *testing.T) {
+	tests := []struct {
+		name     string
+		basis    ageBasis
+		in       rowerInput
+		wantBand string
+	}{
+		// testNow is 15 June 2026, so these rowers turn 43 around then.
+		{name: "birth year", basis: ageBasisToday, in: rowerInput{BirthYearOrAge: "1983"}, wantBand: "C"},
+		{name: "days before the birthday", basis: ageBasisToday, in: rowerInput{DateOfBirth: "1983-06-20"}, wantBand: "B"},
+		{name: "days after the birthday", basis: ageBasisToday, in: rowerInput{DateOfBirth: "1983-06-10"}, wantBand: "C"},
+		{name: "on the birthday", basis: ageBasisToday, in: rowerInput{DateOfBirth: "1983-06-15"}, wantBand: "C"},
+		{name: "year end basis", basis: ageBasisYearEnd, in: rowerInput{DateOfBirth: "1983-06-20"}, wantBand: "C"},
+		// A rower born late in the year is a year younger today than the age
+		// they reach during it.
+		{name: "late birthday today", basis: ageBasisToday, in: rowerInput{DateOfBirth: "1983-12-20"}, wantBand: "B"},
+		{name: "late birthday year end", basis: ageBasisYearEnd, in: rowerInput{DateOfBirth: "1983-12-20"}, wantBand: "C"},
+		{name: "birth year year end", basis: ageBasisYearEnd, in: rowerInput{BirthYearOrAge: "1983"}, wantBand: "C"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.AgeBasis = tt.basis
+			b := newTestBusiness(t, cfg)
+			tt.in.Name = "Alex"
+			mustCreate(t, b, "crew", tt.in)
+
+			s := mustGet(t, b, "crew")
+			if got := s.Rowers[0].Band; got != tt.wantBand {
+				t.Errorf("Band = %q, want %q", got, tt.wantBand)
+			}
+			if got := s.Signals.AverageBand; got != tt.wantBand {
+				t.Errorf("AverageBand = %q, want %q", got, tt.wantBand)
+			}
+		})
+	}
+}
+
+func TestAverageOfExactAges(t *testing.T) {
+	tests := []struct {
+		name     string
+		basis    ageBasis
+		dobs     []string
+		wantBand string
+	}{
+		// Aged 43.96 and 42.96 at testNow: whole years would average 42.5, in B.
+		{name: "today", basis: ageBasisToday, dobs: []string{"1982-07-01", "1983-07-01"}, wantBand: "C"},
+		// Both reach 43 this year, though each is 42.5 today.
+		{name: "late birthdays today", basis: ageBasisToday, dobs: []string{"1983-12-20", "1983-12-20"}, wantBand: "B"},
+		{name: "late birthdays year end", basis: ageBasisYearEnd, dobs: []string{"1983-12-20", "1983-12-20"}, wantBand: "C"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.AgeBasis = tt.basis
+			b := newTestBusiness(t, cfg)
+			var ins []rowerInput
+			for i, dob := range tt.dobs {
+				ins = append(ins, rowerInput{Name: fmt.Sprintf("Rower %d", i), DateOfBirth: dob})
+			}
+			mustCreate(t, b, "crew", ins...)
+			if got := mustGet(t, b, "crew").Signals.AverageBand; got != tt.wantBand {
+				t.Errorf("AverageBand = %q, want %q", got, tt.wantBand)
+			}
+		})
+	}
+}
+
+func TestPreciseAge(t *testing.T) {
+	dob := time.Date(1983, time.June, 20, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now  time.Time
+		want float64
+	}{
+		{now: time.Date(2026, time.June, 20, 0, 0, 0, 0, time.UTC), want: 43},
+		{now: time.Date(2026, time.June, 19, 0, 0, 0, 0, time.UTC), want: 43 - 1.0/365},
+		{now: time.Date(2026, time.December, 20, 0, 0, 0, 0, time.UTC), want: 43 + 183.0/365},
+	}
+	for _, tt := range tests {
+		if got := preciseAge(dob, tt.now); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("preciseAge(%s) = %v, want %v", tt.now.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
+
+func TestTooYoungMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "default", template: "", want: "Kit aged 20 is too young for a masters category"},
+		{
+			name:     "custom",
+			template: "Sorry {{.Name}}, at {{.Age}} you are under {{.MinAge}}. See https://example.org/juniors",
+			want:     "Sorry Kit, at 20 you are under 27. See https://example.org/juniors",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testBusinessConfig()
+			if tt.template != "" {
+				tmpl, err := parseTooYoungMessage(tt.template)
+				if err != nil {
+					t.Fatalf("parseTooYoungMessage: %v", err)
+				}
+				cfg.TooYoungMessage = tmpl
+			}
+			b := newTestBusiness(t, cfg)
+
+			err := b.Create(context.Background(), "crew", rowerInput{Name: "Kit", BirthYearOrAge: "20"})
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Create = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTooYoungMessageRejectsUnknownFields(t *testing.T) {
+	for _, text := range []string{"{{.Club}} is too young", "{{.Name"} {
+		if _, err := parseTooYoungMessage(text); err == nil {
+			t.Errorf("parseTooYoungMessage accepted %q", text)
+		}
+	}
+}
+
+func TestTooYoungPolicies(t *testing.T) {
+	tests := []struct {
+		policy      tooYoungPolicy
+		wantRowers  int
+		wantAverage string
+	}{
+		{policy: tooYoungReject, wantRowers: 1, wantAverage: "44.0"},
+		{policy: tooYoungListExcluded, wantRowers: 2, wantAverage: "44.0"},
+		{policy: tooYoungListIncluded, wantRowers: 2, wantAverage: "32.0"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			b := newTestBusiness(t, testBusinessConfig())
+			if err := b.SetTooYoungPolicy(ctx, "crew", string(tt.policy)); err != nil {
+				t.Fatalf("SetTooYoungPolicy: %v", err)
+			}
+			mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+			err := b.Create(ctx, "crew", rowerInput{Name: "Sam", BirthYearOrAge: "20"})
+			var verr *validationError
+			if tt.policy == tooYoungReject {
+				if !errors.As(err, &verr) || verr.Field != fieldAge {
+					t.Errorf("Create of a rower aged 20 = %v, want an age validation error", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Create of a rower aged 20: %v", err)
+			}
+
+			s := mustGet(t, b, "crew")
+			if len(s.Rowers) != tt.wantRowers {
+				t.Fatalf("crew has %d rowers, want %d", len(s.Rowers), tt.wantRowers)
+			}
+			if tt.wantRowers == 2 && s.Rowers[1].Band != "" {
+				t.Errorf("rower aged 20 in band %q, want none", s.Rowers[1].Band)
+			}
+			if s.Signals.AverageAge != tt.wantAverage {
+				t.Errorf("AverageAge = %q, want %q", s.Signals.AverageAge, tt.wantAverage)
+			}
+		})
+	}
+}
+
+func TestExampleInput(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+
+	seen := map[string]bool{}
+	for i := range 50 {
+		key := fmt.Sprintf("session-%d", i)
+		example := b.exampleInput(key)
+		if again := b.exampleInput(key); again != example {
+			t.Errorf("exampleInput(%q) = %q then %q, want it stable", key, example, again)
+		}
+
+		var age, born int
+		if _, err := fmt.Sscanf(example, "e.g. %d → born %d", &age, &born); err != nil {
+			t.Fatalf("exampleInput(%q) = %q: %v", key, example, err)
+		}
+		if born != 2026-age {
+			t.Errorf("exampleInput(%q) = %q, want the birth year in 2026", key, example)
+		}
+		if calculateBand(float64(age)) == calculateBand(float64(age-1)) {
+			t.Errorf("exampleInput(%q) = %q, want the first age of a band", key, example)
+		}
+		seen[example] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("50 sessions all got the example %v, want it to vary between sessions", seen)
+	}
+}
+
+func TestClone(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex", BirthYearOrAge: "44", Side: "port"},
+		rowerInput{Name: "Sam", BirthYearOrAge: "52", Side: "starboard", Club: "Tideway"},
+	)
+
+	if err := b.Clone(context.Background(), "crew", 1); err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	s := mustGet(t, b, "crew")
+	if len(s.Rowers) != 3 {
+		t.Fatalf("crew has %d rowers, want 3", len(s.Rowers))
+	}
+	want := s.Rowers[1]
+	want.Name = "Sam (copy)"
+	if s.Rowers[2] != want {
+		t.Errorf("clone = %+v, want %+v", s.Rowers[2], want)
+	}
+	if s.Rowers[1].Name != "Sam" {
+		t.Errorf("original renamed to %q", s.Rowers[1].Name)
+	}
+
+	for _, index := range []int{-1, 3} {
+		if err := b.Clone(context.Background(), "crew", index); !errors.Is(err, ErrRowerNotFound) {
+			t.Errorf("Clone(%d) = %v, want ErrRowerNotFound", index, err)
+		}
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	if got := copyName("Sam"); got != "Sam (copy)" {
+		t.Errorf("copyName = %q, want Sam (copy)", got)
+	}
+	long := strings.Repeat("é", maxNameLength)
+	if got := copyName(long); utf8.RuneCountInString(got) != maxNameLength || !strings.HasSuffix(got, " (copy)") {
+		t.Errorf("copyName of a %d character name = %q, want it cut to fit", maxNameLength, got)
+	}
+}
+
+func TestCreateFieldErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    rowerInput
+		field string
+	}{
+		{name: "missing name", in: rowerInput{Name: "  ", BirthYearOrAge: "44"}, field: fieldName},
+		{name: "long name", in: rowerInput{Name: strings.Repeat("x", maxNameLength+1), BirthYearOrAge: "44"}, field: fieldName},
+		{name: "missing age", in: rowerInput{Name: "Alex"}, field: fieldAge},
+		{name: "age not a number", in: rowerInput{Name: "Alex", BirthYearOrAge: "forty"}, field: fieldAge},
+		{name: "age not positive", in: rowerInput{Name: "Alex", BirthYearOrAge: "-4"}, field: fieldAge},
+		{name: "too young", in: rowerInput{Name: "Alex", BirthYearOrAge: "20"}, field: fieldAge},
+		{name: "too old", in: rowerInput{Name: "Alex", BirthYearOrAge: "120"}, field: fieldAge},
+		{name: "bad date of birth", in: rowerInput{Name: "Alex", DateOfBirth: "1980-13-01"}, field: fieldAge},
+		{name: "weight not a number", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", Weight: "heavy"}, field: fieldWeight},
+		{name: "long notes", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", Notes: strings.Repeat("x", maxNotesLength+1)}, field: fieldNotes},
+		{name: "long club", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", Club: strings.Repeat("x", maxClubLength+1)}, field: fieldClub},
+		{name: "bad avatar", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", AvatarURL: "javascript:alert(1)"}, field: fieldAvatar},
+		{name: "relative avatar", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", AvatarURL: "/img/alex.png"}, field: fieldAvatar},
+		{name: "long avatar", in: rowerInput{Name: "Alex", BirthYearOrAge: "44", AvatarURL: "https://example.org/" + strings.Repeat("x", maxAvatarURLLength)}, field: fieldAvatar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			err := tt.in.validateSignals()
+			if err == nil {
+				err = b.Create(context.Background(), "crew", tt.in)
+			}
+			var verr *validationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("error = %v, want a validation error", err)
+			}
+			if verr.Field != tt.field {
+				t.Errorf("field = %q, want %q: %v", verr.Field, tt.field, verr)
+			}
+		})
+	}
+}
+
+func TestBandOutputsInBandOrder(t *testing.T) {
+	var want []string
+	for _, ageBand := range ageBands {
+		want = append(want, ageBand.Band)
+	}
+	if !slices.IsSorted(want) {
+		t.Fatalf("ageBands are not in band order: %v", want)
+	}
+
+	b := newTestBusiness(t, testBusinessConfig())
+	// Per-band output is built from the ageBands slice rather than a map, so
+	// it comes out in the same order on every run.
+	for range 20 {
+		var bands, ranges []string
+		for _, band := range b.Bands() {
+			bands = append(bands, band.Band)
+		}
+		for _, r := range bandRanges() {
+			ranges = append(ranges, r.Band)
+		}
+		if !slices.Equal(bands, want) || !slices.Equal(ranges, want) {
+			t.Fatalf("Bands = %v, bandRanges = %v, want %v", bands, ranges, want)
+		}
+	}
+}
+
+func TestBandFormatLabel(t *testing.T) {
+	tests := []struct {
+		format bandFormat
+		band   string
+		want   string
+	}{
+		{format: bandFormatLetter, band: "C", want: "C"},
+		{format: bandFormatMasters, band: "C", want: "Masters C"},
+		{format: bandFormatRange, band: "A", want: "A (27-35)"},
+		{format: bandFormatRange, band: "C", want: "C (43-49)"},
+		{format: bandFormatRange, band: "K", want: "K (85+)"},
+		{format: bandFormatMasters, band: "", want: ""},
+		{format: bandFormatRange, band: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.format.label(tt.band); got != tt.want {
+			t.Errorf("%s label(%q) = %q, want %q", tt.format, tt.band, got, tt.want)
+		}
+	}
+}
+
+func TestBandFormatSignals(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.BandFormat = bandFormatRange
+	b := newTestBusiness(t, cfg)
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+	s := mustGet(t, b, "crew")
+	if s.Signals.AverageBand != "C" || s.Signals.AverageBandLabel != "C (43-49)" {
+		t.Errorf("AverageBand, AverageBandLabel = %q, %q, want C, C (43-49)", s.Signals.AverageBand, s.Signals.AverageBandLabel)
+	}
+}
+
+func TestCompositeClubs(t *testing.T) {
+	tests := []struct {
+		name  string
+		clubs []string
+		want  string
+	}{
+		{name: "single club", clubs: []string{"Tideway", "Tideway"}, want: ""},
+		{name: "single club in any case", clubs: []string{"Tideway", "tideway"}, want: ""},
+		{name: "club unknown for some", clubs: []string{"Tideway", ""}, want: ""},
+		{name: "no clubs", clubs: []string{"", ""}, want: ""},
+		{name: "composite", clubs: []string{"Tideway", "Thames", "tideway", "Molesey"}, want: "Tideway, Thames, Molesey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			for i, club := range tt.clubs {
+				mustCreate(t, b, "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44", Club: club})
+			}
+			if got := mustGet(t, b, "crew").Signals.CompositeClubs; got != tt.want {
+				t.Errorf("CompositeClubs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewMatchesCreate(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.CompositeRule = compositeDowngrade
+	crew := []rowerInput{
+		{Name: "Alex", BirthYearOrAge: "44", Club: "Tideway", Side: "port"},
+		{Name: "Blake", BirthYearOrAge: "52", Club: "Tideway", Side: "port"},
+	}
+	for _, candidate := range []rowerInput{
+		{Name: "Sam", BirthYearOrAge: "72", Club: "Tideway", Side: "starboard"},
+		{Name: "Jo", BirthYearOrAge: "38", Club: "Thames"},
+		{Name: "Kim", BirthYearOrAge: "1960", Club: "Tideway", Weight: "70"},
+	} {
+		t.Run(candidate.Name, func(t *testing.T) {
+			b := newTestBusiness(t, cfg)
+			mustCreate(t, b, "crew", crew...)
+			s := mustGet(t, b, "crew")
+
+			preview, err := b.Preview(s, candidate)
+			if err != nil {
+				t.Fatalf("Preview: %v", err)
+			}
+			if len(s.Rowers) != len(crew) {
+				t.Errorf("Preview changed the crew to %d rowers", len(s.Rowers))
+			}
+			if n := len(mustGet(t, b, "crew").Rowers); n != len(crew) {
+				t.Errorf("Preview saved the crew with %d rowers", n)
+			}
+
+			mustCreate(t, b, "crew", candidate)
+			added := mustGet(t, b, "crew")
+			if want := b.compute(added); !reflect.DeepEqual(preview, want) {
+				t.Errorf("Preview = %+v, want the crew after adding %s %+v", preview, candidate.Name, want)
+			}
+		})
+	}
+}
+
+func TestCompositeRule(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       compositeRule
+		clubs      []string
+		wantBand   string
+		wantReason string
+	}{
+		{name: "single club, average", rule: compositeAverage, clubs: []string{"Tideway", "Tideway"}, wantBand: "C"},
+		{name: "single club, youngest", rule: compositeYoungest, clubs: []string{"Tideway", "Tideway"}, wantBand: "C"},
+		{name: "single club, downgrade", rule: compositeDowngrade, clubs: []string{"Tideway", "Tideway"}, wantBand: "C"},
+		{name: "composite, average", rule: compositeAverage, clubs: []string{"Tideway", "Thames"}, wantBand: "C"},
+		{name: "composite, youngest", rule: compositeYoungest, clubs: []string{"Tideway", "Thames"}, wantBand: "B", wantReason: "from the youngest rower"},
+		{name: "composite, downgrade", rule: compositeDowngrade, clubs: []string{"Tideway", "Thames"}, wantBand: "B", wantReason: "one younger than the average age"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testBusinessConfig()
+			cfg.CompositeRule = tt.rule
+			b := newTestBusiness(t, cfg)
+			// Averaging 45 puts the crew in C; the youngest alone is a B.
+			mustCreate(t, b, "crew",
+				rowerInput{Name: "Young", BirthYearOrAge: "38", Club: tt.clubs[0]},
+				rowerInput{Name: "Old", BirthYearOrAge: "52", Club: tt.clubs[1]},
+			)
+			signals := mustGet(t, b, "crew").Signals
+			if signals.AverageBand != tt.wantBand {
+				t.Errorf("AverageBand = %q, want %q", signals.AverageBand, tt.wantBand)
+			}
+			if signals.CompositeRule != tt.wantReason {
+				t.Errorf("CompositeRule = %q, want %q", signals.CompositeRule, tt.wantReason)
+			}
+		})
+	}
+}
+
+// benchmarkCrew returns a stored crew of eight rowers.
+func benchmarkCrew(b *testing.B, bus *business) *state {
+	b.Helper()
+	for i := range 8 {
+		mustCreate(b, bus, "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: signalString(strconv.Itoa(30 + 7*i)), Weight: "72.5", Club: "Tideway"})
+	}
+	return mustGet(b, bus, "crew")
+}
+
+func BenchmarkUpdateSignals(b *testing.B) {
+	bus := newTestBusiness(b, testBusinessConfig())
+	s := benchmarkCrew(b, bus)
+	for b.Loop() {
+		bus.updateSignals("crew", s)
+	}
+}
+
+func BenchmarkCalculateBand(b *testing.B) {
+	for b.Loop() {
+		for age := 20.0; age < 100; age++ {
+			calculateBand(age)
+		}
+	}
+}
+
+func BenchmarkStateJSON(b *testing.B) {
+	s := benchmarkCrew(b, newTestBusiness(b, testBusinessConfig()))
+	data, err := json.Marshal(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("marshal", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := json.Marshal(s); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unmarshal", func(b *testing.B) {
+		for b.Loop() {
+			if err := json.Unmarshal(data, &state{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestAgeBands checks the invariants calculateBand relies on, which a loader
+// would have to validate if the bands were ever configurable.
+func TestAgeBands(t *testing.T) {
+	seen := map[string]bool{}
+	for i, ageBand := range ageBands {
+		if ageBand.Band == "" {
+			t.Errorf("band %d has no label", i)
+		}
+		if seen[ageBand.Band] {
+			t.Errorf("band %s is listed twice", ageBand.Band)
+		}
+		seen[ageBand.Band] = true
+		if i > 0 && ageBand.MinAge <= ageBands[i-1].MinAge {
+			t.Errorf("band %s starts at %g, not after band %s at %g", ageBand.Band, ageBand.MinAge, ageBands[i-1].Band, ageBands[i-1].MinAge)
+		}
+
+		if got := calculateBand(ageBand.MinAge); got != ageBand.Band {
+			t.Errorf("calculateBand(%g) = %q, want %q", ageBand.MinAge, got, ageBand.Band)
+		}
+		if i > 0 {
+			if got := calculateBand(ageBand.MinAge - 0.5); got != ageBands[i-1].Band {
+				t.Errorf("calculateBand(%g) = %q, want %q", ageBand.MinAge-0.5, got, ageBands[i-1].Band)
+			}
+		}
+	}
+	if got := calculateBand(minAge - 1); got != "" {
+		t.Errorf("calculateBand(%g) = %q, want no band", minAge-1, got)
+	}
+}
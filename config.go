@@ -0,0 +1,727 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// Config is the server's configuration, read by loadConfig.
+type Config struct {
+	Port            string
+	LogFile         string
+	LogFileMaxBytes int64
+
+	// SessionKey signs the session cookies. EphemeralSessionKey reports that it
+	// was generated because DEV_MODE is on and no SESSION_SECRET was given.
+	SessionKey          []byte
+	EphemeralSessionKey bool
+
+	// SessionMaxAge is how long the session cookie lasts. It may outlive the
+	// stored crew, StateTTL, in which case the session starts with an empty
+	// crew again.
+	SessionMaxAge time.Duration
+	StateTTL      time.Duration
+
+	// SessionBackend is where session data is kept: "cookie" in the cookie
+	// itself, or "nats" server-side in SessionBucket with only the ID in the
+	// cookie.
+	SessionBackend string
+	SessionBucket  string
+
+	GzipLevel      int
+	TrustedProxies []netip.Prefix
+	H2C            bool
+	AppName        string
+	RootRedirect   string
+
+	StoreBackend       string
+	ArchiveTTL         time.Duration
+	Namespace          string
+	KVBucket           string
+	KVDescription      string
+	KVMaxBytes         int64
+	ArchiveBucket      string
+	AuditBucket        string
+	NATSDir            string
+	NATSStartupTimeout time.Duration
+	RedisURL           string
+
+	// JSStorage is where the JetStream key-value buckets keep their data:
+	// "file" for durability or "memory" for speed in ephemeral deployments.
+	JSStorage string
+
+	// EventsSubject is the NATS subject change events are published on. Events
+	// are not published when it is empty.
+	EventsSubject string
+
+	// StoreRetryAttempts is how many times a store operation is tried before
+	// its error is returned, and StoreRetryBackoff the most the first retry
+	// waits. Each further retry may wait twice as long.
+	StoreRetryAttempts int
+	StoreRetryBackoff  time.Duration
+
+	// WatchSetupRate limits how many watches start per second, to smooth out
+	// reconnect storms; zero is unlimited. WatchSetupBurst watches may start
+	// at once before the limit applies.
+	WatchSetupRate  float64
+	WatchSetupBurst int
+
+	YearRolloverRecalc bool
+
+	// ShutdownTimeout bounds how long open requests get to finish when the
+	// server is stopped.
+	ShutdownTimeout time.Duration
+
+	// RequestTimeout is the deadline for each request other than the crew
+	// streams.
+	RequestTimeout time.Duration
+
+	// PprofAddr is the address the profiling endpoints listen on, or empty
+	// when profiling is off.
+	PprofAddr string
+
+	// AdminToken guards the debug endpoints, which are off when it is empty.
+	AdminToken string
+
+	// ErrorPage renders the HTML error page shown to browsers.
+	ErrorPage *template.Template
+
+	Business    businessConfig
+	Application applicationConfig
+}
+
+// loadConfig reads the configuration from getenv, falling back to the file
+// named by CONFIG_FILE, applying defaults and validating every value.
+func loadConfig(getenv func(string) string) (Config, error) {
+	getenv, err := withConfigFile(getenv)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{
+		Port:               "8080",
+		SessionMaxAge:      30 * 24 * time.Hour,
+		SessionBackend:     "cookie",
+		StateTTL:           time.Hour,
+		GzipLevel:          gzip.DefaultCompression,
+		AppName:            defaultAppName,
+		RootRedirect:       "/masterscalc",
+		StoreBackend:       "nats",
+		ArchiveTTL:         30 * 24 * time.Hour,
+		KVBucket:           "rowingdata",
+		KVDescription:      "Masters Rowing Data",
+		KVMaxBytes:         16 * 1024 * 1024,
+		NATSDir:            filepath.Join(os.TempDir(), "webserver"),
+		NATSStartupTimeout: 30 * time.Second,
+		ShutdownTimeout:    10 * time.Second,
+		RequestTimeout:     30 * time.Second,
+		StoreRetryAttempts: 3,
+		StoreRetryBackoff:  50 * time.Millisecond,
+		WatchSetupBurst:    20,
+		Business: businessConfig{
+			Rounding:         roundingNone,
+			AgeBasis:         ageBasisToday,
+			DuplicateNames:   duplicateNamesWarn,
+			TooYoungPolicy:   tooYoungReject,
+			MaxAge:           defaultMaxAge,
+			BandFormat:       bandFormatLetter,
+			CompositeRule:    compositeAverage,
+			AveragePrecision: 1,
+			Handicaps:        defaultHandicaps,
+			AuditMaxEntries:  defaultAuditMaxEntries,
+			BoatClasses:      defaultBoatClasses,
+		},
+		Application: applicationConfig{
+			SessionName:     "mc_session",
+			ExportFields:    defaultExportFields,
+			MaxWatchers:     defaultMaxWatchers,
+			WatcherMaxStall: defaultWatcherMaxStall,
+		},
+	}
+
+	if v := getenv("PORT"); v != "" {
+		cfg.Port = v
+	}
+
+	cfg.LogFile = getenv("LOG_FILE")
+	if v := getenv("LOG_FILE_MAX_BYTES"); v != "" {
+		cfg.LogFileMaxBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LOG_FILE_MAX_BYTES: %w", err)
+		}
+		if cfg.LogFileMaxBytes < 0 {
+			return Config{}, fmt.Errorf("invalid LOG_FILE_MAX_BYTES: %d must not be negative", cfg.LogFileMaxBytes)
+		}
+	}
+
+	sessionSecret := getenv("SESSION_SECRET")
+	if sessionSecret == "" {
+		if getenv("DEV_MODE") != "true" {
+			return Config{}, fmt.Errorf("SESSION_SECRET environment variable is required")
+		}
+		// Sessions signed with this key do not survive a restart, which is
+		// fine for local development but never for production.
+		cfg.SessionKey = securecookie.GenerateRandomKey(32)
+		cfg.EphemeralSessionKey = true
+	} else {
+		cfg.SessionKey, err = base64.StdEncoding.DecodeString(sessionSecret)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not decode SESSION_SECRET: %w", err)
+		}
+	}
+
+	if v := getenv("SESSION_COOKIE_NAME"); v != "" {
+		cfg.Application.SessionName = v
+	}
+
+	if v := getenv("SESSION_MAX_AGE"); v != "" {
+		cfg.SessionMaxAge, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SESSION_MAX_AGE: %w", err)
+		}
+		if cfg.SessionMaxAge < time.Second {
+			return Config{}, fmt.Errorf("invalid SESSION_MAX_AGE: %s must be at least 1s", cfg.SessionMaxAge)
+		}
+	}
+
+	if v := getenv("STATE_TTL"); v != "" {
+		cfg.StateTTL, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid STATE_TTL: %w", err)
+		}
+		if cfg.StateTTL < time.Second {
+			return Config{}, fmt.Errorf("invalid STATE_TTL: %s must be at least 1s", cfg.StateTTL)
+		}
+	}
+
+	if getenv("TTL_REFRESH_ON_READ") == "true" {
+		// A quarter of the TTL leaves room for a missed refresh or two.
+		cfg.Business.TTLRefresh = cfg.StateTTL / 4
+	}
+
+	if v := getenv("GZIP_LEVEL"); v != "" {
+		cfg.GzipLevel, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid GZIP_LEVEL: %w", err)
+		}
+		if cfg.GzipLevel < gzip.HuffmanOnly || cfg.GzipLevel > gzip.BestCompression {
+			return Config{}, fmt.Errorf("invalid GZIP_LEVEL: %d must be between %d and %d", cfg.GzipLevel, gzip.HuffmanOnly, gzip.BestCompression)
+		}
+	}
+
+	cfg.TrustedProxies, err = parseTrustedProxies(getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	cfg.H2C = getenv("H2C") == "true"
+
+	if v := getenv("APP_NAME"); v != "" {
+		cfg.AppName = v
+	}
+
+	cfg.Application.SiteName = cfg.AppName
+
+	cfg.Application.Announcement = strings.TrimSpace(getenv("ANNOUNCEMENT"))
+
+	cfg.Application.DemoMode = getenv("DEMO_MODE") == "true"
+
+	cfg.Application.CORSOrigins, err = parseCORSOrigins(getenv("CORS_ORIGINS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid CORS_ORIGINS: %w", err)
+	}
+
+	if v := getenv("ROOT_REDIRECT"); v != "" {
+		cfg.RootRedirect = v
+	}
+	if cfg.RootRedirect != "none" && (!strings.HasPrefix(cfg.RootRedirect, "/") || strings.HasPrefix(cfg.RootRedirect, "//") || cfg.RootRedirect == "/") {
+		return Config{}, fmt.Errorf("invalid ROOT_REDIRECT %q: must be a path other than / on this server, or none", cfg.RootRedirect)
+	}
+
+	if v := getenv("STORE_BACKEND"); v != "" {
+		cfg.StoreBackend = v
+	}
+
+	if v := getenv("ARCHIVE_TTL"); v != "" {
+		cfg.ArchiveTTL, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ARCHIVE_TTL: %w", err)
+		}
+		if cfg.ArchiveTTL <= 0 {
+			return Config{}, fmt.Errorf("invalid ARCHIVE_TTL: %s must be positive", cfg.ArchiveTTL)
+		}
+	}
+
+	switch cfg.StoreBackend {
+	case "nats":
+		if v := getenv("KV_BUCKET"); v != "" {
+			cfg.KVBucket = v
+		}
+		if !validBucketName(cfg.KVBucket) {
+			return Config{}, fmt.Errorf("invalid KV_BUCKET %q: only letters, digits, '-' and '_' are allowed", cfg.KVBucket)
+		}
+
+		if v := getenv("KV_DESCRIPTION"); v != "" {
+			cfg.KVDescription = v
+		}
+
+		if v := getenv("KV_MAX_BYTES"); v != "" {
+			cfg.KVMaxBytes, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid KV_MAX_BYTES: %w", err)
+			}
+			if cfg.KVMaxBytes < 1 {
+				return Config{}, fmt.Errorf("invalid KV_MAX_BYTES: %d must be at least 1", cfg.KVMaxBytes)
+			}
+		}
+
+		cfg.ArchiveBucket = getenv("ARCHIVE_BUCKET")
+		if cfg.ArchiveBucket == "" {
+			cfg.ArchiveBucket = cfg.KVBucket + "-archive"
+		}
+		if !validBucketName(cfg.ArchiveBucket) {
+			return Config{}, fmt.Errorf("invalid ARCHIVE_BUCKET %q: only letters, digits, '-' and '_' are allowed", cfg.ArchiveBucket)
+		}
+
+		cfg.AuditBucket = getenv("AUDIT_BUCKET")
+		if cfg.AuditBucket == "" {
+			cfg.AuditBucket = cfg.KVBucket + "-audit"
+		}
+		if !validBucketName(cfg.AuditBucket) {
+			return Config{}, fmt.Errorf("invalid AUDIT_BUCKET %q: only letters, digits, '-' and '_' are allowed", cfg.AuditBucket)
+		}
+
+		cfg.JSStorage = cmp.Or(getenv("JS_STORAGE"), "file")
+		if cfg.JSStorage != "file" && cfg.JSStorage != "memory" {
+			return Config{}, fmt.Errorf("invalid JS_STORAGE %q: must be file or memory", cfg.JSStorage)
+		}
+
+		if v := getenv("NATS_DIR"); v != "" {
+			cfg.NATSDir = v
+		}
+
+		if v := getenv("NATS_STARTUP_TIMEOUT"); v != "" {
+			cfg.NATSStartupTimeout, err = time.ParseDuration(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid NATS_STARTUP_TIMEOUT: %w", err)
+			}
+			if cfg.NATSStartupTimeout <= 0 {
+				return Config{}, fmt.Errorf("invalid NATS_STARTUP_TIMEOUT: %s must be positive", cfg.NATSStartupTimeout)
+			}
+		}
+	case "memory":
+	case "redis":
+		cfg.RedisURL = getenv("REDIS_URL")
+		if cfg.RedisURL == "" {
+			return Config{}, fmt.Errorf("REDIS_URL environment variable is required for the redis store backend")
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid STORE_BACKEND %q: must be nats, memory or redis", cfg.StoreBackend)
+	}
+
+	if v := getenv("STORE_RETRY_ATTEMPTS"); v != "" {
+		cfg.StoreRetryAttempts, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid STORE_RETRY_ATTEMPTS: %w", err)
+		}
+		if cfg.StoreRetryAttempts < 1 {
+			return Config{}, fmt.Errorf("invalid STORE_RETRY_ATTEMPTS: %d must be at least 1", cfg.StoreRetryAttempts)
+		}
+	}
+	if v := getenv("STORE_RETRY_BACKOFF"); v != "" {
+		cfg.StoreRetryBackoff, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid STORE_RETRY_BACKOFF: %w", err)
+		}
+		if cfg.StoreRetryBackoff < 0 {
+			return Config{}, fmt.Errorf("invalid STORE_RETRY_BACKOFF: %s must not be negative", cfg.StoreRetryBackoff)
+		}
+	}
+
+	if v := getenv("WATCH_SETUP_RATE"); v != "" {
+		cfg.WatchSetupRate, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WATCH_SETUP_RATE: %w", err)
+		}
+		if cfg.WatchSetupRate < 0 || math.IsInf(cfg.WatchSetupRate, 0) {
+			return Config{}, fmt.Errorf("invalid WATCH_SETUP_RATE: %g must be a non-negative number", cfg.WatchSetupRate)
+		}
+	}
+	if v := getenv("WATCH_SETUP_BURST"); v != "" {
+		cfg.WatchSetupBurst, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WATCH_SETUP_BURST: %w", err)
+		}
+		if cfg.WatchSetupBurst < 1 {
+			return Config{}, fmt.Errorf("invalid WATCH_SETUP_BURST: %d must be at least 1", cfg.WatchSetupBurst)
+		}
+	}
+
+	if v := getenv("SESSION_BACKEND"); v != "" {
+		cfg.SessionBackend = v
+	}
+	switch cfg.SessionBackend {
+	case "cookie":
+	case "nats":
+		if cfg.StoreBackend != "nats" {
+			return Config{}, fmt.Errorf("invalid SESSION_BACKEND: server-side sessions need STORE_BACKEND=nats")
+		}
+		cfg.SessionBucket = cmp.Or(getenv("SESSION_BUCKET"), cfg.KVBucket+"-sessions")
+		if !validBucketName(cfg.SessionBucket) {
+			return Config{}, fmt.Errorf("invalid SESSION_BUCKET %q: only letters, digits, '-' and '_' are allowed", cfg.SessionBucket)
+		}
+	default:
+		return Config{}, fmt.Errorf("invalid SESSION_BACKEND %q: must be cookie or nats", cfg.SessionBackend)
+	}
+
+	cfg.EventsSubject = getenv("EVENTS_SUBJECT")
+	if cfg.EventsSubject != "" {
+		if cfg.StoreBackend != "nats" {
+			return Config{}, fmt.Errorf("invalid EVENTS_SUBJECT: events can only be published with STORE_BACKEND=nats")
+		}
+		if !validPublishSubject(cfg.EventsSubject) {
+			return Config{}, fmt.Errorf("invalid EVENTS_SUBJECT %q: must be dot-separated tokens without wildcards or spaces", cfg.EventsSubject)
+		}
+	}
+
+	cfg.Namespace = getenv("ENV")
+	if cfg.Namespace != "" && !validNamespace(cfg.Namespace) {
+		return Config{}, fmt.Errorf("invalid ENV %q: only letters, digits, '-' and '_' are allowed", cfg.Namespace)
+	}
+
+	if v := getenv("ROUNDING_MODE"); v != "" {
+		cfg.Business.Rounding, err = parseRoundingMode(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ROUNDING_MODE: %w", err)
+		}
+	}
+
+	if v := getenv("AGE_BASIS"); v != "" {
+		cfg.Business.AgeBasis, err = parseAgeBasis(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AGE_BASIS: %w", err)
+		}
+	}
+
+	if v := getenv("BAND_FORMAT"); v != "" {
+		cfg.Business.BandFormat, err = parseBandFormat(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BAND_FORMAT: %w", err)
+		}
+	}
+
+	if v := getenv("COMPOSITE_RULE"); v != "" {
+		cfg.Business.CompositeRule, err = parseCompositeRule(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid COMPOSITE_RULE: %w", err)
+		}
+	}
+
+	if v := getenv("AVERAGE_PRECISION"); v != "" {
+		cfg.Business.AveragePrecision, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AVERAGE_PRECISION: %w", err)
+		}
+		if cfg.Business.AveragePrecision < 0 || cfg.Business.AveragePrecision > 2 {
+			return Config{}, fmt.Errorf("invalid AVERAGE_PRECISION: %d must be between 0 and 2", cfg.Business.AveragePrecision)
+		}
+	}
+
+	if v := getenv("HANDICAPS"); v != "" {
+		cfg.Business.Handicaps, err = parseHandicaps(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid HANDICAPS: %w", err)
+		}
+	}
+
+	if v := getenv("AUDIT_MAX_ENTRIES"); v != "" {
+		cfg.Business.AuditMaxEntries, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AUDIT_MAX_ENTRIES: %w", err)
+		}
+		if cfg.Business.AuditMaxEntries < 1 {
+			return Config{}, fmt.Errorf("invalid AUDIT_MAX_ENTRIES: %d must be at least 1", cfg.Business.AuditMaxEntries)
+		}
+	}
+
+	if v := getenv("BOAT_CLASSES"); v != "" {
+		cfg.Business.BoatClasses, err = parseBoatClasses(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BOAT_CLASSES: %w", err)
+		}
+	}
+
+	cfg.Business.Features, err = parseFeatureRollout(getenv("FEATURE_FLAGS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid FEATURE_FLAGS: %w", err)
+	}
+
+	if v := getenv("DUPLICATE_NAMES"); v != "" {
+		cfg.Business.DuplicateNames, err = parseDuplicateNamePolicy(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DUPLICATE_NAMES: %w", err)
+		}
+	}
+
+	if v := getenv("MAX_AGE"); v != "" {
+		cfg.Business.MaxAge, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid MAX_AGE: %w", err)
+		}
+		if float64(cfg.Business.MaxAge) < minAge {
+			return Config{}, fmt.Errorf("invalid MAX_AGE: %d is below the youngest masters age of %g", cfg.Business.MaxAge, minAge)
+		}
+	}
+
+	if v := getenv("WRITE_BATCH_WINDOW"); v != "" {
+		cfg.Business.WriteBatchWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WRITE_BATCH_WINDOW: %w", err)
+		}
+		if cfg.Business.WriteBatchWindow < 0 {
+			return Config{}, fmt.Errorf("invalid WRITE_BATCH_WINDOW: %s must not be negative", cfg.Business.WriteBatchWindow)
+		}
+	}
+
+	if v := getenv("WATCH_COALESCE_WINDOW"); v != "" {
+		cfg.Business.WatchCoalesceWindow, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WATCH_COALESCE_WINDOW: %w", err)
+		}
+		if cfg.Business.WatchCoalesceWindow < 0 {
+			return Config{}, fmt.Errorf("invalid WATCH_COALESCE_WINDOW: %s must not be negative", cfg.Business.WatchCoalesceWindow)
+		}
+	}
+
+	if v := getenv("TOO_YOUNG_POLICY"); v != "" {
+		cfg.Business.TooYoungPolicy, err = parseTooYoungPolicy(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TOO_YOUNG_POLICY: %w", err)
+		}
+	}
+
+	cfg.Business.TooYoungMessage, err = parseTooYoungMessage(cmp.Or(getenv("TOO_YOUNG_MESSAGE"), defaultTooYoungMessage))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid TOO_YOUNG_MESSAGE: %w", err)
+	}
+
+	if v := getenv("EXPORT_FIELDS"); v != "" {
+		cfg.Application.ExportFields, err = parseExportFields(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid EXPORT_FIELDS: %w", err)
+		}
+	}
+
+	if v := getenv("MAX_WATCHERS"); v != "" {
+		cfg.Application.MaxWatchers, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid MAX_WATCHERS: %w", err)
+		}
+		if cfg.Application.MaxWatchers < 1 {
+			return Config{}, fmt.Errorf("invalid MAX_WATCHERS: %d must be at least 1", cfg.Application.MaxWatchers)
+		}
+	}
+
+	if v := getenv("WATCHER_MAX_STALL"); v != "" {
+		cfg.Application.WatcherMaxStall, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid WATCHER_MAX_STALL: %w", err)
+		}
+		if cfg.Application.WatcherMaxStall <= 0 {
+			return Config{}, fmt.Errorf("invalid WATCHER_MAX_STALL: %s must be positive", cfg.Application.WatcherMaxStall)
+		}
+	}
+
+	cfg.YearRolloverRecalc = getenv("YEAR_ROLLOVER_RECALC") == "true"
+
+	if v := getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		cfg.ShutdownTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+		if cfg.ShutdownTimeout <= 0 {
+			return Config{}, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %s must be positive", cfg.ShutdownTimeout)
+		}
+	}
+
+	if v := getenv("REQUEST_TIMEOUT"); v != "" {
+		cfg.RequestTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid REQUEST_TIMEOUT: %w", err)
+		}
+		if cfg.RequestTimeout <= 0 {
+			return Config{}, fmt.Errorf("invalid REQUEST_TIMEOUT: %s must be positive", cfg.RequestTimeout)
+		}
+	}
+	cfg.Business.WriteTimeout = cfg.RequestTimeout
+
+	cfg.AdminToken = getenv("ADMIN_TOKEN")
+
+	cfg.ErrorPage, err = parseErrorPage(getenv("ERROR_PAGE_TEMPLATE"))
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid ERROR_PAGE_TEMPLATE: %w", err)
+	}
+
+	if getenv("PPROF") == "true" {
+		cfg.PprofAddr = cmp.Or(getenv("PPROF_ADDR"), defaultPprofAddr)
+	}
+
+	return cfg, nil
+}
+
+// withConfigFile returns a getenv that falls back to the settings in the JSON
+// file named by CONFIG_FILE, if any. The file is an object keyed by
+// environment variable name, e.g. {"PORT": 8080, "STORE_BACKEND": "memory"};
+// a variable set in the environment always wins over the file.
+func withConfigFile(getenv func(string) string) (func(string) string, error) {
+	path := getenv("CONFIG_FILE")
+	if path == "" {
+		return getenv, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	for key, v := range raw {
+		switch v := v.(type) {
+		case string:
+			settings[key] = v
+		case json.Number:
+			settings[key] = v.String()
+		case bool:
+			settings[key] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("invalid config file %s: %s must be a string, number or boolean", path, key)
+		}
+	}
+
+	return func(key string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return settings[key]
+	}, nil
+}
+
+// redacted stands in for a secret in the logged configuration.
+const redacted = "[redacted]"
+
+// LogValue logs the effective configuration with its secrets redacted, so an
+// operator can check what the server actually resolved.
+func (cfg Config) LogValue() slog.Value {
+	sessionKey := redacted
+	if cfg.EphemeralSessionKey {
+		sessionKey = "ephemeral"
+	}
+	adminToken := ""
+	if cfg.AdminToken != "" {
+		adminToken = redacted
+	}
+	redisURL := cfg.RedisURL
+	if u, err := url.Parse(redisURL); err == nil {
+		redisURL = u.Redacted()
+	}
+	exportFields := make([]string, len(cfg.Application.ExportFields))
+	for i, f := range cfg.Application.ExportFields {
+		exportFields[i] = f.Header + "=" + f.Field
+	}
+	boatClasses := make([]string, len(cfg.Business.BoatClasses))
+	for i, c := range cfg.Business.BoatClasses {
+		boatClasses[i] = c.Name
+	}
+
+	return slog.GroupValue(
+		slog.String("port", cfg.Port),
+		slog.String("logFile", cfg.LogFile),
+		slog.Int64("logFileMaxBytes", cfg.LogFileMaxBytes),
+		slog.Group("session",
+			slog.String("secret", sessionKey),
+			slog.String("backend", cfg.SessionBackend),
+			slog.String("bucket", cfg.SessionBucket),
+			slog.String("name", cfg.Application.SessionName),
+			slog.Duration("maxAge", cfg.SessionMaxAge),
+			// The cookie attributes are fixed in run.
+			slog.Bool("httpOnly", true),
+			slog.Bool("secure", false),
+			slog.String("sameSite", "lax"),
+		),
+		slog.Duration("stateTTL", cfg.StateTTL),
+		slog.Duration("ttlRefresh", cfg.Business.TTLRefresh),
+		slog.Int("gzipLevel", cfg.GzipLevel),
+		slog.Any("trustedProxies", cfg.TrustedProxies),
+		slog.Bool("h2c", cfg.H2C),
+		slog.String("appName", cfg.AppName),
+		slog.String("rootRedirect", cfg.RootRedirect),
+		slog.Group("store",
+			slog.String("backend", cfg.StoreBackend),
+			slog.String("namespace", cfg.Namespace),
+			slog.Duration("archiveTTL", cfg.ArchiveTTL),
+			slog.String("kvBucket", cfg.KVBucket),
+			slog.Int64("kvMaxBytes", cfg.KVMaxBytes),
+			slog.String("archiveBucket", cfg.ArchiveBucket),
+			slog.String("auditBucket", cfg.AuditBucket),
+			slog.String("jsStorage", cfg.JSStorage),
+			slog.String("natsDir", cfg.NATSDir),
+			slog.Duration("natsStartupTimeout", cfg.NATSStartupTimeout),
+			slog.String("redisURL", redisURL),
+			slog.String("eventsSubject", cfg.EventsSubject),
+			slog.Int("retryAttempts", cfg.StoreRetryAttempts),
+			slog.Duration("retryBackoff", cfg.StoreRetryBackoff),
+		),
+		slog.Float64("watchSetupRate", cfg.WatchSetupRate),
+		slog.Int("watchSetupBurst", cfg.WatchSetupBurst),
+		slog.Int("maxWatchers", cfg.Application.MaxWatchers),
+		slog.Duration("watcherMaxStall", cfg.Application.WatcherMaxStall),
+		slog.Bool("yearRolloverRecalc", cfg.YearRolloverRecalc),
+		slog.Duration("shutdownTimeout", cfg.ShutdownTimeout),
+		slog.Duration("requestTimeout", cfg.RequestTimeout),
+		slog.String("pprofAddr", cfg.PprofAddr),
+		slog.String("adminToken", adminToken),
+		slog.Any("corsOrigins", cfg.Application.CORSOrigins),
+		slog.Bool("demoMode", cfg.Application.DemoMode),
+		slog.Any("exportFields", exportFields),
+		slog.Group("business",
+			// The age bands are built in.
+			slog.String("bands", "built-in"),
+			slog.String("bandFormat", string(cfg.Business.BandFormat)),
+			slog.String("rounding", string(cfg.Business.Rounding)),
+			slog.String("ageBasis", string(cfg.Business.AgeBasis)),
+			slog.Int("averagePrecision", cfg.Business.AveragePrecision),
+			slog.String("duplicateNames", string(cfg.Business.DuplicateNames)),
+			slog.String("tooYoungPolicy", string(cfg.Business.TooYoungPolicy)),
+			slog.Int("maxAge", cfg.Business.MaxAge),
+			slog.String("compositeRule", string(cfg.Business.CompositeRule)),
+			slog.Any("boatClasses", boatClasses),
+			slog.Duration("writeBatchWindow", cfg.Business.WriteBatchWindow),
+			slog.Duration("watchCoalesceWindow", cfg.Business.WatchCoalesceWindow),
+			slog.Int("auditMaxEntries", cfg.Business.AuditMaxEntries),
+			slog.Any("features", cfg.Business.Features),
+		),
+	)
+}
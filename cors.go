@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight response.
+const corsMaxAge = "600"
+
+// parseCORSOrigins parses a comma-separated list of origins, such as
+// https://example.org, allowed to call the API routes from another site. "*"
+// allows any origin.
+func parseCORSOrigins(v string) ([]string, error) {
+	var origins []string
+	for entry := range strings.SplitSeq(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			origins = append(origins, entry)
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin %q: %w", entry, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid origin %q: must be a scheme and host, e.g. https://example.org", entry)
+		}
+		origins = append(origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return origins, nil
+}
+
+// corsAllowed reports whether a request from origin may read the response.
+func corsAllowed(origins []string, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	return slices.Contains(origins, "*") || slices.Contains(origins, strings.ToLower(origin))
+}
+
+// handleCORS registers h for method and path, allowing cross-origin requests
+// from origins, and answers preflight OPTIONS requests for the path. Origins
+// not in the list get no CORS headers, so browsers keep the response from
+// them. Only use it for routes that don't depend on the session cookie.
+func handleCORS(mux *routeMux, origins []string, method, path string, h http.HandlerFunc) {
+	mux.HandleFunc(method+" "+path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); corsAllowed(origins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		h(w, r)
+	})
+
+	mux.HandleFunc("OPTIONS "+path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if !corsAllowed(origins, origin) || r.Header.Get("Access-Control-Request-Method") != method {
+			http.Error(w, "Cross-origin request not allowed", http.StatusForbidden)
+			return
+		}
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Methods", method)
+		header.Set("Access-Control-Allow-Headers", "Content-Type")
+		header.Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseCORSOrigins(t *testing.T) {
+	got, err := parseCORSOrigins(" https://Example.org , http://localhost:3000/,,*")
+	if err != nil {
+		t.Fatalf("parseCORSOrigins: %v", err)
+	}
+	if want := []string{"https://example.org", "http://localhost:3000", "*"}; !slices.Equal(got, want) {
+		t.Errorf("parseCORSOrigins = %v, want %v", got, want)
+	}
+
+	for _, v := range []string{"example.org", "ftp://example.org", "https://example.org/app", "https://example.org?x=1"} {
+		if _, err := parseCORSOrigins(v); err == nil {
+			t.Errorf("parseCORSOrigins(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.CORSOrigins = []string{"https://example.org"}
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg)
+
+	send := func(method, target, origin string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		origin     string
+		header     map[string]string
+		wantStatus int
+		wantOrigin string
+	}{
+		{name: "allowed origin", method: http.MethodGet, target: "/masterscalc/bands", origin: "https://example.org", wantStatus: http.StatusOK, wantOrigin: "https://example.org"},
+		{name: "disallowed origin", method: http.MethodGet, target: "/masterscalc/bands", origin: "https://evil.example", wantStatus: http.StatusOK},
+		{name: "same origin", method: http.MethodGet, target: "/masterscalc/bands", wantStatus: http.StatusOK},
+		{
+			name: "preflight", method: http.MethodOptions, target: "/masterscalc/compute", origin: "https://example.org",
+			header:     map[string]string{"Access-Control-Request-Method": http.MethodPost},
+			wantStatus: http.StatusNoContent, wantOrigin: "https://example.org",
+		},
+		{
+			name: "preflight from a disallowed origin", method: http.MethodOptions, target: "/masterscalc/compute", origin: "https://evil.example",
+			header:     map[string]string{"Access-Control-Request-Method": http.MethodPost},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "preflight for another method", method: http.MethodOptions, target: "/masterscalc/compute", origin: "https://example.org",
+			header:     map[string]string{"Access-Control-Request-Method": http.MethodDelete},
+			wantStatus: http.StatusForbidden,
+		},
+		{name: "session route", method: http.MethodGet, target: "/masterscalc", origin: "https://example.org", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.target, tt.origin, tt.header)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantStatus == http.StatusNoContent {
+				if got := w.Header().Get("Access-Control-Allow-Methods"); got != http.MethodPost {
+					t.Errorf("Access-Control-Allow-Methods = %q, want POST", got)
+				}
+			}
+		})
+	}
+}
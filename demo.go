@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// demoCrew is the sample crew new sessions start with in demo mode: a mixed
+// sweep four with a cox, spanning several masters categories.
+var demoCrew = []rowerInput{
+	{Name: "Alex Morgan", BirthYearOrAge: "44", Club: "Thames RC", Side: string(sidePort)},
+	{Name: "Sam Okafor", BirthYearOrAge: "52", Club: "Thames RC", Side: string(sideStarboard)},
+	{Name: "Jo Lindqvist", BirthYearOrAge: "47", Club: "Thames RC", Side: string(sidePort)},
+	{Name: "Chris Patel", BirthYearOrAge: "58", Club: "Thames RC", Side: string(sideStarboard)},
+	{Name: "Robin Hughes", BirthYearOrAge: "39", Club: "Thames RC"},
+}
+
+// errAlreadySeeded leaves a crew that has been saved before untouched.
+var errAlreadySeeded = errors.New("crew already saved")
+
+// SeedDemo adds the sample crew to the crew at key, unless it has ever been
+// saved, so a returning session's crew, even one emptied by its owner, is
+// left as it is.
+func (b *business) SeedDemo(ctx context.Context, key string) error {
+	rowers := make([]rower, 0, len(demoCrew))
+	for _, in := range demoCrew {
+		r, err := b.parseRower(in)
+		if err != nil {
+			return fmt.Errorf("could not parse sample rower %q: %w", in.Name, err)
+		}
+		rowers = append(rowers, r)
+	}
+
+	var events []changeEvent
+	err := b.mutate(ctx, key, func(s *state) error {
+		if !s.SavedAt.IsZero() || len(s.Rowers) > 0 {
+			return errAlreadySeeded
+		}
+		for _, r := range rowers {
+			if err := b.admitRower(s, r); err != nil {
+				return fmt.Errorf("could not add sample rower %q: %w", r.Name, err)
+			}
+		}
+		events = nil
+		for _, r := range rowers {
+			s.Rowers = append(s.Rowers, r)
+			events = append(events, changeEvent{Type: changeCreate, Rower: &r})
+		}
+		slog.Info("Seeded demo crew", "key", key, "count", len(rowers))
+		return nil
+	})
+	if errors.Is(err, errAlreadySeeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, events...)
+	return nil
+}
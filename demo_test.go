@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDemoMode(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.DemoMode = true
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg)
+
+	c := newTestClient(t, mux)
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	for _, in := range demoCrew {
+		if !strings.Contains(body, "<td>"+in.Name+"</td>") {
+			t.Errorf("fresh demo session does not have %s", in.Name)
+		}
+	}
+
+	// The returning session keeps its own changes.
+	c.mustDo(http.MethodDelete, "/masterscalc/rowers/0", "", http.StatusOK)
+	body = c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if strings.Contains(body, demoCrew[0].Name) || !strings.Contains(body, demoCrew[1].Name) {
+		t.Errorf("returning session was seeded again:\n%s", body)
+	}
+}
+
+func TestSeedDemoLeavesSavedCrew(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Kim", BirthYearOrAge: "61"})
+	if err := b.SeedDemo(ctx, "crew"); err != nil {
+		t.Fatalf("SeedDemo: %v", err)
+	}
+	if s := mustGet(t, b, "crew"); len(s.Rowers) != 1 || s.Rowers[0].Name != "Kim" {
+		t.Errorf("crew = %+v, want only Kim", s.Rowers)
+	}
+
+	// A crew emptied by its owner has been saved, so it stays empty.
+	if err := b.Delete(ctx, "crew", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := b.SeedDemo(ctx, "crew"); err != nil {
+		t.Fatalf("SeedDemo: %v", err)
+	}
+	if n := len(mustGet(t, b, "crew").Rowers); n != 0 {
+		t.Errorf("emptied crew has %d rowers after SeedDemo, want 0", n)
+	}
+
+	if err := b.SeedDemo(ctx, "new"); err != nil {
+		t.Fatalf("SeedDemo: %v", err)
+	}
+	if n := len(mustGet(t, b, "new").Rowers); n != len(demoCrew) {
+		t.Errorf("new crew has %d rowers, want the %d sample rowers", n, len(demoCrew))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	toolbelt "github.com/delaneyj/toolbelt/id"
+)
+
+type requestIDKey struct{}
+
+// requestID returns the ID requestIDMiddleware gave r, or "" outside it.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// maxRequestIDLength bounds a request ID taken from the X-Request-ID header.
+const maxRequestIDLength = 64
+
+// requestIDMiddleware gives each request an ID, returned in the X-Request-ID
+// header and shown on error pages so a user's report can be matched to the
+// logs. An ID already set, e.g. by a proxy in front, is kept if it looks like
+// one.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = toolbelt.NextEncodedID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+const defaultErrorPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<title>{{.Status}} {{.StatusText}} - {{html .SiteName}}</title>
+	<link rel="stylesheet" type="text/css" href="/static/css/styles.css">
+</head>
+<body>
+<div class="form-container">
+	<h1>Something went wrong</h1>
+	<p class="lead">{{.Status}} {{.StatusText}}: {{html .Message}}</p>
+	<p class="form-text">If this keeps happening, mention request ID <code>{{.RequestID}}</code> when you report it.</p>
+	<p><a href="/masterscalc">Back to {{html .SiteName}}</a></p>
+</div>
+</body>
+</html>`
+
+// errorPageData is what an error page template is rendered with.
+type errorPageData struct {
+	Status     int
+	StatusText string
+	Message    string
+	RequestID  string
+	SiteName   string
+}
+
+// parseErrorPage parses the error page template in the file at path, or the
+// default one when path is empty, rendering it once so that mistakes are
+// reported at startup rather than on an error.
+func parseErrorPage(path string) (*template.Template, error) {
+	text := defaultErrorPageTemplate
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read error page template: %w", err)
+		}
+		text = string(b)
+	}
+
+	t, err := template.New("errorPage").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	data := errorPageData{Status: http.StatusNotFound, StatusText: http.StatusText(http.StatusNotFound), Message: "Example", RequestID: "example", SiteName: defaultAppName}
+	if err := t.Execute(io.Discard, data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// maxErrorMessageBytes bounds how much of a handler's error message is kept.
+const maxErrorMessageBytes = 4 << 10
+
+// errorPageMiddleware replaces the plain text errors written by http.Error:
+// with page, for browsers navigating to a page, or with JSON carrying the
+// message and request ID for API clients. Datastar requests keep the plain
+// text, which the page reports itself, WebSocket upgrades are left alone and
+// other responses pass through.
+func errorPageMiddleware(page *template.Template, siteName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Datastar-Request") != "" || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &errorPageResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+			if ew.status == 0 {
+				return
+			}
+
+			message := strings.TrimSpace(ew.message.String())
+			h := w.Header()
+			h.Del("Content-Length")
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				h.Set("Content-Type", "text/html; charset=utf-8")
+				w.WriteHeader(ew.status)
+				data := errorPageData{Status: ew.status, StatusText: http.StatusText(ew.status), Message: message, RequestID: requestID(r), SiteName: siteName}
+				if err := page.Execute(w, data); err != nil {
+					slog.Error("Error executing error page template", "error", err)
+				}
+				return
+			}
+
+			h.Set("Content-Type", "application/json")
+			w.WriteHeader(ew.status)
+			body := struct {
+				Error     string `json:"error"`
+				RequestID string `json:"requestId"`
+			}{message, requestID(r)}
+			if err := json.NewEncoder(w).Encode(body); err != nil {
+				slog.Error("Error encoding error", "error", err)
+			}
+		})
+	}
+}
+
+// errorPageResponseWriter holds back an error written by http.Error, keeping
+// its status and message for errorPageMiddleware to render.
+type errorPageResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	// status is set when the response is being held back.
+	status  int
+	message bytes.Buffer
+}
+
+func (w *errorPageResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	// http.Error always sets these two headers, which tells its errors apart
+	// from other plain text responses.
+	h := w.Header()
+	if status >= http.StatusBadRequest && h.Get("Content-Type") == "text/plain; charset=utf-8" && h.Get("X-Content-Type-Options") == "nosniff" {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorPageResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status == 0 {
+		return w.ResponseWriter.Write(b)
+	}
+	if room := maxErrorMessageBytes - w.message.Len(); room > 0 {
+		w.message.Write(b[:min(len(b), room)])
+	}
+	return len(b), nil
+}
+
+func (w *errorPageResponseWriter) FlushError() error {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status != 0 {
+		return nil
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *errorPageResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *errorPageResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorPageMiddleware(t *testing.T) {
+	page, err := parseErrorPage("")
+	if err != nil {
+		t.Fatalf("parseErrorPage: %v", err)
+	}
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	h := requestIDMiddleware(errorPageMiddleware(page, "Tideway Masters")(mux))
+	send := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Request-ID", "req-123")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("browser", func(t *testing.T) {
+		w := send("/masterscalc/rowers/3/card", map[string]string{"Accept": "text/html,application/xhtml+xml"})
+		if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("status %d, Content-Type %q, want a 404 HTML page", w.Code, w.Header().Get("Content-Type"))
+		}
+		body := w.Body.String()
+		for _, want := range []string{"<code>req-123</code>", "404 Not Found: Error getting rower: rower not found: 3", "Back to Tideway Masters"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("error page does not contain %q:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("API client", func(t *testing.T) {
+		w := send("/masterscalc/rowers/3/card", map[string]string{"Accept": "application/json"})
+		var got struct {
+			Error     string `json:"error"`
+			RequestID string `json:"requestId"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("decode error: %v", err)
+		}
+		if w.Code != http.StatusNotFound || got.RequestID != "req-123" || !strings.Contains(got.Error, "rower not found") {
+			t.Errorf("status %d, body %+v, want a 404 naming the rower and request", w.Code, got)
+		}
+	})
+
+	t.Run("Datastar", func(t *testing.T) {
+		w := send("/masterscalc/rowers/3/card", map[string]string{"Accept": "text/html", "Datastar-Request": "true"})
+		if ct := w.Header().Get("Content-Type"); w.Code != http.StatusNotFound || !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("status %d, Content-Type %q, want the plain text 404", w.Code, ct)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		w := send("/masterscalc/rowers/print", map[string]string{"Accept": "text/html"})
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Something went wrong") {
+			t.Errorf("status %d, want the print page untouched", w.Code)
+		}
+		if got := w.Header().Get("X-Request-ID"); got != "req-123" {
+			t.Errorf("X-Request-ID = %q, want req-123", got)
+		}
+	})
+}
+
+func TestRequestIDFromHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		wantKept bool
+	}{
+		{header: "abc-123_XYZ", wantKept: true},
+		{header: ""},
+		{header: "has space"},
+		{header: "<script>"},
+		{header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		var got string
+		h := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = requestID(r) }))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-ID", tt.header)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if kept := got == tt.header; kept != tt.wantKept || got == "" {
+			t.Errorf("X-Request-ID %q: request ID %q, want it kept: %v", tt.header, got, tt.wantKept)
+		}
+	}
+}
+
+func TestParseErrorPage(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if _, err := parseErrorPage(write("ok.html", "<p>{{.Status}} {{.RequestID}}</p>")); err != nil {
+		t.Errorf("parseErrorPage of a valid template: %v", err)
+	}
+	for name, text := range map[string]string{
+		"syntax.html":  "<p>{{.Status</p>",
+		"unknown.html": "<p>{{.Crew}}</p>",
+	} {
+		if _, err := parseErrorPage(write(name, text)); err == nil {
+			t.Errorf("parseErrorPage of %s succeeded, want an error", name)
+		}
+	}
+	if _, err := parseErrorPage(filepath.Join(dir, "missing.html")); err == nil {
+		t.Error("parseErrorPage of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// changeType is the kind of change a changeEvent reports.
+type changeType string
+
+const (
+	changeCreate changeType = "create"
+	changeDelete changeType = "delete"
+	changeUpdate changeType = "update"
+)
+
+// changeEvent describes a saved change to a session's crew. Creates and
+// deletes carry the rower concerned; updates say what changed in Detail.
+type changeEvent struct {
+	Type    changeType `json:"type"`
+	Session string     `json:"session"`
+	Rower   *rower     `json:"rower,omitempty"`
+	Detail  string     `json:"detail,omitempty"`
+	Time    time.Time  `json:"time"`
+}
+
+// publisher delivers change events to downstream consumers.
+type publisher interface {
+	Publish(ctx context.Context, event changeEvent) error
+}
+
+// noopPublisher drops every event, for when no consumer is configured.
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, changeEvent) error { return nil }
+
+// natsPublisher publishes events as JSON on a NATS subject.
+type natsPublisher struct {
+	nc      *nats.Conn
+	subject string
+}
+
+func newNATSPublisher(nc *nats.Conn, subject string) *natsPublisher {
+	return &natsPublisher{nc: nc, subject: subject}
+}
+
+func (p *natsPublisher) Publish(_ context.Context, event changeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %w", err)
+	}
+	if err := p.nc.Publish(p.subject, data); err != nil {
+		return fmt.Errorf("could not publish event: %w", err)
+	}
+	return nil
+}
+
+// validPublishSubject reports whether subject is a NATS subject that can be
+// published to: dot-separated tokens without wildcards or whitespace.
+func validPublishSubject(subject string) bool {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return false
+	}
+	for token := range strings.SplitSeq(subject, ".") {
+		if token == "" || token == "*" || token == ">" {
+			return false
+		}
+	}
+	return true
+}
+
+// publish records the events for a saved change to key in the audit trail and
+// sends them to the publisher. A failure is logged rather than returned, as
+// the change itself has been saved.
+func (b *business) publish(ctx context.Context, key string, events ...changeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	now := b.now()
+	for i := range events {
+		events[i].Session = key
+		events[i].Time = now
+		if err := b.events.Publish(ctx, events[i]); err != nil {
+			slog.Error("Error publishing change event", "type", events[i].Type, "error", err)
+		}
+	}
+	if err := b.appendAudit(ctx, key, events); err != nil {
+		slog.Error("Error recording audit trail", "error", err)
+	}
+}
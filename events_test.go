@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher keeps the events published to it, failing with err.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []changeEvent
+	err    error
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event changeEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+	return p.err
+}
+
+func newPublishingBusiness(t *testing.T, events publisher) *business {
+	t.Helper()
+	b := newBusiness(newMemoryStore(time.Hour), newMemoryStore(time.Hour), newMemoryStore(time.Hour), events, testBusinessConfig())
+	b.now = func() time.Time { return testNow }
+	return b
+}
+
+func TestCreatePublishesEvent(t *testing.T) {
+	events := &recordingPublisher{}
+	b := newPublishingBusiness(t, events)
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44", Club: "Tideway"})
+
+	if len(events.events) != 1 {
+		t.Fatalf("published %d events, want 1", len(events.events))
+	}
+	data, err := json.Marshal(events.events[0])
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	var payload struct {
+		Type    string
+		Session string
+		Rower   struct {
+			Name string
+			Age  int
+			Band string
+			Club string
+		}
+		Time time.Time
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatalf("unmarshal event %s: %v", data, err)
+	}
+	if payload.Type != "create" || payload.Session != "crew" || !payload.Time.Equal(testNow) {
+		t.Errorf("event = %s, want a create for crew at %s", data, testNow)
+	}
+	if r := payload.Rower; r.Name != "Alex" || r.Age != 44 || r.Band != "C" || r.Club != "Tideway" {
+		t.Errorf("event rower = %+v, want Alex, 44, C, Tideway", r)
+	}
+}
+
+func TestMutationsPublishEvents(t *testing.T) {
+	ctx := context.Background()
+	events := &recordingPublisher{}
+	b := newPublishingBusiness(t, events)
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"}, rowerInput{Name: "Blake", BirthYearOrAge: "52"})
+	if err := b.Delete(ctx, "crew", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := b.SetCrewName(ctx, "crew", "Tideway Masters"); err != nil {
+		t.Fatalf("SetCrewName: %v", err)
+	}
+	// A failed change publishes nothing.
+	if err := b.Delete(ctx, "crew", 5); err == nil {
+		t.Fatal("Delete out of range succeeded")
+	}
+
+	want := []changeType{changeCreate, changeCreate, changeDelete, changeUpdate}
+	if len(events.events) != len(want) {
+		t.Fatalf("published %d events, want %d: %+v", len(events.events), len(want), events.events)
+	}
+	for i, event := range events.events {
+		if event.Type != want[i] {
+			t.Errorf("event %d type = %s, want %s", i, event.Type, want[i])
+		}
+	}
+	if deleted := events.events[2].Rower; deleted == nil || deleted.Name != "Alex" {
+		t.Errorf("delete event rower = %v, want Alex", deleted)
+	}
+}
+
+func TestPublishFailureKeepsChange(t *testing.T) {
+	b := newPublishingBusiness(t, &recordingPublisher{err: errors.New("no responders")})
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	if n := len(mustGet(t, b, "crew").Rowers); n != 1 {
+		t.Errorf("crew has %d rowers, want 1", n)
+	}
+}
+
+func TestValidPublishSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		want    bool
+	}{
+		{subject: "masterscalc.changes", want: true},
+		{subject: "changes", want: true},
+		{subject: ""},
+		{subject: "masterscalc.*"},
+		{subject: "masterscalc.>"},
+		{subject: "masterscalc..changes"},
+		{subject: "masterscalc changes"},
+	}
+	for _, tt := range tests {
+		if got := validPublishSubject(tt.subject); got != tt.want {
+			t.Errorf("validPublishSubject(%q) = %v, want %v", tt.subject, got, tt.want)
+		}
+	}
+}
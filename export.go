@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// exportField maps a column in the entry export to a rower or crew value.
+type exportField struct {
+	Header string
+	Field  string
+}
+
+// exportValues are the values available to the entry export, by field name.
+var exportValues = map[string]func(r rower, s *state) string{
+	"name":      func(r rower, _ *state) string { return r.Name },
+	"firstName": func(r rower, _ *state) string { first, _ := splitName(r.Name); return first },
+	"lastName":  func(r rower, _ *state) string { _, last := splitName(r.Name); return last },
+	"birthYear": func(r rower, _ *state) string { return strconv.Itoa(r.BirthYear) },
+	"age":       func(r rower, _ *state) string { return strconv.Itoa(r.Age) },
+	"band":      func(r rower, _ *state) string { return r.Band },
+	"side":      func(r rower, _ *state) string { return string(r.Side) },
+	"club":      func(r rower, _ *state) string { return r.Club },
+	"weight": func(r rower, _ *state) string {
+		if r.Weight == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(r.Weight, 'f', 1, 64)
+	},
+	"crewName":  func(_ rower, s *state) string { return s.CrewName },
+	"crewBand":  func(_ rower, s *state) string { return s.Signals.AverageBand },
+	"crewClass": func(_ rower, s *state) string { return s.Signals.CrewClass },
+}
+
+// defaultExportFields follow the columns commonly asked for by regatta entry
+// systems. Entry systems differ, so the mapping can be replaced with EXPORT_FIELDS.
+var defaultExportFields = []exportField{
+	{"Last Name", "lastName"},
+	{"First Name", "firstName"},
+	{"Year of Birth", "birthYear"},
+	{"Side", "side"},
+	{"Category", "crewClass"},
+}
+
+// parseExportFields parses a mapping such as "Surname=lastName,YOB=birthYear".
+func parseExportFields(spec string) ([]exportField, error) {
+	var fields []exportField
+	for pair := range strings.SplitSeq(spec, ",") {
+		header, field, ok := strings.Cut(pair, "=")
+		header, field = strings.TrimSpace(header), strings.TrimSpace(field)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("invalid export field %q: want Header=field", pair)
+		}
+		if _, ok := exportValues[field]; !ok {
+			return nil, fmt.Errorf("unknown export field %q: must be one of %s", field, strings.Join(exportFieldNames(), ", "))
+		}
+		fields = append(fields, exportField{Header: header, Field: field})
+	}
+	return fields, nil
+}
+
+// writeEntryCSV writes one CSV row per rower using the given field mapping.
+func writeEntryCSV(w io.Writer, s *state, fields []exportField) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.Header
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("could not write header: %w", err)
+	}
+
+	for _, r := range s.Rowers {
+		record := make([]string, len(fields))
+		for i, f := range fields {
+			record[i] = csvCell(exportValues[f.Field](r, s))
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("could not write rower: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell defuses a value that a spreadsheet would run as a formula, such as a
+// rower named "=HYPERLINK(...)", by prefixing it with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportFilename names the entry export after the crew.
+func exportFilename(crewName string) string {
+	return crewFilename(crewName, "entry.csv")
+}
+
+// crewFilename names a download for the crew with suffix, keeping only the
+// characters of the crew name that are safe in a filename everywhere.
+func crewFilename(crewName, suffix string) string {
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, crewName), "-")
+	if name == "" {
+		name = "crew"
+	}
+	return name + "-" + suffix
+}
+
+// splitName splits a full name into first and last names at the final space.
+func splitName(name string) (first, last string) {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return name, ""
+	}
+	return strings.Join(parts[:len(parts)-1], " "), parts[len(parts)-1]
+}
+
+// exportFieldNames lists the field names that EXPORT_FIELDS can refer to.
+func exportFieldNames() []string {
+	names := make([]string, 0, len(exportValues))
+	for name := range exportValues {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteEntryCSV(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex Morgan", BirthYearOrAge: "1982", Side: "port", Club: "Tideway", Weight: "80"},
+		rowerInput{Name: "Sam Cruz", BirthYearOrAge: "1976", Side: "starboard", Weight: "71.5"},
+	)
+	s := mustGet(t, b, "crew")
+
+	tests := []struct {
+		name   string
+		fields []exportField
+		want   [][]string
+	}{
+		{
+			name:   "default",
+			fields: defaultExportFields,
+			want: [][]string{
+				{"Last Name", "First Name", "Year of Birth", "Side", "Category"},
+				{"Morgan", "Alex", "1982", "port", "Masters C"},
+				{"Cruz", "Sam", "1976", "starboard", "Masters C"},
+			},
+		},
+		{
+			name:   "custom",
+			fields: []exportField{{"Rower", "name"}, {"Age", "age"}, {"Club", "club"}, {"Weight", "weight"}, {"Crew band", "crewBand"}},
+			want: [][]string{
+				{"Rower", "Age", "Club", "Weight", "Crew band"},
+				{"Alex Morgan", "44", "Tideway", "80.0", "C"},
+				{"Sam Cruz", "50", "", "71.5", "C"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(strings.Builder)
+			if err := writeEntryCSV(out, s, tt.fields); err != nil {
+				t.Fatalf("writeEntryCSV: %v", err)
+			}
+			got, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+			if err != nil {
+				t.Fatalf("could not read the export: %v", err)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("export = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteEntryCSVDefusesFormulas(t *testing.T) {
+	s := &state{Rowers: []rower{
+		{Name: "=HYPERLINK(\"http://example.com\")"},
+		{Name: "+1"},
+		{Name: "-1"},
+		{Name: "@SUM(A1)"},
+		{Name: "Alex = Sam"},
+	}}
+	out := new(strings.Builder)
+	if err := writeEntryCSV(out, s, []exportField{{"Name", "name"}}); err != nil {
+		t.Fatalf("writeEntryCSV: %v", err)
+	}
+	got, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read the export: %v", err)
+	}
+	want := [][]string{{"Name"}, {"'=HYPERLINK(\"http://example.com\")"}, {"'+1"}, {"'-1"}, {"'@SUM(A1)"}, {"Alex = Sam"}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("export = %q, want %q", got, want)
+	}
+}
+
+func TestParseExportFields(t *testing.T) {
+	fields, err := parseExportFields("Surname=lastName, YOB = birthYear")
+	if err != nil {
+		t.Fatalf("parseExportFields: %v", err)
+	}
+	if want := []exportField{{"Surname", "lastName"}, {"YOB", "birthYear"}}; !slices.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	for _, spec := range []string{"Surname", "=lastName", "Surname=nickname"} {
+		if _, err := parseExportFields(spec); err == nil {
+			t.Errorf("parseExportFields accepted %q", spec)
+		}
+	}
+}
+
+func TestCrewNameRoundTrip(t *testing.T) {
+	cfg := testApplicationConfig()
+	cfg.ExportFields = []exportField{{"Crew", "crewName"}, {"Rower", "name"}}
+	c := newTestClient(t, newTestApp(t, newTestBusiness(t, testBusinessConfig()), cfg))
+	c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+	c.mustDo(http.MethodPost, "/masterscalc/crew-name", `{"crewName":"  Thames Masters 4x  "}`, http.StatusOK)
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	for _, want := range []string{"<title>Thames Masters 4x</title>", "<h1>Thames Masters 4x</h1>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("print page does not contain %q", want)
+		}
+	}
+
+	w := c.mustDo(http.MethodGet, "/masterscalc/rowers/export", "", http.StatusOK)
+	if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="Thames-Masters-4x-entry.csv"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	got, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("could not read the export: %v", err)
+	}
+	if want := [][]string{{"Crew", "Rower"}, {"Thames Masters 4x", "Alex"}}; !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("export = %q, want %q", got, want)
+	}
+
+	c.mustDo(http.MethodPost, "/masterscalc/crew-name", `{"crewName":"`+strings.Repeat("x", maxCrewNameLength+1)+`"}`, http.StatusBadRequest)
+	c.mustDo(http.MethodPost, "/masterscalc/crew-name", `{"crewName":""}`, http.StatusOK)
+	if body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); !strings.Contains(body, "<h1>Crew</h1>") {
+		t.Error("print page still shows the cleared crew name")
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	tests := map[string]string{
+		"":                  "crew-entry.csv",
+		"Thames Masters 4x": "Thames-Masters-4x-entry.csv",
+		`"; rm -rf /`:       "rm--rf-entry.csv",
+		"Zürich":            "Z-rich-entry.csv",
+	}
+	for crewName, want := range tests {
+		if got := exportFilename(crewName); got != want {
+			t.Errorf("exportFilename(%q) = %q, want %q", crewName, got, want)
+		}
+	}
+}
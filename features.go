@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// featureFlag names a behaviour being rolled out gradually.
+type featureFlag string
+
+const (
+	// featureRoundHalfUp rounds the crew's average age half up before
+	// choosing its band, whatever the configured rounding mode.
+	featureRoundHalfUp featureFlag = "round-half-up"
+)
+
+var knownFeatureFlags = []featureFlag{featureRoundHalfUp}
+
+// featureRollout is the percentage of sessions each feature flag is on for.
+// Flags not listed are off.
+type featureRollout map[featureFlag]int
+
+// parseFeatureRollout parses comma-separated flag=percent pairs, e.g.
+// "round-half-up=25".
+func parseFeatureRollout(v string) (featureRollout, error) {
+	rollout := featureRollout{}
+	for pair := range strings.SplitSeq(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, pct, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid feature flag %q: must be flag=percent", pair)
+		}
+		flag := featureFlag(strings.TrimSpace(name))
+		if !slices.Contains(knownFeatureFlags, flag) {
+			return nil, fmt.Errorf("unknown feature flag %q", flag)
+		}
+		percent, err := strconv.Atoi(strings.TrimSpace(pct))
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentage for feature flag %q: %w", flag, err)
+		}
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid percentage for feature flag %q: %d must be between 0 and 100", flag, percent)
+		}
+		rollout[flag] = percent
+	}
+	return rollout, nil
+}
+
+// enabled reports whether flag is on for the session key. Each session falls
+// in a fixed bucket per flag, so a flag stays on or off for a session while
+// its rollout is unchanged, and raising the percentage only adds sessions.
+// Without a session, as for the stateless compute endpoint, a flag is only on
+// once fully rolled out.
+func (f featureRollout) enabled(flag featureFlag, key string) bool {
+	percent := f[flag]
+	if percent >= 100 {
+		return true
+	}
+	if percent <= 0 || key == "" {
+		return false
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(string(flag) + ":" + key))
+	return int(h.Sum32()%100) < percent
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+)
+
+func TestParseFeatureRollout(t *testing.T) {
+	got, err := parseFeatureRollout(" round-half-up = 25 ,")
+	if err != nil {
+		t.Fatalf("parseFeatureRollout: %v", err)
+	}
+	if want := (featureRollout{featureRoundHalfUp: 25}); !maps.Equal(got, want) {
+		t.Errorf("parseFeatureRollout = %v, want %v", got, want)
+	}
+
+	for _, v := range []string{"round-half-up", "new-bands=10", "round-half-up=x", "round-half-up=101", "round-half-up=-1"} {
+		if _, err := parseFeatureRollout(v); err == nil {
+			t.Errorf("parseFeatureRollout(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestFeatureRolloutEnabled(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("session-%d", i)
+	}
+	on := func(percent int) map[string]bool {
+		rollout := featureRollout{featureRoundHalfUp: percent}
+		enabled := map[string]bool{}
+		for _, key := range keys {
+			if rollout.enabled(featureRoundHalfUp, key) {
+				enabled[key] = true
+			}
+		}
+		return enabled
+	}
+
+	if n := len(on(0)); n != 0 {
+		t.Errorf("0%%: on for %d sessions, want none", n)
+	}
+	if n := len(on(100)); n != len(keys) {
+		t.Errorf("100%%: on for %d sessions, want all %d", n, len(keys))
+	}
+	quarter, half := on(25), on(50)
+	if n := len(quarter); n < 200 || n > 300 {
+		t.Errorf("25%%: on for %d of %d sessions", n, len(keys))
+	}
+	for key := range quarter {
+		if !half[key] {
+			t.Errorf("%s is on at 25%% but off at 50%%", key)
+		}
+	}
+
+	if (featureRollout{featureRoundHalfUp: 99}).enabled(featureRoundHalfUp, "") {
+		t.Error("flag on without a session before its full rollout")
+	}
+}
+
+func TestFeatureFlagRounding(t *testing.T) {
+	// The average of 42.5 is B truncated, but C rounded half up.
+	crew := []rowerInput{{Name: "Alex", BirthYearOrAge: "42"}, {Name: "Blake", BirthYearOrAge: "43"}}
+	rollout := featureRollout{featureRoundHalfUp: 50}
+	var onKey, offKey string
+	for i := 0; onKey == "" || offKey == ""; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		if rollout.enabled(featureRoundHalfUp, key) {
+			onKey = key
+		} else {
+			offKey = key
+		}
+	}
+
+	cfg := testBusinessConfig()
+	cfg.Features = rollout
+	b := newTestBusiness(t, cfg)
+	for key, want := range map[string]string{onKey: "C", offKey: "B"} {
+		mustCreate(t, b, key, crew...)
+		if got := mustGet(t, b, key).Signals.AverageBand; got != want {
+			t.Errorf("session %s: AverageBand = %q, want %q", key, got, want)
+		}
+		plan, err := b.TargetBand(key, mustGet(t, b, key), "C")
+		if err != nil {
+			t.Fatalf("TargetBand: %v", err)
+		}
+		if plan.CurrentBand != want {
+			t.Errorf("session %s: target CurrentBand = %q, want %q", key, plan.CurrentBand, want)
+		}
+	}
+}
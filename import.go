@@ -0,0 +1,278 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rower values an imported column can hold.
+const (
+	importName           = "name"
+	importFirstName      = "firstName"
+	importLastName       = "lastName"
+	importDateOfBirth    = "dateOfBirth"
+	importBirthYearOrAge = "birthYearOrAge"
+	importClub           = "club"
+	importSide           = "side"
+	importWeight         = "weight"
+)
+
+// rosterColumns maps the headers of a club roster, lower-cased, to rower
+// values. Rosters kept by clubs and exported from rowing membership systems
+// name their columns in a handful of ways.
+var rosterColumns = map[string]string{
+	"name":          importName,
+	"full name":     importName,
+	"first name":    importFirstName,
+	"forename":      importFirstName,
+	"last name":     importLastName,
+	"surname":       importLastName,
+	"dob":           importDateOfBirth,
+	"date of birth": importDateOfBirth,
+	"birth date":    importDateOfBirth,
+	"year of birth": importBirthYearOrAge,
+	"age":           importBirthYearOrAge,
+	"club":          importClub,
+	"side":          importSide,
+	"rowing side":   importSide,
+	"weight":        importWeight,
+	"weight (kg)":   importWeight,
+}
+
+// exportImportValues maps the entry export fields that can be read back to
+// rower values. The rest are computed and are ignored on import.
+var exportImportValues = map[string]string{
+	"name":      importName,
+	"firstName": importFirstName,
+	"lastName":  importLastName,
+	"birthYear": importBirthYearOrAge,
+	"age":       importBirthYearOrAge,
+	"side":      importSide,
+	"club":      importClub,
+	"weight":    importWeight,
+}
+
+// importFormats are the names of the layouts an import can be read in.
+var importFormats = []string{"roster", "entry"}
+
+// importColumns returns the columns of the named import format. The entry
+// format is the layout of the entry export, so an export can be imported again.
+func importColumns(format string, exportFields []exportField) (map[string]string, error) {
+	switch format {
+	case "roster":
+		return rosterColumns, nil
+	case "entry":
+		columns := map[string]string{}
+		for _, f := range exportFields {
+			if value, ok := exportImportValues[f.Field]; ok {
+				columns[strings.ToLower(f.Header)] = value
+			}
+		}
+		return columns, nil
+	default:
+		return nil, fmt.Errorf("unknown import format %q: must be one of %s", format, strings.Join(importFormats, ", "))
+	}
+}
+
+// importedRower is a rower read from a row of an import. Line is the row's
+// line in the file, counting the header as line 1, and Warning says how an
+// ambiguous value was read.
+type importedRower struct {
+	Line    int
+	Input   rowerInput
+	Warning string
+}
+
+// readImport reads rowers from CSV with a header row, using columns to map
+// headers to rower values. It returns the headers it could not map.
+func readImport(r io.Reader, columns map[string]string) ([]importedRower, []string, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	values := make([]string, len(header))
+	var unmapped []string
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		value, ok := columns[strings.ToLower(h)]
+		if !ok {
+			unmapped = append(unmapped, h)
+			continue
+		}
+		if slices.Contains(values, value) {
+			return nil, nil, fmt.Errorf("more than one column holds the %s", value)
+		}
+		values[i] = value
+	}
+	if !slices.Contains(values, importName) && !slices.Contains(values, importFirstName) && !slices.Contains(values, importLastName) {
+		return nil, nil, errors.New("no name column found")
+	}
+
+	var rowers []importedRower
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read row: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		fields := map[string]string{}
+		for i, v := range record {
+			if values[i] != "" {
+				fields[values[i]] = strings.TrimSpace(v)
+			}
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		name := fields[importName]
+		if name == "" {
+			name = strings.TrimSpace(fields[importFirstName] + " " + fields[importLastName])
+		}
+		// Messy spreadsheets mix dates of birth, birth years and ages in the
+		// same column, so the value is read by its form rather than its column.
+		birthYearOrAge, dateOfBirth, warning := importAge(cmp.Or(fields[importDateOfBirth], fields[importBirthYearOrAge]))
+		rowers = append(rowers, importedRower{
+			Line: line,
+			Input: rowerInput{
+				Name:           name,
+				BirthYearOrAge: signalString(birthYearOrAge),
+				DateOfBirth:    dateOfBirth,
+				Weight:         signalString(fields[importWeight]),
+				Club:           fields[importClub],
+				Side:           normalizeImportSide(fields[importSide]),
+			},
+			Warning: warning,
+		})
+	}
+	return rowers, unmapped, nil
+}
+
+// Import adds the imported rowers to the crew, returning one error per rower,
+// nil for those that were added. Rowers are checked as if each had been added
+// on its own, except that a duplicate name only stops a rower when duplicates
+// are blocked.
+func (b *business) Import(ctx context.Context, key string, ins []rowerInput) ([]error, error) {
+	errs := make([]error, len(ins))
+	rowers := make([]*rower, len(ins))
+	for i, in := range ins {
+		if err := in.validateSignals(); err != nil {
+			errs[i] = err
+			continue
+		}
+		r, err := b.parseRower(in)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		rowers[i] = &r
+	}
+
+	var events []changeEvent
+	err := b.mutate(ctx, key, func(s *state) error {
+		added := 0
+		events = nil
+		for i, r := range rowers {
+			if r == nil {
+				continue
+			}
+			if err := b.admitRower(s, *r); err != nil {
+				errs[i] = err
+				continue
+			}
+			if b.cfg.DuplicateNames == duplicateNamesBlock && hasRowerNamed(s.Rowers, r.Name) {
+				errs[i] = ErrDuplicateName
+				continue
+			}
+			s.Rowers = append(s.Rowers, *r)
+			events = append(events, changeEvent{Type: changeCreate, Rower: r})
+			added++
+		}
+		if added == 0 {
+			return errNothingImported
+		}
+		slog.Info("Imported rowers", "count", added)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errNothingImported) {
+		return nil, err
+	}
+	b.publish(ctx, key, events...)
+	return errs, nil
+}
+
+// errNothingImported leaves the state unsaved when no rower could be imported.
+var errNothingImported = errors.New("nothing imported")
+
+// importDateLayouts are the date of birth layouts accepted on import, besides
+// dateOfBirthLayout. Club spreadsheets usually write dates day first.
+var importDateLayouts = []string{"02/01/2006", "2/1/2006", "02-01-2006", "02.01.2006", "2006-01-02 15:04:05"}
+
+// importAge reads an imported age value as a birth year or age, told apart as
+// in the form, or as a date of birth normalized to dateOfBirthLayout. warning
+// is set when the value could have been read another way. A value in no known
+// form is returned as a date of birth, to be reported when the rower is
+// created.
+func importAge(v string) (birthYearOrAge, dateOfBirth, warning string) {
+	if v == "" {
+		return "", "", ""
+	}
+	if _, err := strconv.Atoi(v); err == nil {
+		return v, "", ""
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+		n := strconv.Itoa(int(f))
+		return n, "", fmt.Sprintf("%s read as %s", v, n)
+	}
+	if _, err := time.Parse(dateOfBirthLayout, v); err == nil {
+		return "", v, ""
+	}
+	for _, layout := range importDateLayouts {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(layout, "2006") && t.Day() <= 12 && t.Day() != int(t.Month()) {
+			warning = fmt.Sprintf("%s is ambiguous, read day first as %s", v, t.Format("2 January 2006"))
+		}
+		return "", t.Format(dateOfBirthLayout), warning
+	}
+	return "", v, ""
+}
+
+// normalizeImportSide normalizes the ways rosters record a rower's side. Stroke side
+// is port and bow side is starboard.
+func normalizeImportSide(v string) string {
+	switch strings.ToLower(v) {
+	case "p", "port", "stroke", "stroke side":
+		return string(sidePort)
+	case "s", "starboard", "bow", "bow side":
+		return string(sideStarboard)
+	case "b", "both", "either":
+		return string(sideBoth)
+	case "x", "scull", "sculler", "sculling":
+		return string(sideScull)
+	default:
+		return strings.ToLower(v)
+	}
+}
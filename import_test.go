@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadImportRoster(t *testing.T) {
+	roster := "\ufeffFirst Name,Surname,DOB,Club,Rowing Side,Membership No\n" +
+		"Alex,Morgan,14/03/1981,Tideway,Stroke,1001\n" +
+		"Blake,Hill,1974-07-30,Thames,bow side,1002\n" +
+		",,,,,\n" +
+		"Casey,Jones,05/04/1968,Tideway,x,1003\n"
+
+	rowers, unmapped, err := readImport(strings.NewReader(roster), rosterColumns)
+	if err != nil {
+		t.Fatalf("readImport: %v", err)
+	}
+	want := []importedRower{
+		{Line: 2, Input: rowerInput{Name: "Alex Morgan", DateOfBirth: "1981-03-14", Club: "Tideway", Side: "port"}},
+		{Line: 3, Input: rowerInput{Name: "Blake Hill", DateOfBirth: "1974-07-30", Club: "Thames", Side: "starboard"}},
+		{Line: 5, Input: rowerInput{Name: "Casey Jones", DateOfBirth: "1968-04-05", Club: "Tideway", Side: "scull"}, Warning: "05/04/1968 is ambiguous, read day first as 5 April 1968"},
+	}
+	if !slices.Equal(rowers, want) {
+		t.Errorf("readImport rowers:\n got %+v\nwant %+v", rowers, want)
+	}
+	if want := []string{"Membership No"}; !slices.Equal(unmapped, want) {
+		t.Errorf("unmapped = %v, want %v", unmapped, want)
+	}
+}
+
+func TestReadImportEntry(t *testing.T) {
+	columns, err := importColumns("entry", defaultExportFields)
+	if err != nil {
+		t.Fatalf("importColumns: %v", err)
+	}
+	s := &state{Rowers: []rower{{Name: "Sam Cruz", BirthYear: 1980, Age: 46, Band: "C", Weight: 70, Club: "Tideway", Side: sidePort}}}
+	var export strings.Builder
+	if err := writeEntryCSV(&export, s, defaultExportFields); err != nil {
+		t.Fatalf("writeEntryCSV: %v", err)
+	}
+
+	rowers, _, err := readImport(strings.NewReader(export.String()), columns)
+	if err != nil {
+		t.Fatalf("readImport: %v", err)
+	}
+	if len(rowers) != 1 {
+		t.Fatalf("got %d rowers, want 1", len(rowers))
+	}
+	if in := rowers[0].Input; in.Name != "Sam Cruz" || in.BirthYearOrAge != "1980" || in.Side != "port" {
+		t.Errorf("re-imported rower = %+v", in)
+	}
+}
+
+func TestReadImportErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+	}{
+		{name: "empty", csv: ""},
+		{name: "no name column", csv: "DOB,Club\n1980-01-01,Tideway\n"},
+		{name: "name twice", csv: "Name,Full Name\nAlex,Alex\n"},
+		{name: "ragged row", csv: "Name,Club\nAlex\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := readImport(strings.NewReader(tt.csv), rosterColumns); err == nil {
+				t.Error("readImport succeeded, want an error")
+			}
+		})
+	}
+	if _, err := importColumns("concept2", defaultExportFields); err == nil {
+		t.Error("importColumns with an unknown format succeeded, want an error")
+	}
+}
+
+func TestImportAge(t *testing.T) {
+	tests := []struct {
+		in                                      string
+		birthYearOrAge, dateOfBirth, wantWarned string
+	}{
+		{in: "1975", birthYearOrAge: "1975"},
+		{in: "51", birthYearOrAge: "51"},
+		{in: "51.5", birthYearOrAge: "51", wantWarned: "51.5 read as 51"},
+		{in: "1975-06-01", dateOfBirth: "1975-06-01"},
+		{in: "25/12/1975", dateOfBirth: "1975-12-25"},
+		{in: "12/12/1975", dateOfBirth: "1975-12-12"},
+		{in: "03/04/1975", dateOfBirth: "1975-04-03", wantWarned: "03/04/1975 is ambiguous, read day first as 3 April 1975"},
+		{in: "sometime", dateOfBirth: "sometime"},
+	}
+	for _, tt := range tests {
+		birthYearOrAge, dateOfBirth, warning := importAge(tt.in)
+		if birthYearOrAge != tt.birthYearOrAge || dateOfBirth != tt.dateOfBirth || warning != tt.wantWarned {
+			t.Errorf("importAge(%q) = %q, %q, %q, want %q, %q, %q", tt.in, birthYearOrAge, dateOfBirth, warning, tt.birthYearOrAge, tt.dateOfBirth, tt.wantWarned)
+		}
+	}
+}
+
+func TestImportRowers(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	c := newTestClient(t, mux)
+	roster := "Name,Age,Side,Shirt\nAlex Morgan,44,port,M\nToo Young,12,,S\n"
+
+	w := c.mustDo(http.MethodPost, "/masterscalc/rowers/import?format=roster", roster, http.StatusOK)
+	var report importReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Imported != 1 || len(report.Errors) != 1 || !strings.HasPrefix(report.Errors[0], "line 3: ") {
+		t.Errorf("report = %+v, want one rower imported and an error on line 3", report)
+	}
+	if !slices.Equal(report.UnmappedColumns, []string{"Shirt"}) {
+		t.Errorf("UnmappedColumns = %v, want [Shirt]", report.UnmappedColumns)
+	}
+
+	body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String()
+	if !strings.Contains(body, "<td>Alex Morgan</td>") {
+		t.Errorf("print page does not show the imported rower:\n%s", body)
+	}
+
+	c.mustDo(http.MethodPost, "/masterscalc/rowers/import?format=concept2", roster, http.StatusBadRequest)
+}
+
+func TestImportMixedAges(t *testing.T) {
+	roster := "Name,Date of Birth\n" +
+		"Alex,1975\n" +
+		"Blake,44\n" +
+		"Casey,1980-06-16\n" +
+		"Dana,25/12/1970\n" +
+		"Eve,03/04/1960\n" +
+		"Finn,61.7\n"
+	imported, _, err := readImport(strings.NewReader(roster), rosterColumns)
+	if err != nil {
+		t.Fatalf("readImport: %v", err)
+	}
+	var ins []rowerInput
+	var warnings []string
+	for _, r := range imported {
+		ins = append(ins, r.Input)
+		if r.Warning != "" {
+			warnings = append(warnings, r.Warning)
+		}
+	}
+
+	b := newTestBusiness(t, testBusinessConfig())
+	errs, err := b.Import(context.Background(), "crew", ins)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("rower %d: %v", i, err)
+		}
+	}
+
+	want := []struct {
+		name string
+		age  int
+		band string
+	}{
+		{name: "Alex", age: 51, band: "D"},
+		{name: "Blake", age: 44, band: "C"},
+		// The birthday is the day after testNow.
+		{name: "Casey", age: 45, band: "C"},
+		{name: "Dana", age: 55, band: "E"},
+		{name: "Eve", age: 66, band: "G"},
+		{name: "Finn", age: 61, band: "F"},
+	}
+	rowers := mustGet(t, b, "crew").Rowers
+	if len(rowers) != len(want) {
+		t.Fatalf("imported %d rowers, want %d", len(rowers), len(want))
+	}
+	for i, w := range want {
+		if r := rowers[i]; r.Name != w.name || r.Age != w.age || r.Band != w.band {
+			t.Errorf("rower %d = %s aged %d in %s, want %s aged %d in %s", i, r.Name, r.Age, r.Band, w.name, w.age, w.band)
+		}
+	}
+	wantWarnings := []string{"03/04/1960 is ambiguous, read day first as 3 April 1960", "61.7 read as 61"}
+	if !slices.Equal(warnings, wantWarnings) {
+		t.Errorf("warnings = %v, want %v", warnings, wantWarnings)
+	}
+}
+
+// largeImport returns n rowers, enough to outgrow a small store.
+func largeImport(n int) []rowerInput {
+	ins := make([]rowerInput, n)
+	for i := range ins {
+		ins[i] = rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44", Club: "Tideway"}
+	}
+	return ins
+}
+
+func TestImportTooLargeForStore(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.MaxStateBytes = 2048
+	b := newTestBusiness(t, cfg)
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+	if _, err := b.Import(context.Background(), "crew", largeImport(100)); !errors.Is(err, ErrStateTooLarge) {
+		t.Fatalf("Import = %v, want %v", err, ErrStateTooLarge)
+	}
+	if n := len(mustGet(t, b, "crew").Rowers); n != 1 {
+		t.Errorf("crew has %d rowers after the rejected import, want 1", n)
+	}
+
+	mux := newTestApp(t, b, testApplicationConfig())
+	var roster strings.Builder
+	roster.WriteString("Name,Age\n")
+	for _, in := range largeImport(100) {
+		fmt.Fprintf(&roster, "%s,%s\n", in.Name, in.BirthYearOrAge)
+	}
+	w := newTestClient(t, mux).mustDo(http.MethodPost, "/masterscalc/rowers/import?format=roster", roster.String(), http.StatusRequestEntityTooLarge)
+	if !strings.Contains(w.Body.String(), ErrStateTooLarge.Error()) {
+		t.Errorf("response = %q, want it to say %q", w.Body, ErrStateTooLarge)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWatcherMaxStall is how long a watcher's write may block before the
+// janitor stops it, unless configured otherwise.
+const defaultWatcherMaxStall = time.Minute
+
+// watcherJanitor tracks the open watch connections and force-stops any whose
+// write has been blocked for longer than maxStall, for example on a client
+// that stopped reading without closing its connection. Cancelling the request
+// alone does not unblock such a write, so each watcher supplies its own stop.
+type watcherJanitor struct {
+	maxStall time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	watchers map[*trackedWatcher]struct{}
+}
+
+type trackedWatcher struct {
+	stop func()
+	// shutdown tells the client the server is going away, then stops the
+	// watcher.
+	shutdown func()
+
+	// writingSince is when the current write started, in Unix nanoseconds, or
+	// zero between writes.
+	writingSince atomic.Int64
+	stopped      atomic.Bool
+}
+
+func newWatcherJanitor(maxStall time.Duration) *watcherJanitor {
+	return &watcherJanitor{maxStall: maxStall, now: time.Now, watchers: map[*trackedWatcher]struct{}{}}
+}
+
+// track registers a watcher, returning it and a func to call once it exits.
+func (j *watcherJanitor) track(stop, shutdown func()) (*trackedWatcher, func()) {
+	w := &trackedWatcher{stop: stop, shutdown: shutdown}
+	j.mu.Lock()
+	j.watchers[w] = struct{}{}
+	j.mu.Unlock()
+	return w, func() {
+		j.mu.Lock()
+		delete(j.watchers, w)
+		j.mu.Unlock()
+	}
+}
+
+// write runs fn, a write to the watcher's client, marking the watcher as
+// writing for the duration.
+func (j *watcherJanitor) write(w *trackedWatcher, fn func() error) error {
+	w.writingSince.Store(j.now().UnixNano())
+	defer w.writingSince.Store(0)
+	return fn()
+}
+
+// Active returns the number of open watchers.
+func (j *watcherJanitor) Active() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.watchers)
+}
+
+// Run reaps stalled watchers until ctx is cancelled.
+func (j *watcherJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(j.maxStall/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reaped := j.reap(); reaped > 0 {
+				slog.Warn("Stopped stalled watchers", "stopped", reaped, "active", j.Active())
+			} else {
+				slog.Debug("Checked watchers", "active", j.Active())
+			}
+		}
+	}
+}
+
+// Shutdown tells every open watcher's client that the server is going away and
+// stops the watcher. Watchers are shut down concurrently so that a stalled
+// client does not hold up the others.
+func (j *watcherJanitor) Shutdown() {
+	j.mu.Lock()
+	watchers := make([]*trackedWatcher, 0, len(j.watchers))
+	for w := range j.watchers {
+		watchers = append(watchers, w)
+	}
+	j.mu.Unlock()
+
+	slog.Info("Shutting down watchers", "active", len(watchers))
+	for _, w := range watchers {
+		if !w.stopped.Swap(true) {
+			go w.shutdown()
+		}
+	}
+}
+
+// reap stops every watcher whose current write started more than maxStall ago,
+// returning how many it stopped.
+func (j *watcherJanitor) reap() int {
+	cutoff := j.now().Add(-j.maxStall).UnixNano()
+
+	j.mu.Lock()
+	var stalled []*trackedWatcher
+	for w := range j.watchers {
+		if since := w.writingSince.Load(); since != 0 && since < cutoff && !w.stopped.Load() {
+			stalled = append(stalled, w)
+		}
+	}
+	j.mu.Unlock()
+
+	for _, w := range stalled {
+		if !w.stopped.Swap(true) {
+			w.stop()
+		}
+	}
+	return len(stalled)
+}
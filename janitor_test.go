@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatcherJanitorReapsStalledWatcher(t *testing.T) {
+	j := newWatcherJanitor(time.Minute)
+	var now atomic.Pointer[time.Time]
+	now.Store(&testNow)
+	j.now = func() time.Time { return *now.Load() }
+
+	// The stuck watcher's write blocks until the watcher is stopped, like a
+	// write to a client that stopped reading.
+	unblock := make(chan struct{})
+	stuck, untrackStuck := j.track(func() { close(unblock) }, func() {})
+	errStopped := errors.New("stopped")
+	writeDone := make(chan error, 1)
+	go func() {
+		writeDone <- j.write(stuck, func() error {
+			<-unblock
+			return errStopped
+		})
+	}()
+	for stuck.writingSince.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var idleStops atomic.Int32
+	_, untrackIdle := j.track(func() { idleStops.Add(1) }, func() {})
+	defer untrackIdle()
+	if n := j.Active(); n != 2 {
+		t.Fatalf("Active = %d, want 2", n)
+	}
+
+	if n := j.reap(); n != 0 {
+		t.Errorf("reaped %d watchers before the threshold, want 0", n)
+	}
+
+	later := testNow.Add(time.Minute + time.Second)
+	now.Store(&later)
+	if n := j.reap(); n != 1 {
+		t.Errorf("reaped %d watchers after the threshold, want 1", n)
+	}
+	select {
+	case err := <-writeDone:
+		if !errors.Is(err, errStopped) {
+			t.Errorf("stuck write = %v, want it stopped", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stuck write was not stopped")
+	}
+	if n := idleStops.Load(); n != 0 {
+		t.Errorf("idle watcher stopped %d times, want 0", n)
+	}
+
+	untrackStuck()
+	if n := j.Active(); n != 1 {
+		t.Errorf("Active = %d after the stuck watcher exits, want 1", n)
+	}
+	if n := j.reap(); n != 0 {
+		t.Errorf("reaped %d watchers again, want 0", n)
+	}
+}
+
+func TestWatcherJanitorShutdown(t *testing.T) {
+	j := newWatcherJanitor(time.Minute)
+	shutdowns := make(chan struct{}, 2)
+	for range 2 {
+		_, untrack := j.track(func() {}, func() { shutdowns <- struct{}{} })
+		defer untrack()
+	}
+
+	j.Shutdown()
+	j.Shutdown()
+	for range 2 {
+		select {
+		case <-shutdowns:
+		case <-time.After(5 * time.Second):
+			t.Fatal("watcher was not shut down")
+		}
+	}
+	select {
+	case <-shutdowns:
+		t.Error("a watcher was shut down twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const keyedMutexShards = 32
+
+// keyedMutex hands out one mutex per key. Entries are reference counted and
+// removed once nobody holds or waits for them, so the map only ever contains
+// keys that are currently in use.
+type keyedMutex struct {
+	seed   maphash.Seed
+	shards [keyedMutexShards]keyedMutexShard
+}
+
+type keyedMutexShard struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+type refMutex struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	km := &keyedMutex{seed: maphash.MakeSeed()}
+	for i := range km.shards {
+		km.shards[i].locks = map[string]*refMutex{}
+	}
+	return km
+}
+
+// Lock locks the mutex for key and returns the function that unlocks it.
+func (km *keyedMutex) Lock(key string) (unlock func()) {
+	shard := &km.shards[maphash.String(km.seed, key)%keyedMutexShards]
+
+	shard.mu.Lock()
+	m, ok := shard.locks[key]
+	if !ok {
+		m = &refMutex{}
+		shard.locks[key] = m
+	}
+	m.refs++
+	shard.mu.Unlock()
+
+	m.mu.Lock()
+
+	return func() {
+		m.mu.Unlock()
+
+		shard.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(shard.locks, key)
+		}
+		shard.mu.Unlock()
+	}
+}
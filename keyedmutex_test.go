@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	km := newKeyedMutex()
+	const workers, rounds = 8, 200
+
+	var holders [2]atomic.Int32
+	var counts [2]int
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k := w % 2
+			for range rounds {
+				unlock := km.Lock("session-" + strconv.Itoa(k))
+				if n := holders[k].Add(1); n != 1 {
+					t.Errorf("%d goroutines hold the lock for session-%d", n, k)
+				}
+				counts[k]++
+				holders[k].Add(-1)
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for k, n := range counts {
+		if want := workers / 2 * rounds; n != want {
+			t.Errorf("session-%d count = %d, want %d", k, n, want)
+		}
+	}
+	for i := range km.shards {
+		if n := len(km.shards[i].locks); n != 0 {
+			t.Errorf("shard %d holds %d locks after every unlock", i, n)
+		}
+	}
+}
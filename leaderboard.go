@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// raceTime is a raw time entered for a crew, to compare on the leaderboard.
+type raceTime struct {
+	Crew string
+	Band string
+	Time time.Duration
+}
+
+// fieldTime is the leaderboard form, for validation errors.
+const fieldTime = "time"
+
+// raceTimeInput is a race time as entered in the leaderboard form.
+type raceTimeInput struct {
+	Crew string `json:"timeCrew"`
+	Band string `json:"timeBand"`
+	Time string `json:"timeRaw"`
+}
+
+// leaderboardRow is a race time as ranked, with its handicap applied.
+type leaderboardRow struct {
+	Index     int
+	Rank      int
+	Handicap  time.Duration
+	Corrected time.Duration
+	raceTime
+}
+
+// handicaps is the time allowance, per band, subtracted from a crew's raw time.
+type handicaps map[string]time.Duration
+
+// defaultHandicaps are illustrative allowances that grow with the band.
+// Regattas publish their own tables, which can be set with HANDICAPS.
+var defaultHandicaps = handicaps{
+	"A": 0,
+	"B": 3 * time.Second,
+	"C": 7 * time.Second,
+	"D": 12 * time.Second,
+	"E": 17 * time.Second,
+	"F": 22 * time.Second,
+	"G": 28 * time.Second,
+	"H": 35 * time.Second,
+	"I": 43 * time.Second,
+	"J": 52 * time.Second,
+	"K": 62 * time.Second,
+}
+
+// parseHandicaps parses comma-separated Band=seconds pairs, e.g.
+// "A=0,B=3.5". Bands that are not listed get no allowance.
+func parseHandicaps(v string) (handicaps, error) {
+	h := handicaps{}
+	for pair := range strings.SplitSeq(v, ",") {
+		band, seconds, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid handicap %q: must be Band=seconds", pair)
+		}
+		if !knownBand(band) {
+			return nil, fmt.Errorf("invalid handicap %q: unknown band %q", pair, band)
+		}
+		s, err := strconv.ParseFloat(seconds, 64)
+		if err != nil || s < 0 {
+			return nil, fmt.Errorf("invalid handicap %q: seconds must be a non-negative number", pair)
+		}
+		h[band] = time.Duration(s * float64(time.Second))
+	}
+	return h, nil
+}
+
+// parseRaceTime parses a time given as seconds ("245.3") or as minutes and
+// seconds ("4:05.3").
+func parseRaceTime(v string) (time.Duration, error) {
+	minutes, seconds := "0", strings.TrimSpace(v)
+	if m, s, ok := strings.Cut(seconds, ":"); ok {
+		minutes, seconds = m, s
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("invalid time %q: must be like 4:05.3", v)
+	}
+	s, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || s < 0 || math.IsInf(s, 0) || (m > 0 && s >= 60) {
+		return 0, fmt.Errorf("invalid time %q: must be like 4:05.3", v)
+	}
+	d := time.Duration(m)*time.Minute + time.Duration(s*float64(time.Second))
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid time %q: must be more than zero", v)
+	}
+	return d, nil
+}
+
+// formatRaceTime formats d as minutes and seconds to a tenth, e.g. "4:05.3".
+func formatRaceTime(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	d = d.Round(100 * time.Millisecond)
+	return fmt.Sprintf("%s%d:%04.1f", sign, int(d/time.Minute), (d % time.Minute).Seconds())
+}
+
+// AddTime records a raw race time for a crew. A blank band uses the current
+// crew's category.
+func (b *business) AddTime(ctx context.Context, key string, in raceTimeInput) error {
+	crew := strings.TrimSpace(in.Crew)
+	if crew == "" {
+		return &validationError{Field: fieldTime, Err: errors.New("crew name is required")}
+	}
+	if utf8.RuneCountInString(crew) > maxNameLength {
+		return &validationError{Field: fieldTime, Err: fmt.Errorf("crew name must be at most %d characters", maxNameLength)}
+	}
+	band := strings.ToUpper(strings.TrimSpace(in.Band))
+	if band != "" && !knownBand(band) {
+		return &validationError{Field: fieldTime, Err: fmt.Errorf("unknown band %q", in.Band)}
+	}
+	t, err := parseRaceTime(in.Time)
+	if err != nil {
+		return &validationError{Field: fieldTime, Err: err}
+	}
+
+	err = b.mutate(ctx, key, func(s *state) error {
+		rt := raceTime{Crew: crew, Band: band, Time: t}
+		if rt.Band == "" {
+			rt.Band = b.crewBand(key, s)
+			if rt.Band == "" {
+				return &validationError{Field: fieldTime, Err: errors.New("band is required when the crew has no category")}
+			}
+		}
+		slog.Info("Added race time", "time", rt)
+		s.Times = append(s.Times, rt)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: "added race time for " + crew})
+	return nil
+}
+
+// DeleteTime removes the race time at index.
+func (b *business) DeleteTime(ctx context.Context, key string, index int) error {
+	var deleted raceTime
+	err := b.mutate(ctx, key, func(s *state) error {
+		if index < 0 || index >= len(s.Times) {
+			return fmt.Errorf("race time not found: %d", index)
+		}
+		deleted = s.Times[index]
+		s.Times = slices.Delete(s.Times, index, index+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: "deleted race time for " + deleted.Crew})
+	return nil
+}
+
+// Leaderboard ranks the race times by their handicap-corrected time, fastest
+// first.
+func (b *business) Leaderboard(s *state) []leaderboardRow {
+	rows := make([]leaderboardRow, len(s.Times))
+	for i, t := range s.Times {
+		handicap := b.cfg.Handicaps[t.Band]
+		rows[i] = leaderboardRow{Index: i, Handicap: handicap, Corrected: t.Time - handicap, raceTime: t}
+	}
+	slices.SortStableFunc(rows, func(a, b leaderboardRow) int { return cmp.Compare(a.Corrected, b.Corrected) })
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+	return rows
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLeaderboard(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.Handicaps = handicaps{"A": 0, "C": 10 * time.Second, "F": 30 * time.Second}
+	b := newTestBusiness(t, cfg)
+
+	s := &state{Times: []raceTime{
+		{Crew: "Young", Band: "A", Time: 400 * time.Second},
+		{Crew: "Masters", Band: "C", Time: 405 * time.Second},
+		{Crew: "Veterans", Band: "F", Time: 420 * time.Second},
+		{Crew: "Unlisted", Band: "K", Time: 398 * time.Second},
+	}}
+	rows := b.Leaderboard(s)
+
+	tests := []struct {
+		crew      string
+		index     int
+		handicap  time.Duration
+		corrected time.Duration
+	}{
+		{crew: "Veterans", index: 2, handicap: 30 * time.Second, corrected: 390 * time.Second},
+		{crew: "Masters", index: 1, handicap: 10 * time.Second, corrected: 395 * time.Second},
+		{crew: "Unlisted", index: 3, handicap: 0, corrected: 398 * time.Second},
+		{crew: "Young", index: 0, handicap: 0, corrected: 400 * time.Second},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		row := rows[i]
+		if row.Crew != tt.crew || row.Rank != i+1 || row.Index != tt.index {
+			t.Errorf("row %d = %s rank %d index %d, want %s rank %d index %d", i, row.Crew, row.Rank, row.Index, tt.crew, i+1, tt.index)
+		}
+		if row.Handicap != tt.handicap || row.Corrected != tt.corrected {
+			t.Errorf("%s: handicap %v corrected %v, want %v and %v", row.Crew, row.Handicap, row.Corrected, tt.handicap, tt.corrected)
+		}
+	}
+}
+
+func TestLeaderboardTiesKeepEntryOrder(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	s := &state{Times: []raceTime{
+		{Crew: "First", Band: "A", Time: 403 * time.Second},
+		{Crew: "Second", Band: "B", Time: 406 * time.Second},
+	}}
+	var got []string
+	for _, row := range b.Leaderboard(s) {
+		got = append(got, row.Crew)
+	}
+	if want := []string{"First", "Second"}; !slices.Equal(got, want) {
+		t.Errorf("Leaderboard = %v, want %v", got, want)
+	}
+}
+
+func TestAddTime(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Ann", BirthYearOrAge: "45"})
+
+	if err := b.AddTime(ctx, "crew", raceTimeInput{Crew: "Ours", Time: "6:40.5"}); err != nil {
+		t.Fatalf("AddTime: %v", err)
+	}
+	if err := b.AddTime(ctx, "crew", raceTimeInput{Crew: "Theirs", Band: "f", Time: "395"}); err != nil {
+		t.Fatalf("AddTime: %v", err)
+	}
+	want := []raceTime{
+		{Crew: "Ours", Band: "C", Time: 6*time.Minute + 40500*time.Millisecond},
+		{Crew: "Theirs", Band: "F", Time: 395 * time.Second},
+	}
+	if got := mustGet(t, b, "crew").Times; !slices.Equal(got, want) {
+		t.Errorf("Times = %v, want %v", got, want)
+	}
+
+	if err := b.DeleteTime(ctx, "crew", 0); err != nil {
+		t.Fatalf("DeleteTime: %v", err)
+	}
+	if got := mustGet(t, b, "crew").Times; !slices.Equal(got, want[1:]) {
+		t.Errorf("Times after delete = %v, want %v", got, want[1:])
+	}
+}
+
+func TestAddTimeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   raceTimeInput
+	}{
+		{name: "no crew", in: raceTimeInput{Band: "A", Time: "400"}},
+		{name: "unknown band", in: raceTimeInput{Crew: "Ours", Band: "Z", Time: "400"}},
+		{name: "bad time", in: raceTimeInput{Crew: "Ours", Band: "A", Time: "four"}},
+		{name: "no band and no crew category", in: raceTimeInput{Crew: "Ours", Time: "400"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			counting := &putCountingStore{store: b.s}
+			b.s = counting
+			err := b.AddTime(context.Background(), "crew", tt.in)
+			var verr *validationError
+			if !errors.As(err, &verr) || verr.Field != fieldTime {
+				t.Errorf("AddTime = %v, want a %s validation error", err, fieldTime)
+			}
+			if n := counting.puts.Load(); n != 0 {
+				t.Errorf("rejected AddTime saved the crew %d times, want 0", n)
+			}
+		})
+	}
+}
+
+func TestParseRaceTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "245.3", want: 245300 * time.Millisecond},
+		{in: "4:05.3", want: 245300 * time.Millisecond},
+		{in: " 0:59 ", want: 59 * time.Second},
+		{in: "4:60", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "0", wantErr: true},
+		{in: "x:05", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRaceTime(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRaceTime(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRaceTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRaceTime(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{in: 245300 * time.Millisecond, want: "4:05.3"},
+		{in: 59960 * time.Millisecond, want: "1:00.0"},
+		{in: -3 * time.Second, want: "-0:03.0"},
+	}
+	for _, tt := range tests {
+		if got := formatRaceTime(tt.in); got != tt.want {
+			t.Errorf("formatRaceTime(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseHandicaps(t *testing.T) {
+	got, err := parseHandicaps("A=0, B=3.5")
+	if err != nil {
+		t.Fatalf("parseHandicaps: %v", err)
+	}
+	if got["A"] != 0 || got["B"] != 3500*time.Millisecond || len(got) != 2 {
+		t.Errorf("parseHandicaps = %v", got)
+	}
+	for _, v := range []string{"A", "Z=1", "A=-1", "A=x"} {
+		if _, err := parseHandicaps(v); err == nil {
+			t.Errorf("parseHandicaps(%q) succeeded, want an error", v)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// boatClass describes the seats of a boat.
+type boatClass struct {
+	Name   string
+	Seats  int
+	Cox    int
+	Sculls bool
+}
+
+var defaultBoatClasses = []boatClass{
+	{Name: "1x", Seats: 1, Sculls: true},
+	{Name: "2x", Seats: 2, Sculls: true},
+	{Name: "4x", Seats: 4, Sculls: true},
+	{Name: "4x+", Seats: 4, Cox: 1, Sculls: true},
+	{Name: "8x", Seats: 8, Sculls: true},
+	{Name: "8x+", Seats: 8, Cox: 1, Sculls: true},
+	{Name: "2-", Seats: 2},
+	{Name: "2+", Seats: 2, Cox: 1},
+	{Name: "4-", Seats: 4},
+	{Name: "4+", Seats: 4, Cox: 1},
+	{Name: "8+", Seats: 8, Cox: 1},
+}
+
+// parseBoatClasses parses comma-separated boat classes given as name=rowers,
+// or name=rowers+coxes for coxed boats. Classes whose name contains an "x"
+// are sculling boats.
+func parseBoatClasses(v string) ([]boatClass, error) {
+	var classes []boatClass
+	for entry := range strings.SplitSeq(v, ",") {
+		name, counts, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid boat class %q: must be name=rowers or name=rowers+coxes", entry)
+		}
+		if slices.ContainsFunc(classes, func(c boatClass) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("invalid boat class %q: %s is listed twice", entry, name)
+		}
+		seats, cox, coxed := strings.Cut(counts, "+")
+		class := boatClass{Name: name, Sculls: strings.Contains(name, "x")}
+		var err error
+		if class.Seats, err = strconv.Atoi(seats); err != nil || class.Seats < 1 {
+			return nil, fmt.Errorf("invalid boat class %q: rowers must be a positive whole number", entry)
+		}
+		if coxed {
+			if class.Cox, err = strconv.Atoi(cox); err != nil || class.Cox < 1 {
+				return nil, fmt.Errorf("invalid boat class %q: coxes must be a positive whole number", entry)
+			}
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// ErrNoLineup is returned when the crew cannot be seated in the requested boat.
+var ErrNoLineup = errors.New("no valid lineup")
+
+// seat is one rower's place in a suggested lineup. Seat 1 is bow.
+type seat struct {
+	Seat  int    `json:"seat"`
+	Label string `json:"label"`
+	Side  side   `json:"side"`
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+}
+
+func (b *business) findBoatClass(name string) (boatClass, bool) {
+	// An unencoded "+" in a query string arrives as a space.
+	name = strings.ReplaceAll(name, " ", "+")
+	i := slices.IndexFunc(b.cfg.BoatClasses, func(c boatClass) bool { return c.Name == name })
+	if i < 0 {
+		return boatClass{}, false
+	}
+	return b.cfg.BoatClasses[i], true
+}
+
+// checkCrewSize checks that a crew of n fits class: one rower per seat, plus
+// optionally the coxes of a coxed boat, entered last.
+func (class boatClass) checkCrewSize(n int) error {
+	if n == class.Seats || (class.Cox > 0 && n == class.Seats+class.Cox) {
+		return nil
+	}
+	if class.Cox > 0 {
+		return fmt.Errorf("%w: a %s needs %d rowers, or %d with the cox, but the crew has %d", ErrNoLineup, class.Name, class.Seats, class.Seats+class.Cox, n)
+	}
+	return fmt.Errorf("%w: a %s needs %d rowers but the crew has %d", ErrNoLineup, class.Name, class.Seats, n)
+}
+
+// fittingBoatClasses returns the names of the boat classes a crew of n is the
+// right size for, in the configured order.
+func (b *business) fittingBoatClasses(n int) []string {
+	var names []string
+	for _, class := range b.cfg.BoatClasses {
+		if class.checkCrewSize(n) == nil {
+			names = append(names, class.Name)
+		}
+	}
+	return names
+}
+
+// SuggestLineup seats the crew in the given boat class. In sweep boats the
+// even seats are rigged on port and the odd seats on starboard, rowers who
+// only row one side are placed on that side and the rest fill the gaps. In a
+// coxed boat the crew members beyond the seats are the coxes.
+func (b *business) SuggestLineup(s *state, boat string) ([]seat, error) {
+	class, ok := b.findBoatClass(boat)
+	if !ok {
+		return nil, fmt.Errorf("unknown boat class %q", boat)
+	}
+	if err := class.checkCrewSize(len(s.Rowers)); err != nil {
+		return nil, err
+	}
+
+	lineup, err := seatRowers(class, s.Rowers[:class.Seats])
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range s.Rowers[class.Seats:] {
+		lineup = append(lineup, seat{Seat: class.Seats + i + 1, Label: "Cox", Name: r.Name, Index: class.Seats + i})
+	}
+	return lineup, nil
+}
+
+// seatRowers seats one rower in each of class's seats.
+func seatRowers(class boatClass, rowers []rower) ([]seat, error) {
+	lineup := make([]seat, class.Seats)
+	for i := range lineup {
+		lineup[i].Seat = i + 1
+		lineup[i].Label = seatLabel(i+1, class.Seats)
+		lineup[i].Index = -1
+	}
+
+	if class.Sculls {
+		for i, r := range rowers {
+			if r.Side == sidePort || r.Side == sideStarboard {
+				return nil, fmt.Errorf("%w: %s only rows %s side", ErrNoLineup, r.Name, r.Side)
+			}
+			lineup[i].Side = sideScull
+			lineup[i].Name = r.Name
+			lineup[i].Index = i
+		}
+		return lineup, nil
+	}
+
+	for i := range lineup {
+		if lineup[i].Seat%2 == 0 {
+			lineup[i].Side = sidePort
+		} else {
+			lineup[i].Side = sideStarboard
+		}
+	}
+
+	place := func(index int, r rower, wanted side) bool {
+		for i := range lineup {
+			if lineup[i].Index < 0 && (wanted == sideBoth || lineup[i].Side == wanted) {
+				lineup[i].Name = r.Name
+				lineup[i].Index = index
+				return true
+			}
+		}
+		return false
+	}
+
+	// Seat the one-sided rowers first so that flexible rowers fill the gaps.
+	for _, wanted := range []side{sidePort, sideStarboard, sideBoth} {
+		for i, r := range rowers {
+			rowerSide := r.Side
+			if rowerSide == "" {
+				rowerSide = sideBoth
+			}
+			if rowerSide == sideScull {
+				return nil, fmt.Errorf("%w: %s only sculls", ErrNoLineup, r.Name)
+			}
+			if rowerSide != wanted {
+				continue
+			}
+			if !place(i, r, wanted) {
+				return nil, fmt.Errorf("%w: too many %s-side rowers for a %s", ErrNoLineup, wanted, class.Name)
+			}
+		}
+	}
+
+	return lineup, nil
+}
+
+func seatLabel(seat, seats int) string {
+	switch {
+	case seats == 1:
+		return "Single"
+	case seat == seats:
+		return "Stroke"
+	case seat == 1:
+		return "Bow"
+	default:
+		return strconv.Itoa(seat)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestSuggestLineup(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	s := &state{Rowers: []rower{
+		{Name: "Alex", Side: sidePort},
+		{Name: "Blake", Side: sideStarboard},
+		{Name: "Casey", Side: sideBoth},
+		{Name: "Dana", Side: sidePort},
+		{Name: "Eli"},
+	}}
+
+	lineup, err := b.SuggestLineup(s, "4+")
+	if err != nil {
+		t.Fatalf("SuggestLineup: %v", err)
+	}
+	want := []seat{
+		{Seat: 1, Label: "Bow", Side: sideStarboard, Name: "Blake", Index: 1},
+		{Seat: 2, Label: "2", Side: sidePort, Name: "Alex", Index: 0},
+		{Seat: 3, Label: "3", Side: sideStarboard, Name: "Casey", Index: 2},
+		{Seat: 4, Label: "Stroke", Side: sidePort, Name: "Dana", Index: 3},
+		{Seat: 5, Label: "Cox", Name: "Eli", Index: 4},
+	}
+	if !slices.Equal(lineup, want) {
+		t.Errorf("SuggestLineup = %+v, want %+v", lineup, want)
+	}
+
+	// An unencoded "+" in the query string arrives as a space.
+	if _, err := b.SuggestLineup(s, "4 "); err != nil {
+		t.Errorf("SuggestLineup(%q): %v", "4 ", err)
+	}
+}
+
+func TestSuggestLineupImpossible(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	tests := []struct {
+		name  string
+		boat  string
+		sides []side
+	}{
+		{name: "all port", boat: "4-", sides: []side{sidePort, sidePort, sidePort, sidePort}},
+		{name: "sculler in a sweep boat", boat: "2-", sides: []side{sideScull, sideBoth}},
+		{name: "sweep rower in a sculling boat", boat: "2x", sides: []side{sideStarboard, sideBoth}},
+		{name: "too few rowers", boat: "4+", sides: []side{sideBoth, sideBoth, sideBoth}},
+		{name: "too many rowers", boat: "4-", sides: []side{sideBoth, sideBoth, sideBoth, sideBoth, sideBoth}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &state{}
+			for _, sd := range tt.sides {
+				s.Rowers = append(s.Rowers, rower{Name: "Rower", Side: sd})
+			}
+			if _, err := b.SuggestLineup(s, tt.boat); !errors.Is(err, ErrNoLineup) {
+				t.Errorf("SuggestLineup = %v, want ErrNoLineup", err)
+			}
+		})
+	}
+
+	if _, err := b.SuggestLineup(&state{}, "3x"); err == nil || errors.Is(err, ErrNoLineup) {
+		t.Errorf("SuggestLineup of an unknown boat = %v, want an unknown boat class error", err)
+	}
+}
+
+func TestParseBoatClasses(t *testing.T) {
+	classes, err := parseBoatClasses("1x=1, 4+=4+1,C2=2")
+	if err != nil {
+		t.Fatalf("parseBoatClasses: %v", err)
+	}
+	want := []boatClass{
+		{Name: "1x", Seats: 1, Sculls: true},
+		{Name: "4+", Seats: 4, Cox: 1},
+		{Name: "C2", Seats: 2},
+	}
+	if !slices.Equal(classes, want) {
+		t.Errorf("parseBoatClasses = %+v, want %+v", classes, want)
+	}
+	for _, v := range []string{"1x", "=1", "1x=0", "4+=4+0", "2x=2,2x=2"} {
+		if _, err := parseBoatClasses(v); err == nil {
+			t.Errorf("parseBoatClasses accepted %q", v)
+		}
+	}
+}
+
+func TestCheckCrewSize(t *testing.T) {
+	tests := []struct {
+		class  string
+		rowers int
+		ok     bool
+	}{
+		{class: "1x", rowers: 1, ok: true},
+		{class: "1x", rowers: 2},
+		{class: "2-", rowers: 2, ok: true},
+		{class: "2-", rowers: 3},
+		{class: "4+", rowers: 4, ok: true},
+		{class: "4+", rowers: 5, ok: true},
+		{class: "4+", rowers: 6},
+		{class: "4-", rowers: 5},
+		{class: "8+", rowers: 9, ok: true},
+		{class: "8+", rowers: 7},
+	}
+	b := newTestBusiness(t, testBusinessConfig())
+	for _, tt := range tests {
+		class, ok := b.findBoatClass(tt.class)
+		if !ok {
+			t.Fatalf("boat class %s not found", tt.class)
+		}
+		err := class.checkCrewSize(tt.rowers)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s with %d: checkCrewSize = %v, want ok %v", tt.class, tt.rowers, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrNoLineup) {
+			t.Errorf("%s with %d: error %v is not ErrNoLineup", tt.class, tt.rowers, err)
+		}
+	}
+}
+
+func TestBoatClassesSignal(t *testing.T) {
+	tests := []struct {
+		rowers int
+		want   string
+	}{
+		{rowers: 1, want: "1x"},
+		{rowers: 3, want: "2+"},
+		{rowers: 5, want: "4x+, 4+"},
+		{rowers: 10, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.rowers), func(t *testing.T) {
+			b := newTestBusiness(t, testBusinessConfig())
+			for i := range tt.rowers {
+				mustCreate(t, b, "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44"})
+			}
+			if got := mustGet(t, b, "crew").Signals.BoatClasses; got != tt.want {
+				t.Errorf("BoatClasses = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
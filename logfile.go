@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// logFile is an append-only log file. When maxBytes is positive the file is
+// rotated once it would grow beyond that size, keeping a single previous file
+// with a ".1" suffix.
+type logFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	f        *os.File
+	size     int64
+}
+
+func openLogFile(path string, maxBytes int64) (*logFile, error) {
+	lf := &logFile{path: path, maxBytes: maxBytes}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.maxBytes > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxBytes {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.f.Close()
+}
+
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not stat log file: %w", err)
+	}
+	lf.f = f
+	lf.size = info.Size()
+	return nil
+}
+
+func (lf *logFile) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return fmt.Errorf("could not close log file: %w", err)
+	}
+	if err := os.Rename(lf.path, lf.path+".1"); err != nil {
+		return fmt.Errorf("could not rotate log file: %w", err)
+	}
+	return lf.open()
+}
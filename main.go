@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"embed"
-	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/delaneyj/toolbelt/embeddednats"
 	"github.com/gorilla/sessions"
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 )
 
@@ -21,25 +26,47 @@ import (
 var staticFiles embed.FS
 
 func main() {
-	ctx := context.Background()
-	if err := run(ctx, os.Getenv, os.Stdout); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Getenv, os.Stdout); err != nil {
 		slog.Error("Error running server", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, getenv func(string) string, stdout io.Writer) error {
+func run(ctx context.Context, args []string, getenv func(string) string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("webserver", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	checkConfig := flags.Bool("check-config", getenv("CHECK_CONFIG") == "true", "validate the configuration and store, then exit without serving")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
 
-	slog.SetDefault(slog.New(slog.NewTextHandler(stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	cfg, err := loadConfig(getenv)
+	if err != nil {
+		return err
+	}
 
-	port := getenv("PORT")
-	if port == "" {
-		port = "8080"
+	logOutput := stdout
+	if cfg.LogFile != "" {
+		lf, err := openLogFile(cfg.LogFile, cfg.LogFileMaxBytes)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_FILE: %w", err)
+		}
+		defer func() { _ = lf.Close() }()
+
+		logOutput = io.MultiWriter(stdout, lf)
 	}
 
-	sessionSecret := getenv("SESSION_SECRET")
-	if sessionSecret == "" {
-		return fmt.Errorf("SESSION_SECRET environment variable is required")
+	slog.SetDefault(slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	slog.Info("Effective configuration", "config", cfg)
+
+	if cfg.EphemeralSessionKey {
+		slog.Warn("DEV_MODE: SESSION_SECRET is not set, using an ephemeral session key. Sessions will not survive a restart. Never use DEV_MODE in production.")
 	}
 
 	staticFS, err := fs.Sub(staticFiles, "static")
@@ -47,67 +74,360 @@ func run(ctx context.Context, getenv func(string) string, stdout io.Writer) erro
 		return fmt.Errorf("could not create static file system: %w", err)
 	}
 
-	decodedKey, err := base64.StdEncoding.DecodeString(sessionSecret)
+	compress, err := gzipMiddleware(cfg.GzipLevel)
 	if err != nil {
-		return fmt.Errorf("could not decode SESSION_SECRET: %w", err)
+		return fmt.Errorf("invalid GZIP_LEVEL: %w", err)
 	}
 
-	sessionStore := sessions.NewCookieStore(decodedKey)
-	sessionStore.MaxAge(86400 * 30)
-	sessionStore.Options.Path = "/"
-	sessionStore.Options.HttpOnly = true
-	sessionStore.Options.Secure = false
-	sessionStore.Options.SameSite = http.SameSiteLaxMode
-
-	ns, err := embeddednats.New(ctx, embeddednats.WithDirectory("/var/tmp/webserver"))
+	be, err := openStores(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("could not create NATS server: %w", err)
+		return err
 	}
-	ns.WaitForServer()
 
-	nc, err := ns.Client()
-	if err != nil {
-		return fmt.Errorf("error creating nats client: %w", err)
+	ready := be.ready
+	storeRetries := new(atomic.Int64)
+	var s store = newRetryStore(be.state, cfg.StoreRetryAttempts, cfg.StoreRetryBackoff, storeRetries)
+	if cfg.WatchSetupRate > 0 {
+		s = newWatchLimitStore(s, newWatchLimiter(cfg.WatchSetupRate, cfg.WatchSetupBurst))
 	}
+	archive := newRetryStore(be.archive, cfg.StoreRetryAttempts, cfg.StoreRetryBackoff, storeRetries)
+	audit := newRetryStore(be.audit, cfg.StoreRetryAttempts, cfg.StoreRetryBackoff, storeRetries)
 
-	js, err := jetstream.New(nc)
-	if err != nil {
-		return fmt.Errorf("error creating jetstream client: %w", err)
+	var sessionStore sessions.Store
+	var sessionOptions *sessions.Options
+	if be.sessions != nil {
+		kv := newKVSessionStore(newRetryStore(be.sessions, cfg.StoreRetryAttempts, cfg.StoreRetryBackoff, storeRetries), cfg.SessionKey)
+		kv.MaxAge(int(cfg.SessionMaxAge.Seconds()))
+		sessionStore, sessionOptions = kv, kv.Options
+	} else {
+		cs := sessions.NewCookieStore(cfg.SessionKey)
+		cs.MaxAge(int(cfg.SessionMaxAge.Seconds()))
+		sessionStore, sessionOptions = cs, cs.Options
 	}
+	sessionOptions.Path = "/"
+	sessionOptions.HttpOnly = true
+	sessionOptions.Secure = false
+	sessionOptions.SameSite = http.SameSiteLaxMode
+
+	cfg.Business.MaxStateBytes = be.maxValueSize
+	bus := newBusiness(s, archive, audit, be.events, cfg.Business)
 
-	cfg := jetstream.KeyValueConfig{
-		Bucket:      "rowingdata",
-		Description: "Masters Rowing Data",
-		Compression: true,
-		TTL:         time.Hour,
-		MaxBytes:    16 * 1024 * 1024,
+	if *checkConfig {
+		if _, err := newApplication(sessionStore, bus, cfg.Application); err != nil {
+			return fmt.Errorf("could not create application: %w", err)
+		}
+		if err := ready(); err != nil {
+			return fmt.Errorf("store is not ready: %w", err)
+		}
+		_, _ = fmt.Fprintln(stdout, "Configuration OK")
+		return nil
 	}
 
-	s, err := newStore(ctx, js, cfg)
+	if cfg.YearRolloverRecalc {
+		go bus.WatchYearRollover(ctx, time.Minute)
+	}
+
+	app, err := newApplication(sessionStore, bus, cfg.Application)
 	if err != nil {
-		return fmt.Errorf("could not create store: %w", err)
+		return fmt.Errorf("could not create application: %w", err)
 	}
+	go app.janitor.Run(ctx)
 
-	bus := newBusiness(s)
+	if cfg.PprofAddr != "" {
+		go servePprof(ctx, cfg.PprofAddr)
+	}
 
-	app, err := newApplication(sessionStore, bus)
+	manifest, err := manifestHandler(cfg.AppName)
 	if err != nil {
-		return fmt.Errorf("could not create application: %w", err)
+		return fmt.Errorf("could not create web manifest: %w", err)
+	}
+	serviceWorker, err := serviceWorkerHandler(staticFS)
+	if err != nil {
+		return fmt.Errorf("could not create service worker: %w", err)
 	}
 
-	mux := http.NewServeMux()
+	mux := newRouteMux()
+	if cfg.RootRedirect != "none" {
+		mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, cfg.RootRedirect, http.StatusFound)
+		})
+	}
 	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+	mux.HandleFunc("GET /favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, staticFS, "favicon.ico")
+	})
+	mux.HandleFunc("GET /manifest.json", manifest)
+	mux.HandleFunc("GET /static/sw.js", serviceWorker)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = fmt.Fprintf(w, "OK")
 	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(w, "OK")
+	})
 
 	app.registerRoutes(mux)
 
-	slog.Info("Server starting", "url", "http://localhost:"+port+"/masterscalc")
-	if err := http.ListenAndServe(":"+port, mux); err != http.ErrServerClosed {
+	if cfg.AdminToken != "" {
+		mux.HandleFunc("GET /debug/routes", requireAdmin(cfg.AdminToken, routesHandler(mux)))
+		mux.HandleFunc("GET /debug/stats", requireAdmin(cfg.AdminToken, statsHandler(storeRetries)))
+	}
+
+	timeout := timeoutMiddleware(cfg.RequestTimeout, func(r *http.Request) bool { return isStream(mux, r) })
+	errorPages := errorPageMiddleware(cfg.ErrorPage, cfg.AppName)
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: realIPMiddleware(cfg.TrustedProxies)(requestIDMiddleware(compress(errorPages(timeout(mux)))))}
+	if cfg.H2C {
+		// Serve unencrypted HTTP/2 alongside HTTP/1 for proxies that speak h2c,
+		// so the SSE stream shares one connection with the page's other requests.
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	// Streams never go idle, so Shutdown would wait on them until it timed out.
+	server.RegisterOnShutdown(app.janitor.Shutdown)
+
+	slog.Info("Server starting", "url", "http://localhost:"+cfg.Port+"/masterscalc")
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
 		return fmt.Errorf("error starting server: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Server shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		_ = server.Close()
+		return fmt.Errorf("could not shut down server: %w", err)
+	}
+
+	return nil
+}
+
+// backend holds the stores and event publisher of the configured store
+// backend, and a readiness check for it.
+type backend struct {
+	state   store
+	archive store
+	audit   store
+	events  publisher
+	ready   func() error
+
+	// sessions keeps server-side session data, or is nil when sessions are
+	// kept in the cookie.
+	sessions store
+
+	// maxValueSize is the largest value the state store takes, or zero when
+	// it has no limit worth checking.
+	maxValueSize int
+}
+
+// openStores opens the configured store backend.
+func openStores(ctx context.Context, cfg Config) (*backend, error) {
+	ttl := cfg.StateTTL
+
+	be := &backend{events: noopPublisher{}, ready: func() error { return nil }}
+	var err error
+
+	switch cfg.StoreBackend {
+	case "nats":
+		if err := ensureWritableDir(cfg.NATSDir); err != nil {
+			return nil, fmt.Errorf("invalid NATS_DIR: %w", err)
+		}
+
+		ns, err := startNATS(ctx, cfg.NATSDir, cfg.NATSStartupTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("could not start NATS server: %w", err)
+		}
+
+		nc, err := connectNATS(ns.NatsServer.ClientURL())
+		if err != nil {
+			return nil, fmt.Errorf("error creating nats client: %w", err)
+		}
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return nil, fmt.Errorf("error creating jetstream client: %w", err)
+		}
+
+		storage := jsStorageType(cfg.JSStorage)
+
+		be.state, err = newNATSStore(ctx, js, jetstream.KeyValueConfig{
+			Bucket:      cfg.KVBucket,
+			Description: cfg.KVDescription,
+			Compression: true,
+			Storage:     storage,
+			TTL:         ttl,
+			MaxBytes:    cfg.KVMaxBytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create store: %w", err)
+		}
+		// The payload limit applies to the value as sent; the bucket only
+		// compresses it once stored, so neither limit can count on that.
+		be.maxValueSize = int(min(nc.MaxPayload(), cfg.KVMaxBytes))
+
+		be.archive, err = newNATSStore(ctx, js, jetstream.KeyValueConfig{
+			Bucket:      cfg.ArchiveBucket,
+			Description: cfg.KVDescription + " (archive)",
+			Compression: true,
+			Storage:     storage,
+			TTL:         cfg.ArchiveTTL,
+			MaxBytes:    64 * 1024 * 1024,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create archive store: %w", err)
+		}
+
+		be.audit, err = newNATSStore(ctx, js, jetstream.KeyValueConfig{
+			Bucket:      cfg.AuditBucket,
+			Description: cfg.KVDescription + " (audit)",
+			Compression: true,
+			Storage:     storage,
+			TTL:         ttl,
+			MaxBytes:    16 * 1024 * 1024,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not create audit store: %w", err)
+		}
+
+		if cfg.SessionBackend == "nats" {
+			be.sessions, err = newNATSStore(ctx, js, jetstream.KeyValueConfig{
+				Bucket:      cfg.SessionBucket,
+				Description: cfg.KVDescription + " (sessions)",
+				Storage:     storage,
+				TTL:         cfg.SessionMaxAge,
+				MaxBytes:    16 * 1024 * 1024,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not create session store: %w", err)
+			}
+		}
+
+		if cfg.EventsSubject != "" {
+			be.events = newNATSPublisher(nc, cfg.EventsSubject)
+		}
+
+		be.ready = func() error {
+			if status := nc.Status(); status != nats.CONNECTED {
+				return fmt.Errorf("NATS %s", status)
+			}
+			return nil
+		}
+	case "memory":
+		state, archive, audit := newMemoryStore(ttl), newMemoryStore(cfg.ArchiveTTL), newMemoryStore(ttl)
+		for _, mem := range []*memoryStore{state, archive, audit} {
+			go mem.Run(ctx, memorySweepInterval)
+		}
+		be.state, be.archive, be.audit = state, archive, audit
+	case "redis":
+		be.state, err = newRedisStore(ctx, cfg.RedisURL, "state:", ttl)
+		if err != nil {
+			return nil, fmt.Errorf("could not create store: %w", err)
+		}
+
+		be.archive, err = newRedisStore(ctx, cfg.RedisURL, "archive:", cfg.ArchiveTTL)
+		if err != nil {
+			return nil, fmt.Errorf("could not create archive store: %w", err)
+		}
+
+		be.audit, err = newRedisStore(ctx, cfg.RedisURL, "audit:", ttl)
+		if err != nil {
+			return nil, fmt.Errorf("could not create audit store: %w", err)
+		}
 	}
 
+	if cfg.Namespace != "" {
+		be.state = newNamespacedStore(be.state, cfg.Namespace)
+		be.archive = newNamespacedStore(be.archive, cfg.Namespace)
+		be.audit = newNamespacedStore(be.audit, cfg.Namespace)
+		if be.sessions != nil {
+			be.sessions = newNamespacedStore(be.sessions, cfg.Namespace)
+		}
+	}
+
+	return be, nil
+}
+
+func ensureWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create directory %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("could not clean up write check in %s: %w", dir, err)
+	}
 	return nil
 }
+
+// jsStorageType returns the JetStream storage named by JS_STORAGE.
+func jsStorageType(name string) jetstream.StorageType {
+	if name == "memory" {
+		return jetstream.MemoryStorage
+	}
+	return jetstream.FileStorage
+}
+
+// startNATS starts the embedded NATS server in dir and waits up to timeout for
+// it to accept connections.
+func startNATS(ctx context.Context, dir string, timeout time.Duration) (ns *embeddednats.Server, err error) {
+	// embeddednats panics when the server cannot be created.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not create NATS server in %s: %v", dir, r)
+		}
+	}()
+
+	ns, err = embeddednats.New(ctx, embeddednats.WithDirectory(dir))
+	if err != nil {
+		return nil, fmt.Errorf("could not create NATS server in %s: %w", dir, err)
+	}
+
+	if !ns.NatsServer.ReadyForConnections(timeout) {
+		_ = ns.Close()
+		return nil, fmt.Errorf("NATS server in %s was not ready after %s; another instance may be using the directory, or it may be on a slow or full disk", dir, timeout)
+	}
+
+	return ns, nil
+}
+
+const (
+	natsMaxReconnects     = 60
+	natsReconnectBaseWait = 250 * time.Millisecond
+	natsReconnectMaxWait  = 10 * time.Second
+)
+
+// connectNATS connects to the NATS server at url, reconnecting with exponential
+// backoff when the connection drops. JetStream and key-value handles created
+// from the connection keep working once it has been re-established.
+func connectNATS(url string) (*nats.Conn, error) {
+	return nats.Connect(url,
+		nats.MaxReconnects(natsMaxReconnects),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			wait := natsReconnectBaseWait << min(attempts, 10)
+			return min(wait, natsReconnectMaxWait)
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			slog.Warn("Disconnected from NATS", "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			slog.Info("Reconnected to NATS", "url", nc.ConnectedUrl())
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			slog.Error("NATS connection closed", "error", nc.LastError())
+		}),
+	)
+}
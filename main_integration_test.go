@@ -0,0 +1,215 @@
+//go:build integration
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/delaneyj/toolbelt/embeddednats"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// waitForStatus waits up to timeout for nc to reach status.
+func waitForStatus(t *testing.T, nc *nats.Conn, status nats.Status, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for nc.Status() != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("NATS connection is %s after %s, want %s", nc.Status(), timeout, status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNATSReconnect(t *testing.T) {
+	ctx := t.Context()
+	opts := &server.Options{Host: "127.0.0.1", Port: freePort(t), JetStream: true, StoreDir: t.TempDir()}
+	start := func() *embeddednats.Server {
+		t.Helper()
+		ns, err := embeddednats.New(ctx, embeddednats.WithNATSServerOptions(opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ns.NatsServer.ReadyForConnections(10 * time.Second) {
+			t.Fatal("NATS server did not start")
+		}
+		return ns
+	}
+
+	ns := start()
+	nc, err := connectNATS(ns.NatsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("connectNATS: %v", err)
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newNATSStore(ctx, js, jetstream.KeyValueConfig{Bucket: "reconnect", Storage: jetstream.FileStorage})
+	if err != nil {
+		t.Fatalf("newStore: %v", err)
+	}
+	if err := s.Put(ctx, "crew", []byte("before")); err != nil {
+		t.Fatalf("Put before the disconnect: %v", err)
+	}
+
+	ns.NatsServer.Shutdown()
+	ns.NatsServer.WaitForShutdown()
+	waitForStatus(t, nc, nats.RECONNECTING, 5*time.Second)
+
+	start()
+	waitForStatus(t, nc, nats.CONNECTED, 15*time.Second)
+
+	if err := s.Put(ctx, "crew", []byte("after")); err != nil {
+		t.Fatalf("Put after the reconnect: %v", err)
+	}
+	value, err := s.Get(ctx, "crew")
+	if err != nil {
+		t.Fatalf("Get after the reconnect: %v", err)
+	}
+	if string(value) != "after" {
+		t.Errorf("Get = %q, want after", value)
+	}
+}
+
+// newTestNATSStore starts an embedded NATS server and returns a store over a
+// new bucket in it.
+func newTestNATSStore(t *testing.T, bucket string) *natsStore {
+	t.Helper()
+	s, err := newNATSStore(t.Context(), newTestJetStream(t), jetstream.KeyValueConfig{Bucket: bucket, History: 5, Storage: jetstream.MemoryStorage})
+	if err != nil {
+		t.Fatalf("newNATSStore: %v", err)
+	}
+	return s
+}
+
+// newTestJetStream starts an embedded NATS server for the test and connects
+// to its JetStream.
+func newTestJetStream(t *testing.T) jetstream.JetStream {
+	t.Helper()
+	ctx := t.Context()
+	opts := &server.Options{Host: "127.0.0.1", Port: freePort(t), JetStream: true, StoreDir: t.TempDir()}
+	ns, err := embeddednats.New(ctx, embeddednats.WithNATSServerOptions(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ns.NatsServer.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	nc, err := connectNATS(ns.NatsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("connectNATS: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func TestNATSStoreStorage(t *testing.T) {
+	js := newTestJetStream(t)
+	for _, name := range []string{"file", "memory"} {
+		t.Run(name, func(t *testing.T) {
+			s, err := newNATSStore(t.Context(), js, jetstream.KeyValueConfig{Bucket: "storage-" + name, Storage: jsStorageType(name)})
+			if err != nil {
+				t.Fatalf("newNATSStore: %v", err)
+			}
+			status, err := s.kv.Status(t.Context())
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			got := status.(*jetstream.KeyValueBucketStatus).StreamInfo().Config.Storage
+			if got != jsStorageType(name) {
+				t.Errorf("bucket storage = %s, want %s", got, jsStorageType(name))
+			}
+		})
+	}
+}
+
+func TestNATSStoreKeys(t *testing.T) {
+	ctx := t.Context()
+	s := newTestNATSStore(t, "keys")
+
+	for _, key := range []string{"crew.1", "crew.2", "crew.1", "crews.3", "other.1"} {
+		if err := s.Put(ctx, key, []byte("x")); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "crew.", want: []string{"crew.1", "crew.2"}},
+		{prefix: "crew", want: []string{"crew.1", "crew.2", "crews.3"}},
+		{prefix: "crew.1", want: []string{"crew.1"}},
+		{prefix: "", want: []string{"crew.1", "crew.2", "crews.3", "other.1"}},
+		{prefix: "none.", want: nil},
+	}
+	for _, tt := range tests {
+		keys, err := s.Keys(ctx, tt.prefix)
+		if err != nil {
+			t.Fatalf("Keys(%q): %v", tt.prefix, err)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("Keys(%q) = %q, want %q", tt.prefix, keys, tt.want)
+		}
+	}
+}
+
+func TestNATSStoreWatchInitializedOnce(t *testing.T) {
+	checkWatchInitializedOnce(t, newTestNATSStore(t, "watch"))
+}
+
+func TestImportTooLargeForBucket(t *testing.T) {
+	const maxBytes = 4096
+	s, err := newNATSStore(t.Context(), newTestJetStream(t), jetstream.KeyValueConfig{Bucket: "tiny", Storage: jetstream.MemoryStorage, Compression: true, MaxBytes: maxBytes})
+	if err != nil {
+		t.Fatalf("newNATSStore: %v", err)
+	}
+	cfg := testBusinessConfig()
+	cfg.MaxStateBytes = maxBytes
+	b := newBusiness(s, newMemoryStore(time.Hour), newMemoryStore(time.Hour), nil, cfg)
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+	if _, err := b.Import(t.Context(), "crew", largeImport(200)); !errors.Is(err, ErrStateTooLarge) {
+		t.Fatalf("Import = %v, want %v", err, ErrStateTooLarge)
+	}
+	if n := len(mustGet(t, b, "crew").Rowers); n != 1 {
+		t.Errorf("crew has %d rowers after the rejected import, want 1", n)
+	}
+}
+
+func TestNATSSessionStore(t *testing.T) {
+	st := newKVSessionStore(newTestNATSStore(t, "sessions"), testSessionKey(t))
+	r := httptest.NewRequest(http.MethodGet, "/masterscalc", nil)
+	sess, err := st.New(r, "mc_session")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	sess.Values["id"] = "crew-1"
+	w := httptest.NewRecorder()
+	if err := st.Save(r, w, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/masterscalc", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	loaded, err := st.New(r, "mc_session")
+	if err != nil || loaded.IsNew || loaded.Values["id"] != "crew-1" {
+		t.Errorf("New with the cookie = %v, IsNew %v, values %v, want the saved session", err, loaded.IsNew, loaded.Values)
+	}
+}
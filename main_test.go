@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestMain(m *testing.M) {
+	// The handlers and business layer log every change, which would drown
+	// out the test output.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// freePort returns a TCP port nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestEnsureWritableDirCreatesDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nats", "data")
+	if err := ensureWritableDir(dir); err != nil {
+		t.Fatalf("ensureWritableDir: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		t.Fatalf("%s was not created: %v", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("write check left %d files behind", len(entries))
+	}
+}
+
+func TestEnsureWritableDirRejectsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureWritableDir(file); err == nil {
+		t.Error("ensureWritableDir accepted a file")
+	}
+}
+
+func TestValidBucketName(t *testing.T) {
+	for bucket, want := range map[string]bool{
+		"rowingdata":    true,
+		"staging_crews": true,
+		"crews-2026":    true,
+		"with.dot":      false,
+		"with space":    false,
+		"wild*":         false,
+		"a>":            false,
+	} {
+		if got := validBucketName(bucket); got != want {
+			t.Errorf("validBucketName(%q) = %v, want %v", bucket, got, want)
+		}
+	}
+}
+
+func TestStartNATSInvalidDir(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const timeout = 2 * time.Second
+	start := time.Now()
+	ns, err := startNATS(t.Context(), file, timeout)
+	if err == nil {
+		_ = ns.Close()
+		t.Fatal("startNATS succeeded in a file")
+	}
+	if !strings.Contains(err.Error(), file) {
+		t.Errorf("error %q does not name the directory", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Errorf("startNATS took %s, want at most the %s timeout", elapsed, timeout)
+	}
+}
+
+func TestRunLogFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	path := filepath.Join(t.TempDir(), "server.log")
+	stdout := new(bytes.Buffer)
+	getenv := testGetenv(map[string]string{"LOG_FILE": path})
+	if err := run(t.Context(), []string{"-check-config"}, getenv, stdout); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	logged, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, out := range map[string]string{"stdout": stdout.String(), "log file": string(logged)} {
+		if !strings.Contains(out, "msg=\"Effective configuration\"") {
+			t.Errorf("%s does not contain the log lines:\n%s", name, out)
+		}
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	lf, err := openLogFile(path, 10)
+	if err != nil {
+		t.Fatalf("openLogFile: %v", err)
+	}
+	defer func() { _ = lf.Close() }()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	for file, want := range map[string]string{path: "third\n", path + ".1": "second\n"} {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, want)
+		}
+	}
+}
+
+// startTestServer runs the server with env on a free port until the test
+// ends, returning its base URL once it is serving.
+func startTestServer(t *testing.T, env map[string]string) string {
+	t.Helper()
+	logger := slog.Default()
+	port := strconv.Itoa(freePort(t))
+	env["PORT"] = port
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, nil, testGetenv(env), io.Discard) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run: %v", err)
+		}
+		slog.SetDefault(logger)
+	})
+
+	base := "http://127.0.0.1:" + port
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(base + "/health")
+		if err == nil {
+			_ = resp.Body.Close()
+			return base
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRunH2C(t *testing.T) {
+	base := startTestServer(t, map[string]string{"H2C": "true"})
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}, Timeout: 5 * time.Second}
+
+	resp, err := client.Get(base + "/health")
+	if err != nil {
+		t.Fatalf("GET /health over h2c: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Fatalf("GET /health = %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+	}
+
+	// The watch stream works over the same transport.
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, base+"/masterscalc/rowers", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.ProtoMajor != 2 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("watch = %s over %s, want an event stream over HTTP/2", resp.Header.Get("Content-Type"), resp.Proto)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event: datastar-") {
+		t.Errorf("first line of the stream = %q, %v, want a Datastar event", line, err)
+	}
+}
+
+func TestRunDevModeWithoutSessionSecret(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	stdout := new(bytes.Buffer)
+	getenv := testGetenv(map[string]string{"SESSION_SECRET": "", "DEV_MODE": "true"})
+	if err := run(t.Context(), []string{"-check-config"}, getenv, stdout); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "DEV_MODE: SESSION_SECRET is not set") {
+		t.Errorf("dev mode did not warn about the ephemeral key:\n%s", stdout)
+	}
+
+	err := run(t.Context(), []string{"-check-config"}, testGetenv(map[string]string{"SESSION_SECRET": ""}), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "SESSION_SECRET") {
+		t.Errorf("run without SESSION_SECRET = %v, want it required", err)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	base := startTestServer(t, map[string]string{})
+
+	resp, err := http.Get(base + "/favicon.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /favicon.ico: status %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/x-icon" && ct != "image/vnd.microsoft.icon" {
+		t.Errorf("GET /favicon.ico: Content-Type %q, want an icon", ct)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	base := startTestServer(t, map[string]string{"APP_NAME": "Crew Calc"})
+
+	resp, err := http.Get(base + "/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/manifest+json" {
+		t.Errorf("GET /manifest.json: Content-Type %q, want application/manifest+json", ct)
+	}
+	var manifest webManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		t.Fatalf("could not decode the manifest: %v", err)
+	}
+	if manifest.Name != "Crew Calc" || manifest.StartURL != "/masterscalc" {
+		t.Errorf("manifest = %+v, want it named Crew Calc and starting at /masterscalc", manifest)
+	}
+}
+
+func TestServiceWorker(t *testing.T) {
+	base := startTestServer(t, map[string]string{})
+
+	resp, err := http.Get(base + "/static/sw.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /static/sw.js: status %d, want 200", resp.StatusCode)
+	}
+	for header, want := range map[string]string{
+		"Service-Worker-Allowed": "/masterscalc",
+		"Content-Type":           "text/javascript; charset=utf-8",
+		"Cache-Control":          "no-cache",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if bytes.Contains(body, []byte("{{")) {
+		t.Error("service worker still contains template actions")
+	}
+}
+
+func TestStaticVersion(t *testing.T) {
+	files := fstest.MapFS{
+		"sw.js":          {Data: []byte("self.addEventListener('fetch', () => {})")},
+		"css/styles.css": {Data: []byte("body {}")},
+	}
+	v1, err := staticVersion(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := staticVersion(files); again != v1 {
+		t.Errorf("staticVersion = %q then %q, want it stable", v1, again)
+	}
+	files["css/styles.css"] = &fstest.MapFile{Data: []byte("body { margin: 0 }")}
+	if v2, _ := staticVersion(files); v2 == v1 {
+		t.Error("staticVersion did not change when a file changed")
+	}
+}
+
+func TestRootRedirect(t *testing.T) {
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "default", env: map[string]string{}, wantStatus: http.StatusFound, wantLocation: "/masterscalc"},
+		{name: "configured", env: map[string]string{"ROOT_REDIRECT": "/masterscalc/help"}, wantStatus: http.StatusFound, wantLocation: "/masterscalc/help"},
+		{name: "none", env: map[string]string{"ROOT_REDIRECT": "none"}, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := startTestServer(t, tt.env)
+			resp, err := noRedirect.Get(base + "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || resp.Header.Get("Location") != tt.wantLocation {
+				t.Errorf("GET / = %d to %q, want %d to %q", resp.StatusCode, resp.Header.Get("Location"), tt.wantStatus, tt.wantLocation)
+			}
+
+			// Only the root itself redirects.
+			resp, err = noRedirect.Get(base + "/unknown")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Errorf("GET /unknown = %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRunCheckConfig(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr bool
+	}{
+		{name: "flag", args: []string{"-check-config"}, env: map[string]string{}},
+		{name: "environment", env: map[string]string{"CHECK_CONFIG": "true"}},
+		{name: "invalid config", args: []string{"-check-config"}, env: map[string]string{"GZIP_LEVEL": "12"}, wantErr: true},
+		{name: "unusable store", args: []string{"-check-config"}, env: map[string]string{"STORE_BACKEND": "redis", "REDIS_URL": "not a url"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// check-config must return without serving, so the context is
+			// never cancelled.
+			stdout := new(bytes.Buffer)
+			err := run(context.Background(), tt.args, testGetenv(tt.env), stdout)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("run succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if !strings.Contains(stdout.String(), "Configuration OK") {
+				t.Errorf("output does not report the configuration OK:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestJSStorageType(t *testing.T) {
+	if got := jsStorageType("memory"); got != jetstream.MemoryStorage {
+		t.Errorf("jsStorageType(memory) = %s, want memory", got)
+	}
+	if got := jsStorageType("file"); got != jetstream.FileStorage {
+		t.Errorf("jsStorageType(file) = %s, want file", got)
+	}
+}
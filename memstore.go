@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often a running memory store deletes the entries
+// that expired without being read again.
+const memorySweepInterval = time.Minute
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStore is an in-process store for demos and local development. Entries
+// expire after ttl and watchers are always handed the latest value, which is
+// all the business layer needs since every value is a complete state.
+type memoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	entries  map[string]memoryEntry
+	watchers map[string]map[chan []byte]struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newMemoryStore(ttl time.Duration) *memoryStore {
+	return &memoryStore{
+		ttl:      ttl,
+		entries:  map[string]memoryEntry{},
+		watchers: map[string]map[chan []byte]struct{}{},
+		closed:   make(chan struct{}),
+	}
+}
+
+// Run deletes expired entries every interval until ctx is cancelled or the
+// store is closed. Reads only expire the keys they look at, so without it a
+// crew that is never opened again would stay in memory.
+func (s *memoryStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+// Close stops Run.
+func (s *memoryStore) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+// sweep deletes every expired entry.
+func (s *memoryStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.entries {
+		s.get(key)
+	}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return value, nil
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value = append([]byte(nil), value...)
+	s.entries[key] = memoryEntry{value: value, expires: time.Now().Add(s.ttl)}
+
+	for ch := range s.watchers[key] {
+		notify(ch, value)
+	}
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	for ch := range s.watchers[key] {
+		notify(ch, nil)
+	}
+	return nil
+}
+
+func (s *memoryStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.entries {
+		if _, ok := s.get(key); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	ch := make(chan []byte, 1)
+
+	s.mu.Lock()
+	if s.watchers[key] == nil {
+		s.watchers[key] = map[chan []byte]struct{}{}
+	}
+	s.watchers[key][ch] = struct{}{}
+	value, ok := s.get(key)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers[key], ch)
+		if len(s.watchers[key]) == 0 {
+			delete(s.watchers, key)
+		}
+	}()
+
+	// Updates made after registering queue up on ch, so delivering the current
+	// value outside the lock cannot miss one.
+	if ok {
+		if err := callback(value); err != nil {
+			return fmt.Errorf("could not handle update: %w", err)
+		}
+	}
+	if err := initialized(); err != nil {
+		return fmt.Errorf("could not handle initialization: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case value := <-ch:
+			if err := callback(value); err != nil {
+				return fmt.Errorf("could not handle update: %w", err)
+			}
+		}
+	}
+}
+
+// get returns the unexpired value for key. The caller must hold s.mu.
+func (s *memoryStore) get(key string) ([]byte, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// notify hands value to ch, replacing any update the watcher has not yet consumed.
+func notify(ch chan []byte, value []byte) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- value
+}
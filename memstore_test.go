@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStore(time.Hour)
+
+	if _, err := s.Get(ctx, "crew"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get of a missing key: %v, want ErrKeyNotFound", err)
+	}
+	if err := s.Put(ctx, "crew", []byte("one")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put(ctx, "other", []byte("two")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	value, err := s.Get(ctx, "crew")
+	if err != nil || string(value) != "one" {
+		t.Fatalf("Get = %q, %v, want one", value, err)
+	}
+
+	keys, err := s.Keys(ctx, "cr")
+	if err != nil || !slices.Equal(keys, []string{"crew"}) {
+		t.Fatalf("Keys = %v, %v, want [crew]", keys, err)
+	}
+
+	if err := s.Delete(ctx, "crew"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "crew"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Get after Delete: %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := newMemoryStore(time.Millisecond)
+	if err := s.Put(ctx, "crew", []byte("one")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := s.Get(ctx, "crew"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Get after the TTL: %v, want ErrKeyNotFound", err)
+	}
+	if keys, _ := s.Keys(ctx, ""); len(keys) != 0 {
+		t.Errorf("Keys after the TTL = %v, want none", keys)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newMemoryStore(time.Millisecond)
+	if err := s.Put(ctx, "crew", []byte("one")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	// The key is never read, so only the sweep can purge it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.entries)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d entries after the TTL, want the expired key purged", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop when the store was closed")
+	}
+}
+
+func TestMemoryStoreRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		newMemoryStore(time.Hour).Run(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop when ctx was cancelled")
+	}
+}
+
+// watchCrew watches the crew at key on b until the test ends, returning the
+// crews it is called with once the stored crew has been delivered.
+func watchCrew(t *testing.T, b *business, key string) <-chan *state {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan *state, 16)
+	initialized := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		var ready bool
+		done <- b.Watch(ctx, key, func(s *state) error {
+			if ready {
+				updates <- s
+			}
+			return nil
+		}, func() error {
+			ready = true
+			close(initialized)
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	})
+
+	select {
+	case <-initialized:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch was not initialized")
+	}
+	return updates
+}
+
+// nextCrew returns the next crew from updates, failing the test if none comes.
+func nextCrew(t *testing.T, updates <-chan *state) *state {
+	t.Helper()
+	select {
+	case s := <-updates:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+		return nil
+	}
+}
+
+func TestMemoryStoreCreateWatchDelete(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	updates := watchCrew(t, b, "crew")
+
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	s := nextCrew(t, updates)
+	if len(s.Rowers) != 1 || s.Rowers[0].Name != "Alex" || s.Signals.AverageBand != "C" {
+		t.Fatalf("after Create: rowers %v, band %q, want Alex in C", s.Rowers, s.Signals.AverageBand)
+	}
+
+	if err := b.Delete(ctx, "crew", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	s = nextCrew(t, updates)
+	if len(s.Rowers) != 0 {
+		t.Fatalf("after Delete: rowers %v, want none", s.Rowers)
+	}
+}
+
+// checkWatchInitializedOnce checks that a watch on s reports the end of the
+// initial values exactly once, after the stored value and before any update.
+func checkWatchInitializedOnce(t *testing.T, s store) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.Put(ctx, "crew", []byte("initial")); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(ctx, "crew", func(value []byte) error {
+			record(string(value))
+			return nil
+		}, func() error {
+			record("initialized")
+			close(ready)
+			return nil
+		})
+	}()
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch was not initialized")
+	}
+
+	for _, value := range []string{"second", "third"} {
+		if err := s.Put(ctx, "crew", []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"initial", "initialized", "second", "third"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		got := slices.Clone(events)
+		mu.Unlock()
+		if len(got) >= len(want) {
+			if !slices.Equal(got, want) {
+				t.Errorf("watch events = %q, want %q", got, want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("watch events = %q, want %q", got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch: %v", err)
+	}
+}
+
+func TestMemoryStoreWatchInitializedOnce(t *testing.T) {
+	checkWatchInitializedOnce(t, newMemoryStore(time.Hour))
+}
+
+func TestWatchInitializedAfterStoredCrew(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+	var initialized int
+	var last *state
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := b.Watch(ctx, "crew", func(s *state) error {
+		last = s
+		return nil
+	}, func() error {
+		initialized++
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if initialized != 1 {
+		t.Errorf("initialized %d times, want once", initialized)
+	}
+	if last == nil || len(last.Rowers) != 1 {
+		t.Errorf("crew before initialized = %+v, want the stored crew", last)
+	}
+}
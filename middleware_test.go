@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipMiddlewareRejectsInvalidLevel(t *testing.T) {
+	for _, level := range []int{gzip.HuffmanOnly - 1, gzip.BestCompression + 1} {
+		if _, err := gzipMiddleware(level); err == nil {
+			t.Errorf("gzipMiddleware(%d) succeeded, want an error", level)
+		}
+	}
+}
+
+func TestGzipMiddlewareLevel(t *testing.T) {
+	page := strings.Repeat("<tr><td>Alex Morgan</td><td>Thames RC</td></tr>\n", 200)
+	compressed := func(level int) []byte {
+		t.Helper()
+		compress, err := gzipMiddleware(level)
+		if err != nil {
+			t.Fatalf("gzipMiddleware(%d): %v", level, err)
+		}
+		h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, page)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Content-Encoding = %q, want gzip", got)
+		}
+
+		raw := w.Body.Bytes()
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != page {
+			t.Fatalf("level %d: decompressed body differs from the page", level)
+		}
+		return raw
+	}
+
+	stored, best := compressed(gzip.NoCompression), compressed(gzip.BestCompression)
+	if len(stored) <= len(page) {
+		t.Errorf("level %d: %d bytes for a %d byte page, want it stored uncompressed", gzip.NoCompression, len(stored), len(page))
+	}
+	if len(best) >= len(page)/10 {
+		t.Errorf("level %d: %d bytes for a %d byte page, want it compressed", gzip.BestCompression, len(best), len(page))
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	// slow waits for the deadline, then fails like a handler whose store
+	// call was cancelled.
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, r.Context().Err().Error(), http.StatusInternalServerError)
+	})
+	timeout := timeoutMiddleware(10*time.Millisecond, func(r *http.Request) bool { return r.URL.Path == "/watch" })
+
+	w := httptest.NewRecorder()
+	timeout(slow).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("slow handler status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if strings.Contains(w.Body.String(), "deadline exceeded") {
+		t.Errorf("slow handler's own error was sent: %s", w.Body)
+	}
+
+	// An exempt request keeps the context it came with.
+	w = httptest.NewRecorder()
+	timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("exempt request has a deadline")
+		}
+	})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/watch", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("exempt request status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// namespacedStore prefixes every key of the underlying store with a namespace,
+// so that environments sharing a backend never see each other's state.
+type namespacedStore struct {
+	s      store
+	prefix string
+}
+
+// newNamespacedStore wraps s so that its keys live under namespace. The
+// namespace must satisfy validNamespace.
+func newNamespacedStore(s store, namespace string) *namespacedStore {
+	// A dot separates NATS key tokens and is valid in every backend's keys.
+	return &namespacedStore{s: s, prefix: namespace + "."}
+}
+
+// validNamespace reports whether namespace can be used as a key prefix in
+// every store backend.
+func validNamespace(namespace string) bool {
+	return bucketNameRegexp.MatchString(namespace)
+}
+
+func (n *namespacedStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return n.s.Get(ctx, n.prefix+key)
+}
+
+func (n *namespacedStore) Put(ctx context.Context, key string, value []byte) error {
+	return n.s.Put(ctx, n.prefix+key, value)
+}
+
+func (n *namespacedStore) Delete(ctx context.Context, key string) error {
+	return n.s.Delete(ctx, n.prefix+key)
+}
+
+func (n *namespacedStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	return n.s.Watch(ctx, n.prefix+key, callback, initialized)
+}
+
+func (n *namespacedStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := n.s.Keys(ctx, n.prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, n.prefix)
+	}
+	return keys, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNamespacedStoreIsolation(t *testing.T) {
+	ctx := context.Background()
+	shared := newMemoryStore(time.Hour)
+	dev := newNamespacedStore(shared, "dev")
+	prod := newNamespacedStore(shared, "prod")
+
+	if err := dev.Put(ctx, "crew", []byte("dev")); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.Put(ctx, "crew", []byte("prod")); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.Put(ctx, "other", []byte("prod")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range map[string]struct {
+		s    store
+		want string
+	}{"dev": {dev, "dev"}, "prod": {prod, "prod"}} {
+		value, err := tt.s.Get(ctx, "crew")
+		if err != nil || string(value) != tt.want {
+			t.Errorf("%s Get = %q, %v, want %q", name, value, err, tt.want)
+		}
+	}
+
+	devKeys, err := dev.Keys(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(devKeys, []string{"crew"}) {
+		t.Errorf("dev Keys = %q, want only crew", devKeys)
+	}
+	prodKeys, err := prod.Keys(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(prodKeys)
+	if !slices.Equal(prodKeys, []string{"crew", "other"}) {
+		t.Errorf("prod Keys = %q, want crew and other", prodKeys)
+	}
+
+	if err := dev.Delete(ctx, "crew"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.Get(ctx, "crew"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("dev Get after Delete = %v, want ErrKeyNotFound", err)
+	}
+	if value, err := prod.Get(ctx, "crew"); err != nil || string(value) != "prod" {
+		t.Errorf("prod Get after the dev Delete = %q, %v, want prod", value, err)
+	}
+	if _, err := shared.Get(ctx, "prod.crew"); err != nil {
+		t.Errorf("prod crew is not stored under its namespace: %v", err)
+	}
+}
+
+func TestNamespacedStoreWatch(t *testing.T) {
+	shared := newMemoryStore(time.Hour)
+	dev := newNamespacedStore(shared, "dev")
+	prod := newNamespacedStore(shared, "prod")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan string, 10)
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- dev.Watch(ctx, "crew", func(value []byte) error {
+			updates <- string(value)
+			return nil
+		}, func() error { close(ready); return nil })
+	}()
+	<-ready
+
+	if err := prod.Put(ctx, "crew", []byte("prod")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Put(ctx, "crew", []byte("dev")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-updates:
+		if got != "dev" {
+			t.Errorf("dev watcher got %q, want only dev updates", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dev watcher got no update")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch: %v", err)
+	}
+}
+
+func TestValidNamespace(t *testing.T) {
+	for _, tt := range []struct {
+		namespace string
+		want      bool
+	}{
+		{"prod", true},
+		{"staging-2", true},
+		{"dev_local", true},
+		{"", false},
+		{"a.b", false},
+		{"a:b", false},
+		{"with space", false},
+	} {
+		if got := validNamespace(tt.namespace); got != tt.want {
+			t.Errorf("validNamespace(%q) = %t, want %t", tt.namespace, got, tt.want)
+		}
+	}
+}
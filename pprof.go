@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+// defaultPprofAddr keeps the profiling listener on the loopback interface, so
+// it is only reachable from the host itself unless configured otherwise.
+const defaultPprofAddr = "localhost:6060"
+
+// pprofMux serves the net/http/pprof handlers under /debug/pprof/.
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// servePprof serves the profiling endpoints on their own listener at addr
+// until ctx is cancelled.
+func servePprof(ctx context.Context, addr string) {
+	server := &http.Server{Addr: addr, Handler: pprofMux()}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	slog.Info("Profiling endpoints listening", "url", "http://"+addr+"/debug/pprof/")
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Error serving profiling endpoints", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPprof(t *testing.T) {
+	pprofAddr := "127.0.0.1:" + strconv.Itoa(freePort(t))
+	base := startTestServer(t, map[string]string{"PPROF": "true", "PPROF_ADDR": pprofAddr})
+
+	// The listener starts alongside the server, so give it a moment.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + pprofAddr + "/debug/pprof/")
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("profiling listener: status %d, want 200", resp.StatusCode)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("profiling listener did not start: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The profiles stay off the public listener.
+	resp, err := http.Get(base + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("main listener: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestPprofOffByDefault(t *testing.T) {
+	cfg, err := loadConfig(testGetenv(map[string]string{}))
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.PprofAddr != "" {
+		t.Errorf("PprofAddr = %q, want profiling off", cfg.PprofAddr)
+	}
+	if cfg, err = loadConfig(testGetenv(map[string]string{"PPROF": "true"})); err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.PprofAddr != defaultPprofAddr {
+		t.Errorf("PprofAddr = %q, want %q", cfg.PprofAddr, defaultPprofAddr)
+	}
+
+	base := startTestServer(t, map[string]string{})
+	resp, err := http.Get(base + "/debug/pprof/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
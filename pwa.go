@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"text/template"
+)
+
+// defaultAppName is the name the app is installed under unless configured
+// otherwise.
+const defaultAppName = "MastersCalc"
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// webManifest is the web app manifest that lets browsers install the page as
+// an app.
+type webManifest struct {
+	Name            string            `json:"name"`
+	ShortName       string            `json:"short_name"`
+	StartURL        string            `json:"start_url"`
+	Display         string            `json:"display"`
+	BackgroundColor string            `json:"background_color"`
+	ThemeColor      string            `json:"theme_color"`
+	Icons           []webManifestIcon `json:"icons"`
+}
+
+// manifestHandler serves the web app manifest for an app called name.
+func manifestHandler(name string) (http.HandlerFunc, error) {
+	body, err := json.Marshal(webManifest{
+		Name:            name,
+		ShortName:       name,
+		StartURL:        "/masterscalc",
+		Display:         "standalone",
+		BackgroundColor: "#ffffff",
+		ThemeColor:      "#0969da",
+		Icons: []webManifestIcon{
+			{Src: "/static/icon.svg", Sizes: "any", Type: "image/svg+xml"},
+			{Src: "/favicon.ico", Sizes: "32x32", Type: "image/x-icon"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/manifest+json")
+		_, _ = w.Write(body)
+	}, nil
+}
+
+// serviceWorkerHandler serves the service worker from the static files, with
+// its cache named after a hash of them so that a deployment with changed assets
+// replaces the cached copies.
+func serviceWorkerHandler(staticFS fs.FS) (http.HandlerFunc, error) {
+	src, err := fs.ReadFile(staticFS, "sw.js")
+	if err != nil {
+		return nil, fmt.Errorf("could not read service worker: %w", err)
+	}
+	t, err := template.New("sw").Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse service worker: %w", err)
+	}
+	version, err := staticVersion(staticFS)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := t.Execute(&body, struct{ Version string }{version}); err != nil {
+		return nil, fmt.Errorf("could not render service worker: %w", err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		// Browsers check for a new worker on every visit only if it is not cached.
+		w.Header().Set("Cache-Control", "no-cache")
+		// The worker lives under /static/ but controls the calculator pages.
+		w.Header().Set("Service-Worker-Allowed", "/masterscalc")
+		_, _ = w.Write(body.Bytes())
+	}, nil
+}
+
+// staticVersion returns a short hash of every file in fsys.
+func staticVersion(fsys fs.FS) (string, error) {
+	h := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		_, _ = h.Write([]byte(path))
+		_, _ = h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not hash static files: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12], nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "198.51.100.7:1234", want: "198.51.100.7"},
+		{name: "untrusted peer forwarding", remoteAddr: "198.51.100.7:1234", forwarded: []string{"203.0.113.9"}, realIP: "203.0.113.10", want: "198.51.100.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:1234", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "trusted single address", remoteAddr: "192.0.2.1:1234", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+		{name: "trusted proxy chain", remoteAddr: "10.1.2.3:1234", forwarded: []string{"203.0.113.9, 10.4.5.6"}, want: "203.0.113.9"},
+		{name: "spoofed hop before the client", remoteAddr: "10.1.2.3:1234", forwarded: []string{"1.2.3.4", "203.0.113.9"}, want: "203.0.113.9"},
+		{name: "real IP header", remoteAddr: "10.1.2.3:1234", realIP: "203.0.113.10", want: "203.0.113.10"},
+		{name: "trusted proxy without headers", remoteAddr: "10.1.2.3:1234", want: "10.1.2.3"},
+		{name: "garbage hop", remoteAddr: "10.1.2.3:1234", forwarded: []string{"not-an-ip"}, want: "10.1.2.3"},
+		{name: "mapped IPv4 peer", remoteAddr: "[::ffff:10.1.2.3]:1234", forwarded: []string{"203.0.113.9"}, want: "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := realIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, v := range []string{"10.0.0.0/33", "proxy.local", "10.0.0.1/"} {
+		if _, err := parseTrustedProxies(v); err == nil {
+			t.Errorf("parseTrustedProxies accepted %q", v)
+		}
+	}
+	prefixes, err := parseTrustedProxies("")
+	if err != nil || len(prefixes) != 0 {
+		t.Errorf("parseTrustedProxies(\"\") = %v, %v, want none", prefixes, err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisStore keeps state in Redis with a per-key TTL. Every write is also
+// published on a per-key channel so that watchers see updates without polling.
+// Keys are stored under prefix so several stores can share one database.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisStore(ctx context.Context, url, prefix string, ttl time.Duration) (*redisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("could not connect to redis: %w", err)
+	}
+	return &redisStore{client: client, prefix: prefix, ttl: ttl}, nil
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("could not get entry from redis: %w", err)
+	}
+	return value, nil
+}
+
+func (s *redisStore) Put(ctx context.Context, key string, value []byte) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.prefix+key, value, s.ttl)
+		pipe.Publish(ctx, s.channel(key), value)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not put entry to redis: %w", err)
+	}
+	return nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.prefix+key)
+		pipe.Publish(ctx, s.channel(key), "")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete entry from redis: %w", err)
+	}
+	return nil
+}
+
+func (s *redisStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, redisGlobEscaper.Replace(s.prefix+prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), s.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("could not list keys: %w", err)
+	}
+	return keys, nil
+}
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (s *redisStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	sub := s.client.Subscribe(ctx, s.channel(key))
+	defer func() { _ = sub.Close() }()
+
+	// Wait for the subscription to be confirmed so that no write between
+	// reading the current value and subscribing is missed.
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("could not subscribe to updates: %w", err)
+	}
+
+	value, err := s.Get(ctx, key)
+	switch {
+	case err == nil:
+		if err := callback(value); err != nil {
+			return fmt.Errorf("could not handle update: %w", err)
+		}
+	case !errors.Is(err, ErrKeyNotFound):
+		return err
+	}
+	if err := initialized(); err != nil {
+		return fmt.Errorf("could not handle initialization: %w", err)
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var value []byte
+			if msg.Payload != "" {
+				value = []byte(msg.Payload)
+			}
+			if err := callback(value); err != nil {
+				return fmt.Errorf("could not handle update: %w", err)
+			}
+		}
+	}
+}
+
+func (s *redisStore) channel(key string) string {
+	return "webserver:watch:" + s.prefix + key
+}
@@ -0,0 +1,113 @@
+//go:build redis
+
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	toolbelt "github.com/delaneyj/toolbelt/id"
+)
+
+// newTestRedisStore connects to the Redis at REDIS_URL, skipping the test
+// when it is not set. Keys are kept under a prefix of their own, so tests
+// don't see each other's.
+func newTestRedisStore(t *testing.T) *redisStore {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL is not set")
+	}
+	s, err := newRedisStore(context.Background(), url, "test:"+toolbelt.NextEncodedID()+":", time.Minute)
+	if err != nil {
+		t.Fatalf("newRedisStore: %v", err)
+	}
+	t.Cleanup(func() {
+		keys, _ := s.Keys(context.Background(), "")
+		for _, key := range keys {
+			_ = s.Delete(context.Background(), key)
+		}
+		_ = s.client.Close()
+	})
+	return s
+}
+
+func TestRedisStoreWatch(t *testing.T) {
+	s := newTestRedisStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := s.Put(ctx, "crew", []byte("initial")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	updates := make(chan []byte, 8)
+	initialized := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Watch(ctx, "crew", func(value []byte) error {
+			updates <- value
+			return nil
+		}, func() error {
+			close(initialized)
+			return nil
+		})
+	}()
+
+	next := func() []byte {
+		t.Helper()
+		select {
+		case value := <-updates:
+			return value
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+
+	if value := next(); string(value) != "initial" {
+		t.Fatalf("first value = %q, want initial", value)
+	}
+	<-initialized
+
+	if err := s.Put(ctx, "crew", []byte("changed")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if value := next(); string(value) != "changed" {
+		t.Fatalf("update = %q, want changed", value)
+	}
+
+	if err := s.Delete(ctx, "crew"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if value := next(); value != nil {
+		t.Fatalf("update after Delete = %q, want nil", value)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch: %v", err)
+	}
+}
+
+func TestRedisStoreKeys(t *testing.T) {
+	s := newTestRedisStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"crew.1", "crew.2", "other"} {
+		if err := s.Put(ctx, key, []byte("x")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+	keys, err := s.Keys(ctx, "crew.")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"crew.1", "crew.2"}) {
+		t.Errorf("Keys = %v, want [crew.1 crew.2]", keys)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// retryStore retries the operations of the underlying store that fail with a
+// transient error, waiting an exponentially growing, jittered delay between
+// attempts. Watch is long-lived and is not retried.
+type retryStore struct {
+	s        store
+	attempts int
+	backoff  time.Duration
+
+	// retries counts the retried operations, shared by every store wrapped
+	// with it.
+	retries *atomic.Int64
+}
+
+// newRetryStore wraps s so that each operation is tried up to attempts times,
+// the first retry waiting up to backoff.
+func newRetryStore(s store, attempts int, backoff time.Duration, retries *atomic.Int64) *retryStore {
+	return &retryStore{s: s, attempts: attempts, backoff: backoff, retries: retries}
+}
+
+// retryable reports whether err may succeed if the operation is tried again:
+// the server timed out or was not there to answer, or the connection to it was
+// lost. Any other error, such as a missing key, an oversized value or a
+// cancelled request, fails the same way every time.
+func retryable(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, nats.ErrTimeout),
+		errors.Is(err, nats.ErrNoResponders),
+		errors.Is(err, nats.ErrConnectionClosed),
+		errors.Is(err, nats.ErrConnectionReconnecting),
+		errors.Is(err, jetstream.ErrConnectionClosed):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (r *retryStore) do(ctx context.Context, op, key string, fn func() error) error {
+	delay := r.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.attempts || !retryable(err) {
+			return err
+		}
+
+		r.retries.Add(1)
+		wait := rand.N(delay + 1)
+		slog.Warn("Retrying store operation", "op", op, "key", key, "attempt", attempt, "wait", wait, "error", err)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		delay *= 2
+	}
+}
+
+func (r *retryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := r.do(ctx, "get", key, func() error {
+		var err error
+		value, err = r.s.Get(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (r *retryStore) Put(ctx context.Context, key string, value []byte) error {
+	return r.do(ctx, "put", key, func() error {
+		return r.s.Put(ctx, key, value)
+	})
+}
+
+func (r *retryStore) Delete(ctx context.Context, key string) error {
+	return r.do(ctx, "delete", key, func() error {
+		return r.s.Delete(ctx, key)
+	})
+}
+
+func (r *retryStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	return r.s.Watch(ctx, key, callback, initialized)
+}
+
+func (r *retryStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := r.do(ctx, "keys", prefix, func() error {
+		var err error
+		keys, err = r.s.Keys(ctx, prefix)
+		return err
+	})
+	return keys, err
+}
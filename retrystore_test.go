@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var errFlaky = fmt.Errorf("get crew: %w", nats.ErrTimeout)
+
+// flakyStore fails each operation with err until it has been called failures
+// times, then passes it on.
+type flakyStore struct {
+	store
+	err      error
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) fail() error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.store.Get(ctx, key)
+}
+
+func (s *flakyStore) Put(ctx context.Context, key string, value []byte) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.store.Put(ctx, key, value)
+}
+
+func TestRetryStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		failures    int
+		wantErr     error
+		wantCalls   int
+		wantRetries int64
+	}{
+		{name: "no failures", err: errFlaky, wantCalls: 1},
+		{name: "succeeds after retries", err: errFlaky, failures: 2, wantCalls: 3, wantRetries: 2},
+		{name: "gives up after attempts", err: errFlaky, failures: 5, wantErr: errFlaky, wantCalls: 3, wantRetries: 2},
+		{name: "not found is terminal", err: ErrKeyNotFound, failures: 5, wantErr: ErrKeyNotFound, wantCalls: 1},
+		{name: "cancelled is terminal", err: context.Canceled, failures: 5, wantErr: context.Canceled, wantCalls: 1},
+		{name: "permanent error is tried once", err: errPermanent, failures: 5, wantErr: errPermanent, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := newMemoryStore(time.Hour)
+			if err := mem.Put(ctx, "crew", []byte("value")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			flaky := &flakyStore{store: mem, err: tt.err, failures: tt.failures}
+			var retries atomic.Int64
+			s := newRetryStore(flaky, 3, time.Millisecond, &retries)
+
+			value, err := s.Get(ctx, "crew")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(value) != "value" {
+				t.Errorf("Get = %q, want value", value)
+			}
+			if flaky.calls != tt.wantCalls {
+				t.Errorf("store called %d times, want %d", flaky.calls, tt.wantCalls)
+			}
+			if got := retries.Load(); got != tt.wantRetries {
+				t.Errorf("retries = %d, want %d", got, tt.wantRetries)
+			}
+		})
+	}
+}
+
+// timeoutError is a network error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errPermanent = errors.New("nats: invalid key")
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nats.ErrTimeout, want: true},
+		{err: nats.ErrNoResponders, want: true},
+		{err: nats.ErrConnectionClosed, want: true},
+		{err: nats.ErrConnectionReconnecting, want: true},
+		{err: jetstream.ErrConnectionClosed, want: true},
+		{err: fmt.Errorf("dial redis: %w", &net.OpError{Op: "dial", Err: timeoutError{}}), want: true},
+		{err: &net.OpError{Op: "read", Err: errors.New("connection refused")}},
+		{err: ErrKeyNotFound},
+		{err: context.Canceled},
+		{err: context.DeadlineExceeded},
+		{err: errPermanent},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryStoreStopsWhenCancelled(t *testing.T) {
+	flaky := &flakyStore{store: newMemoryStore(time.Hour), err: errFlaky, failures: 5}
+	var retries atomic.Int64
+	s := newRetryStore(flaky, 5, time.Hour, &retries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for retries.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	// The backoff is too long to wait out, so only cancelling returns.
+	if err := s.Put(ctx, "crew", []byte("value")); !errors.Is(err, errFlaky) {
+		t.Errorf("Put error = %v, want %v", err, errFlaky)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	var retries atomic.Int64
+	retries.Add(3)
+
+	w := httptest.NewRecorder()
+	statsHandler(&retries)(w, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	var got stats
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if got.StoreRetries != 3 {
+		t.Errorf("StoreRetries = %d, want 3", got.StoreRetries)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxRolloverCrews bounds how many stored crews a single rollover recalculates.
+const maxRolloverCrews = 10000
+
+// errEmptyCrew skips saving a crew that has no rowers, e.g. because it expired
+// after the keys were listed.
+var errEmptyCrew = errors.New("crew is empty")
+
+// WatchYearRollover checks the clock every interval and, when the year
+// changes, recalculates the ages and bands of the stored crews so they don't
+// stay a year out of date. It returns when ctx is cancelled.
+func (b *business) WatchYearRollover(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	year := b.now().Year()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if b.now().Year() == year {
+				continue
+			}
+			year = b.now().Year()
+
+			n, err := b.RecalculateAges(ctx)
+			if err != nil {
+				slog.Error("Error recalculating ages at year rollover", "year", year, "error", err)
+				continue
+			}
+			slog.Info("Recalculated ages at year rollover", "year", year, "crews", n)
+		}
+	}
+}
+
+// RecalculateAges recomputes every rower's age and band from their birth year
+// and the current year, returning the number of crews updated.
+func (b *business) RecalculateAges(ctx context.Context) (int, error) {
+	keys, err := b.s.Keys(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("could not list crews: %w", err)
+	}
+	if len(keys) > maxRolloverCrews {
+		slog.Warn("Too many crews to recalculate, skipping the rest", "crews", len(keys), "max", maxRolloverCrews)
+		keys = keys[:maxRolloverCrews]
+	}
+
+	now := b.now()
+	thisYear := now.Year()
+	updated := 0
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return updated, ctx.Err()
+		}
+
+		err := b.mutate(ctx, key, func(s *state) error {
+			if len(s.Rowers) == 0 {
+				return errEmptyCrew
+			}
+			for i, r := range s.Rowers {
+				if dob, err := time.Parse(dateOfBirthLayout, r.DateOfBirth); err == nil {
+					s.Rowers[i].ExactAge = b.ageFromDateOfBirth(dob, now)
+					s.Rowers[i].Age = int(s.Rowers[i].ExactAge)
+					s.Rowers[i].Band = calculateBand(s.Rowers[i].ExactAge)
+					continue
+				}
+				s.Rowers[i].Age = thisYear - r.BirthYear
+				s.Rowers[i].Band = calculateBand(float64(s.Rowers[i].Age))
+			}
+			return nil
+		})
+		if errors.Is(err, errEmptyCrew) {
+			continue
+		}
+		if err != nil {
+			return updated, fmt.Errorf("could not recalculate crew: %w", err)
+		}
+		b.publish(ctx, key, changeEvent{Type: changeUpdate, Detail: "recalculated ages for the new year"})
+		updated++
+	}
+	return updated, nil
+}
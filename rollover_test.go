@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchYearRollover(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	var now atomic.Pointer[time.Time]
+	now.Store(&testNow)
+
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex", BirthYearOrAge: "1984"},
+		rowerInput{Name: "Sam", DateOfBirth: "1984-01-01"},
+	)
+	if s := mustGet(t, b, "crew"); s.Rowers[0].Band != "B" || s.Rowers[1].Band != "B" {
+		t.Fatalf("bands before the rollover = %s, %s, want B, B", s.Rowers[0].Band, s.Rowers[1].Band)
+	}
+
+	// Change the year only once the watcher has read the current one.
+	started := make(chan struct{})
+	var once sync.Once
+	b.now = func() time.Time {
+		once.Do(func() { close(started) })
+		return *now.Load()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.WatchYearRollover(ctx, time.Millisecond)
+	}()
+	defer func() { cancel(); <-done }()
+	<-started
+
+	newYear := time.Date(2027, time.January, 1, 12, 0, 0, 0, time.UTC)
+	now.Store(&newYear)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := mustGet(t, b, "crew")
+		if s.Rowers[0].Age == 43 {
+			if s.Rowers[0].Band != "C" || s.Rowers[1].Band != "C" || s.Signals.AverageBand != "C" {
+				t.Errorf("after the rollover bands = %s, %s and crew %s, want C", s.Rowers[0].Band, s.Rowers[1].Band, s.Signals.AverageBand)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("crew not recalculated after the year changed: %+v", s.Rowers)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecalculateAgesSkipsEmptyCrews(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "1984"})
+	if err := b.Delete(context.Background(), "crew", 0); err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, b, "other", rowerInput{Name: "Sam", BirthYearOrAge: "1970"})
+
+	n, err := b.RecalculateAges(context.Background())
+	if err != nil {
+		t.Fatalf("RecalculateAges: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("RecalculateAges updated %d crews, want 1", n)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// routeMux is a ServeMux that remembers the patterns registered on it, so they
+// can be listed for debugging.
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// route is a registered pattern split into its method, empty for any method,
+// and path.
+type route struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// routes returns the patterns registered so far.
+func (m *routeMux) routes() []route {
+	routes := make([]route, len(m.patterns))
+	for i, pattern := range m.patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "", pattern
+		}
+		routes[i] = route{Method: method, Path: strings.TrimSpace(path)}
+	}
+	return routes
+}
+
+// requireAdmin only passes requests that carry token as a bearer token on to
+// next.
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// routesHandler lists the routes registered on mux as JSON.
+func routesHandler(mux *routeMux) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(mux.routes()); err != nil {
+			http.Error(w, "Error encoding routes: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// stats are the server's counters, as served by statsHandler.
+type stats struct {
+	StoreRetries int64 `json:"storeRetries"`
+}
+
+// statsHandler reports the server's counters as JSON.
+func statsHandler(storeRetries *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats{StoreRetries: storeRetries.Load()}); err != nil {
+			http.Error(w, "Error encoding stats: "+err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
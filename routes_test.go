@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	mux.HandleFunc("GET /debug/routes", requireAdmin("secret", routesHandler(mux)))
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	var routes []route
+	if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+		t.Fatalf("decode routes: %v", err)
+	}
+	for _, want := range []route{
+		{Method: http.MethodPost, Path: "/masterscalc/rowers"},
+		{Method: http.MethodGet, Path: "/masterscalc/rowers/print"},
+		{Method: http.MethodGet, Path: "/masterscalc/rowers/export"},
+		{Method: http.MethodGet, Path: "/debug/routes"},
+	} {
+		if !slices.Contains(routes, want) {
+			t.Errorf("routes do not contain %s %s", want.Method, want.Path)
+		}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "not bearer", authorization: "Basic secret", want: http.StatusUnauthorized},
+		{name: "token", authorization: "Bearer secret", want: http.StatusOK},
+	}
+	handler := requireAdmin("secret", func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	page, err := parseErrorPage("")
+	if err != nil {
+		t.Fatalf("parseErrorPage: %v", err)
+	}
+	// The full middleware chain, which must not drop the Allow header.
+	h := requestIDMiddleware(errorPageMiddleware(page, defaultAppName)(timeoutMiddleware(time.Minute, func(*http.Request) bool { return false })(mux)))
+
+	tests := []struct {
+		method, target, wantAllow string
+	}{
+		{method: http.MethodPatch, target: "/masterscalc/rowers", wantAllow: "GET, HEAD, POST"},
+		{method: http.MethodPut, target: "/masterscalc/rowers/0", wantAllow: "DELETE"},
+		{method: http.MethodPost, target: "/masterscalc/history", wantAllow: "GET, HEAD"},
+		{method: http.MethodDelete, target: "/masterscalc/compute", wantAllow: "OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	toolbelt "github.com/delaneyj/toolbelt/id"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// kvSessionStore is a sessions.Store that keeps session data server-side in a
+// store, with only the signed session ID in the cookie. The store's TTL
+// bounds how long an abandoned session's data is kept.
+type kvSessionStore struct {
+	s       store
+	codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+// newKVSessionStore creates a server-side session store over s, signing the
+// session ID cookie with keyPairs as sessions.NewCookieStore does.
+func newKVSessionStore(s store, keyPairs ...[]byte) *kvSessionStore {
+	return &kvSessionStore{
+		s:       s,
+		codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: &sessions.Options{Path: "/", MaxAge: 86400 * 30},
+	}
+}
+
+// MaxAge sets the cookie's lifetime, as sessions.CookieStore.MaxAge does.
+func (st *kvSessionStore) MaxAge(age int) {
+	st.Options.MaxAge = age
+	for _, c := range st.codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(age)
+		}
+	}
+}
+
+// Get returns the session name for r, cached for the rest of the request.
+func (st *kvSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(st, name)
+}
+
+// New loads the session named by r's cookie, or returns a new one. A cookie
+// that fails to decode is reported, along with the new session, like the
+// cookie store does; a session whose data has expired starts afresh.
+func (st *kvSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(st, name)
+	opts := *st.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, st.codecs...); err != nil {
+		return session, err
+	}
+
+	value, err := st.s.Get(r.Context(), session.ID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, fmt.Errorf("could not get session: %w", err)
+	}
+	if err := securecookie.DecodeMulti(name, string(value), &session.Values, st.codecs...); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session's data and sets the cookie holding its ID. A
+// negative MaxAge deletes the session.
+func (st *kvSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := st.s.Delete(r.Context(), session.ID); err != nil && !errors.Is(err, ErrKeyNotFound) {
+				return fmt.Errorf("could not delete session: %w", err)
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = toolbelt.NextEncodedID()
+	}
+	value, err := securecookie.EncodeMulti(session.Name(), session.Values, st.codecs...)
+	if err != nil {
+		return fmt.Errorf("could not encode session: %w", err)
+	}
+	if err := st.s.Put(r.Context(), session.ID, []byte(value)); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+
+	id, err := securecookie.EncodeMulti(session.Name(), session.ID, st.codecs...)
+	if err != nil {
+		return fmt.Errorf("could not encode session ID: %w", err)
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), id, session.Options))
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+func TestSessionBackends(t *testing.T) {
+	backends := map[string]func(*testing.T) sessions.Store{
+		"cookie": func(t *testing.T) sessions.Store { return sessions.NewCookieStore(testSessionKey(t)) },
+		"kv": func(t *testing.T) sessions.Store {
+			return newKVSessionStore(newMemoryStore(time.Hour), testSessionKey(t))
+		},
+	}
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			app, err := newApplication(newStore(t), newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+			if err != nil {
+				t.Fatalf("newApplication: %v", err)
+			}
+			mux := newRouteMux()
+			app.registerRoutes(mux)
+
+			c := newTestClient(t, mux)
+			c.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+			if body := c.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); !strings.Contains(body, "<td>Alex</td>") {
+				t.Error("the session's crew is not found again")
+			}
+			if body := newTestClient(t, mux).mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); strings.Contains(body, "<td>Alex</td>") {
+				t.Error("another client shares the session")
+			}
+		})
+	}
+}
+
+func TestKVSessionStore(t *testing.T) {
+	ctx := context.Background()
+	data := newMemoryStore(time.Hour)
+	st := newKVSessionStore(data, testSessionKey(t))
+	request := func(cookies ...*http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/masterscalc", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		return r
+	}
+
+	sess, err := st.New(request(), "mc_session")
+	if err != nil || !sess.IsNew {
+		t.Fatalf("New without a cookie = %v, IsNew %v, want a new session", err, sess.IsNew)
+	}
+	sess.Values["id"] = "crew-1"
+	w := httptest.NewRecorder()
+	if err := st.Save(request(), w, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	// The cookie carries only the session ID; the values are in the store.
+	var id string
+	if err := securecookie.DecodeMulti("mc_session", cookie.Value, &id, st.codecs...); err != nil || id != sess.ID {
+		t.Errorf("cookie decodes to %q, %v, want the session ID %q", id, err, sess.ID)
+	}
+	if _, err := data.Get(ctx, sess.ID); err != nil {
+		t.Errorf("store Get: %v, want the session data", err)
+	}
+
+	loaded, err := st.New(request(cookie), "mc_session")
+	if err != nil || loaded.IsNew || loaded.Values["id"] != "crew-1" {
+		t.Errorf("New with the cookie = %v, IsNew %v, values %v, want the saved session", err, loaded.IsNew, loaded.Values)
+	}
+
+	tampered := *cookie
+	tampered.Value = "x" + cookie.Value
+	if s, err := st.New(request(&tampered), "mc_session"); err == nil || !s.IsNew {
+		t.Errorf("New with a tampered cookie = %v, IsNew %v, want an error and a new session", err, s.IsNew)
+	}
+
+	// Deleting the session removes its data and clears the cookie.
+	loaded.Options.MaxAge = -1
+	w = httptest.NewRecorder()
+	if err := st.Save(request(cookie), w, loaded); err != nil {
+		t.Fatalf("Save to delete: %v", err)
+	}
+	if _, err := data.Get(ctx, sess.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("store Get after delete = %v, want %v", err, ErrKeyNotFound)
+	}
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want the session cookie cleared", cleared)
+	}
+
+	// Once the data has expired, the cookie starts a new session.
+	expired, err := st.New(request(cookie), "mc_session")
+	if err != nil || !expired.IsNew || len(expired.Values) != 0 {
+		t.Errorf("New after the data expired = %v, IsNew %v, values %v, want a new session", err, expired.IsNew, expired.Values)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ErrInvalidShareLink is returned for a share link that names no crew or does
+// not match the crew's link.
+var ErrInvalidShareLink = errors.New("invalid share link")
+
+// shareRole is what a share link lets the people who open it do.
+type shareRole string
+
+const (
+	// shareEdit joins the crew, so edits by anyone holding the link reach
+	// every watcher of it.
+	shareEdit shareRole = "edit"
+	// shareView shows the crew read-only.
+	shareView shareRole = "view"
+)
+
+// shareSecrets are the crew's share link secrets, created the first time the
+// crew is shared.
+type shareSecrets struct {
+	Edit string `json:"edit,omitempty"`
+	View string `json:"view,omitempty"`
+}
+
+// shareTokens are the tokens of a crew's share links. Each is the crew's key
+// and a secret, so a link finds its crew without a lookup table.
+type shareTokens struct {
+	Edit string
+	View string
+}
+
+// Share returns the share link tokens for the crew at key, creating them the
+// first time it is shared.
+func (b *business) Share(ctx context.Context, key string) (shareTokens, error) {
+	var tokens shareTokens
+	err := b.mutate(ctx, key, func(s *state) error {
+		if s.Share == (shareSecrets{}) {
+			slog.Info("Shared crew")
+			s.Share = shareSecrets{Edit: rand.Text(), View: rand.Text()}
+		}
+		tokens = shareTokens{Edit: key + "." + s.Share.Edit, View: key + "." + s.Share.View}
+		return nil
+	})
+	if err != nil {
+		return shareTokens{}, err
+	}
+	return tokens, nil
+}
+
+// SharedCrew returns the key of the crew token is a share link for and the
+// role the link grants.
+func (b *business) SharedCrew(ctx context.Context, token string) (string, shareRole, error) {
+	// Secrets never contain a dot, so the key is everything before the last.
+	i := strings.LastIndexByte(token, '.')
+	if i <= 0 {
+		return "", "", ErrInvalidShareLink
+	}
+	key, secret := token[:i], token[i+1:]
+
+	s, err := b.getState(ctx, key)
+	if err != nil {
+		return "", "", fmt.Errorf("could not get state: %w", err)
+	}
+	for role, want := range map[shareRole]string{shareEdit: s.Share.Edit, shareView: s.Share.View} {
+		if want != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(want)) == 1 {
+			return key, role, nil
+		}
+	}
+	return "", "", ErrInvalidShareLink
+}
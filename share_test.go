@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestShare(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBusiness(t, testBusinessConfig())
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+	tokens, err := b.Share(ctx, "crew")
+	if err != nil {
+		t.Fatalf("Share: %v", err)
+	}
+	if again, err := b.Share(ctx, "crew"); err != nil || again != tokens {
+		t.Errorf("Share again = %+v, %v, want the same links %+v", again, err, tokens)
+	}
+	if s := mustGet(t, b, "crew"); len(s.Rowers) != 1 {
+		t.Errorf("sharing changed the crew: %+v", s.Rowers)
+	}
+
+	for token, want := range map[string]shareRole{tokens.Edit: shareEdit, tokens.View: shareView} {
+		key, role, err := b.SharedCrew(ctx, token)
+		if err != nil || key != "crew" || role != want {
+			t.Errorf("SharedCrew(%q) = %q, %q, %v, want crew, %q", token, key, role, err, want)
+		}
+	}
+
+	_, secret, _ := strings.Cut(tokens.Edit, ".")
+	for _, token := range []string{"", "crew", "crew.", "crew.wrong", "." + secret, "other." + secret} {
+		if _, _, err := b.SharedCrew(ctx, token); !errors.Is(err, ErrInvalidShareLink) {
+			t.Errorf("SharedCrew(%q) = %v, want %v", token, err, ErrInvalidShareLink)
+		}
+	}
+}
+
+var shareURLs = regexp.MustCompile(`"shareEditUrl":"([^"]+)","shareViewUrl":"([^"]+)"`)
+
+func TestShareLinks(t *testing.T) {
+	mux := newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig())
+	owner := newTestClient(t, mux)
+	owner.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Alex","birthYearOrAge":"44"}`, http.StatusOK)
+	m := shareURLs.FindStringSubmatch(owner.mustDo(http.MethodPost, "/masterscalc/share", "", http.StatusOK).Body.String())
+	if m == nil {
+		t.Fatal("share response has no links")
+	}
+	editURL, viewURL := m[1], m[2]
+
+	// An edit by someone who joined with the edit link is the owner's too.
+	editor := newTestClient(t, mux)
+	if w := editor.mustDo(http.MethodGet, editURL, "", http.StatusSeeOther); w.Header().Get("Location") != "/masterscalc" {
+		t.Errorf("edit link redirects to %q, want /masterscalc", w.Header().Get("Location"))
+	}
+	editor.mustDo(http.MethodPost, "/masterscalc/rowers", `{"name":"Blake","birthYearOrAge":"51"}`, http.StatusOK)
+	if body := owner.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); !strings.Contains(body, "<td>Blake</td>") {
+		t.Error("the editor's rower is not in the owner's crew")
+	}
+
+	// The view link shows the crew without joining it.
+	viewer := newTestClient(t, mux)
+	if body := viewer.mustDo(http.MethodGet, viewURL, "", http.StatusOK).Body.String(); !strings.Contains(body, "<td>Alex</td>") || !strings.Contains(body, "<td>Blake</td>") {
+		t.Errorf("view link does not show the crew:\n%s", body)
+	}
+	if body := viewer.mustDo(http.MethodGet, "/masterscalc/rowers/print", "", http.StatusOK).Body.String(); strings.Contains(body, "<td>Alex</td>") {
+		t.Error("the view link joined the viewer to the crew")
+	}
+
+	viewer.mustDo(http.MethodGet, "/masterscalc/shared/nobody.secret", "", http.StatusNotFound)
+}
@@ -0,0 +1,48 @@
+// Service worker for offline use. The cache name changes whenever the static
+// files do, so a new deployment replaces the old cache.
+const CACHE = 'masterscalc-{{.Version}}';
+const SHELL = [
+	'/masterscalc',
+	'/masterscalc/help',
+	'/static/css/styles.css',
+	'/static/icon.svg',
+	'/favicon.ico',
+	'/manifest.json',
+];
+
+self.addEventListener('install', (event) => {
+	event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(SHELL)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', (event) => {
+	event.waitUntil(
+		caches.keys()
+			.then((keys) => Promise.all(keys.filter((key) => key !== CACHE).map((key) => caches.delete(key))))
+			.then(() => self.clients.claim()),
+	);
+});
+
+self.addEventListener('fetch', (event) => {
+	const request = event.request;
+	const url = new URL(request.url);
+	// Crew updates are live, so never serve them from the cache.
+	if (request.method !== 'GET' || url.origin !== self.location.origin || url.pathname.startsWith('/masterscalc/rowers')) {
+		return;
+	}
+
+	if (request.mode === 'navigate') {
+		// Pages are network first so they are never stale while online.
+		event.respondWith(
+			fetch(request)
+				.then((response) => {
+					const copy = response.clone();
+					caches.open(CACHE).then((cache) => cache.put(request, copy));
+					return response;
+				})
+				.catch(() => caches.match(request, { ignoreSearch: true }).then((cached) => cached || caches.match('/masterscalc'))),
+		);
+		return;
+	}
+
+	event.respondWith(caches.match(request).then((cached) => cached || fetch(request)));
+});
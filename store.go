@@ -4,25 +4,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/nats-io/nats.go/jetstream"
 )
 
 var ErrKeyNotFound = errors.New("key not found")
 
-type store struct {
+var bucketNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validBucketName reports whether name follows the NATS key-value bucket naming rules.
+func validBucketName(name string) bool {
+	return bucketNameRegexp.MatchString(name)
+}
+
+// store persists raw state values by key. Watch delivers the current value, if
+// any, then calls initialized once, then delivers every subsequent update until
+// ctx is cancelled. A deleted key is delivered as a nil value.
+type store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error
+	// Keys lists the keys that start with prefix, in no particular order.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+}
+
+type natsStore struct {
 	kv jetstream.KeyValue
 }
 
-func newStore(ctx context.Context, js jetstream.JetStream, cfg jetstream.KeyValueConfig) (*store, error) {
+func newNATSStore(ctx context.Context, js jetstream.JetStream, cfg jetstream.KeyValueConfig) (*natsStore, error) {
 	kv, err := js.CreateOrUpdateKeyValue(ctx, cfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not create or update key-value store: %w", err)
 	}
-	return &store{kv: kv}, nil
+	return &natsStore{kv: kv}, nil
 }
 
-func (s *store) Get(ctx context.Context, key string) ([]byte, error) {
+func (s *natsStore) Get(ctx context.Context, key string) ([]byte, error) {
 	entry, err := s.kv.Get(ctx, key)
 	if err != nil {
 		if errors.Is(err, jetstream.ErrKeyNotFound) {
@@ -33,14 +54,46 @@ func (s *store) Get(ctx context.Context, key string) ([]byte, error) {
 	return entry.Value(), nil
 }
 
-func (s *store) Put(ctx context.Context, key string, value []byte) error {
+func (s *natsStore) Put(ctx context.Context, key string, value []byte) error {
 	if _, err := s.kv.Put(ctx, key, value); err != nil {
 		return fmt.Errorf("could not put entry to kv: %w", err)
 	}
 	return nil
 }
 
-func (s *store) Watch(ctx context.Context, key string, callback func([]byte) error) error {
+func (s *natsStore) Delete(ctx context.Context, key string) error {
+	if err := s.kv.Delete(ctx, key); err != nil {
+		return fmt.Errorf("could not delete entry from kv: %w", err)
+	}
+	return nil
+}
+
+func (s *natsStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	// Let the server filter on the whole tokens of the prefix, leaving only a
+	// partial last token to be matched here.
+	filter := ">"
+	if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+		filter = prefix[:i+1] + ">"
+	}
+	lister, err := s.kv.ListKeysFiltered(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("could not list keys: %w", err)
+	}
+	defer func() { _ = lister.Stop() }()
+
+	var keys []string
+	seen := map[string]struct{}{}
+	for key := range lister.Keys() {
+		if _, ok := seen[key]; ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *natsStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
 	watcher, err := s.kv.Watch(ctx, key)
 	if err != nil {
 		return fmt.Errorf("could not create watcher: %w", err)
@@ -55,10 +108,18 @@ func (s *store) Watch(ctx context.Context, key string, callback func([]byte) err
 			if !ok {
 				return nil
 			}
+			// A nil entry marks the end of the initial values.
 			if entry == nil {
+				if err := initialized(); err != nil {
+					return fmt.Errorf("could not handle initialization: %w", err)
+				}
 				continue
 			}
-			if err := callback(entry.Value()); err != nil {
+			var value []byte
+			if entry.Operation() == jetstream.KeyValuePut {
+				value = entry.Value()
+			}
+			if err := callback(value); err != nil {
 				return fmt.Errorf("could not handle update: %w", err)
 			}
 		}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrEmptyCrew is returned when a calculation needs at least one rower.
+var ErrEmptyCrew = errors.New("the crew is empty")
+
+// targetPlan is how a crew could reach a target band by its average age.
+type targetPlan struct {
+	Band        string `json:"band"`
+	CurrentBand string `json:"currentBand"`
+	// Reached is set when the crew is already in or above Band.
+	Reached bool `json:"reached"`
+	// AddYears is the total age the crew would need to gain.
+	AddYears int `json:"addYears,omitempty"`
+	// RecruitAge is the youngest extra rower who would lift the crew into
+	// Band on their own, if anyone within the maximum age would.
+	RecruitAge int    `json:"recruitAge,omitempty"`
+	Summary    string `json:"summary"`
+}
+
+// TargetBand works out how much older the crew would need to be to reach
+// band, categorising each hypothetical crew exactly as the crew itself is
+// categorised, with the same averaging, rounding and composite rule.
+func (b *business) TargetBand(key string, s *state, band string) (*targetPlan, error) {
+	if !knownBand(band) {
+		return nil, fmt.Errorf("unknown band %q", band)
+	}
+	if len(b.averagedRowers(s)) == 0 {
+		return nil, ErrEmptyCrew
+	}
+
+	plan := &targetPlan{Band: band, CurrentBand: b.crewBand(key, s)}
+	// Bands are single letters in order, so they compare as strings.
+	if plan.CurrentBand >= band {
+		plan.Reached = true
+		if plan.CurrentBand == band {
+			plan.Summary = "The crew is already Masters " + band + "."
+		} else {
+			plan.Summary = fmt.Sprintf("The crew is already Masters %s, above %s.", plan.CurrentBand, band)
+		}
+		return plan, nil
+	}
+
+	// Age the youngest counted rower a year at a time. That raises the
+	// average as much as ageing anyone would, and also lifts the youngest
+	// rower a composite crew may be categorised by.
+	aged := &state{Rowers: slices.Clone(s.Rowers), TooYoungPolicy: s.TooYoungPolicy}
+	for b.crewBand(key, aged) < band {
+		i := b.youngestCounted(aged)
+		if aged.Rowers[i].preciseAge() >= float64(b.cfg.MaxAge) {
+			plan.AddYears = 0
+			break
+		}
+		aged.Rowers[i] = agedBy(aged.Rowers[i], 1)
+		plan.AddYears++
+	}
+
+	for age := 1; age <= b.cfg.MaxAge; age++ {
+		recruit := rower{Age: age, Band: calculateBand(float64(age))}
+		recruited := &state{Rowers: append(slices.Clone(s.Rowers), recruit), TooYoungPolicy: s.TooYoungPolicy}
+		if b.crewBand(key, recruited) >= band {
+			plan.RecruitAge = age
+			break
+		}
+	}
+
+	switch {
+	case plan.AddYears > 0:
+		unit := "years"
+		if plan.AddYears == 1 {
+			unit = "year"
+		}
+		plan.Summary = fmt.Sprintf("Add %d %s across the crew", plan.AddYears, unit)
+		if plan.RecruitAge > 0 {
+			plan.Summary += fmt.Sprintf(", or recruit someone aged %d+", plan.RecruitAge)
+		}
+	case plan.RecruitAge > 0:
+		plan.Summary = fmt.Sprintf("Recruit someone aged %d+", plan.RecruitAge)
+	default:
+		plan.Summary = fmt.Sprintf("No crew within the maximum age of %d reaches Masters %s.", b.cfg.MaxAge, band)
+		return plan, nil
+	}
+	plan.Summary += " to reach Masters " + band + "."
+	return plan, nil
+}
+
+// youngestCounted returns the index of the youngest rower in s who counts
+// towards the average age.
+func (b *business) youngestCounted(s *state) int {
+	excluded := b.tooYoungPolicyOf(s) == tooYoungListExcluded
+	youngest := -1
+	for i, r := range s.Rowers {
+		if excluded && r.Band == "" {
+			continue
+		}
+		if youngest < 0 || r.preciseAge() < s.Rowers[youngest].preciseAge() {
+			youngest = i
+		}
+	}
+	return youngest
+}
+
+// agedBy returns r as they will be in years, with their band recalculated.
+func agedBy(r rower, years int) rower {
+	r.Age += years
+	if r.DateOfBirth != "" {
+		r.ExactAge += float64(years)
+	}
+	r.Band = calculateBand(r.preciseAge())
+	return r
+}
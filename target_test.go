@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// testCrew returns a crew of rowers of the given ages, from the given clubs
+// when any are given.
+func testCrew(ages []int, clubs ...string) *state {
+	s := &state{}
+	for i, age := range ages {
+		r := rower{Name: "Rower", Age: age, Band: calculateBand(float64(age))}
+		if i < len(clubs) {
+			r.Club = clubs[i]
+		}
+		s.Rowers = append(s.Rowers, r)
+	}
+	return s
+}
+
+func TestTargetBand(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       func(*businessConfig)
+		crew      *state
+		band      string
+		want      targetPlan
+		wantError error
+	}{
+		{
+			name: "just below",
+			crew: testCrew([]int{42, 42}),
+			band: "C",
+			want: targetPlan{Band: "C", CurrentBand: "B", AddYears: 2, RecruitAge: 45, Summary: "Add 2 years across the crew, or recruit someone aged 45+ to reach Masters C."},
+		},
+		{
+			name: "one year below",
+			crew: testCrew([]int{42, 43}),
+			band: "C",
+			want: targetPlan{Band: "C", CurrentBand: "B", AddYears: 1, RecruitAge: 44, Summary: "Add 1 year across the crew, or recruit someone aged 44+ to reach Masters C."},
+		},
+		{
+			name: "reached by rounding",
+			cfg:  func(cfg *businessConfig) { cfg.Rounding = roundingRound },
+			crew: testCrew([]int{42, 43}),
+			band: "C",
+			want: targetPlan{Band: "C", CurrentBand: "C", Reached: true, Summary: "The crew is already Masters C."},
+		},
+		{
+			name: "already above",
+			crew: testCrew([]int{52, 52}),
+			band: "C",
+			want: targetPlan{Band: "C", CurrentBand: "D", Reached: true, Summary: "The crew is already Masters D, above C."},
+		},
+		{
+			name: "composite crew by its youngest rower",
+			cfg:  func(cfg *businessConfig) { cfg.CompositeRule = compositeYoungest },
+			crew: testCrew([]int{38, 60}, "Tideway", "Thames"),
+			band: "C",
+			// The average of 49 is already C, but the crew is placed by the
+			// youngest rower, and no recruit can make them older.
+			want: targetPlan{Band: "C", CurrentBand: "B", AddYears: 5, Summary: "Add 5 years across the crew to reach Masters C."},
+		},
+		{
+			name: "too young rowers left out of the average",
+			crew: func() *state {
+				s := testCrew([]int{20, 42})
+				s.TooYoungPolicy = tooYoungListExcluded
+				return s
+			}(),
+			band: "C",
+			want: targetPlan{Band: "C", CurrentBand: "B", AddYears: 1, RecruitAge: 44, Summary: "Add 1 year across the crew, or recruit someone aged 44+ to reach Masters C."},
+		},
+		{
+			name: "beyond the maximum age",
+			cfg:  func(cfg *businessConfig) { cfg.MaxAge = 50 },
+			crew: testCrew([]int{44}),
+			band: "K",
+			want: targetPlan{Band: "K", CurrentBand: "C", Summary: "No crew within the maximum age of 50 reaches Masters K."},
+		},
+		{
+			name:      "empty crew",
+			crew:      &state{},
+			band:      "C",
+			wantError: ErrEmptyCrew,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testBusinessConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			b := newTestBusiness(t, cfg)
+
+			plan, err := b.TargetBand("crew", tt.crew, tt.band)
+			if tt.wantError != nil {
+				if !errors.Is(err, tt.wantError) {
+					t.Fatalf("TargetBand error = %v, want %v", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TargetBand: %v", err)
+			}
+			if *plan != tt.want {
+				t.Errorf("TargetBand = %+v, want %+v", *plan, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetBandMatchesCrewCategory(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.CompositeRule = compositeDowngrade
+	b := newTestBusiness(t, cfg)
+	mustCreate(t, b, "crew",
+		rowerInput{Name: "Alex", BirthYearOrAge: "44", Club: "Tideway"},
+		rowerInput{Name: "Blake", BirthYearOrAge: "52", Club: "Thames"},
+	)
+	s := mustGet(t, b, "crew")
+
+	plan, err := b.TargetBand("crew", s, "A")
+	if err != nil {
+		t.Fatalf("TargetBand: %v", err)
+	}
+	if plan.CurrentBand != s.Signals.AverageBand {
+		t.Errorf("CurrentBand = %q, want the crew's category %q", plan.CurrentBand, s.Signals.AverageBand)
+	}
+}
+
+func TestTargetBandUnknownBand(t *testing.T) {
+	b := newTestBusiness(t, testBusinessConfig())
+	if _, err := b.TargetBand("crew", testCrew([]int{44}), "Z"); err == nil {
+		t.Error("TargetBand with an unknown band succeeded, want an error")
+	}
+}
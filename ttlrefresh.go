@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// refreshIfStale saves s again when it was last saved over TTLRefresh ago,
+// renewing its TTL in the store so a crew that is only being viewed doesn't
+// expire. Saving at most once per TTLRefresh bounds the extra writes. A crew
+// never saved, such as a new session's empty one, is left alone.
+func (b *business) refreshIfStale(ctx context.Context, key string, s *state) {
+	if b.cfg.TTLRefresh <= 0 || s.SavedAt.IsZero() || b.now().Sub(s.SavedAt) < b.cfg.TTLRefresh {
+		return
+	}
+
+	// Going through mutate saves the latest crew rather than s, so a write
+	// made since s was read isn't undone.
+	err := b.mutate(ctx, key, func(*state) error { return nil })
+	if err != nil {
+		slog.Error("Error refreshing crew TTL", "error", err)
+		return
+	}
+	slog.Debug("Refreshed crew TTL", "key", key)
+}
+
+// keepAlive refreshes the crew for key every TTLRefresh while ctx is active,
+// for watchers that stay open on a crew nobody is changing.
+func (b *business) keepAlive(ctx context.Context, key string) {
+	ticker := time.NewTicker(b.cfg.TTLRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s, err := b.getState(ctx, key)
+			if err != nil {
+				slog.Error("Error getting crew to refresh", "error", err)
+				continue
+			}
+			b.refreshIfStale(ctx, key, s)
+		}
+	}
+}
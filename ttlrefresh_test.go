@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadRefreshesTTL(t *testing.T) {
+	const ttl = 200 * time.Millisecond
+	for _, refresh := range []bool{false, true} {
+		name := "off"
+		if refresh {
+			name = "on"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := testBusinessConfig()
+			if refresh {
+				cfg.TTLRefresh = ttl / 4
+			}
+			s := newMemoryStore(ttl)
+			b := newBusiness(s, newMemoryStore(time.Hour), newMemoryStore(time.Hour), nil, cfg)
+			now := testNow
+			b.now = func() time.Time { return now }
+			mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+
+			// Read the crew past the refresh interval but within the TTL,
+			// then check the store directly once the original TTL is over.
+			time.Sleep(ttl * 3 / 5)
+			now = now.Add(ttl * 3 / 5)
+			if _, err := b.Get(ctx, "crew"); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			time.Sleep(ttl * 3 / 5)
+
+			_, err := s.Get(ctx, "crew")
+			if refresh && err != nil {
+				t.Errorf("crew expired despite being read: %v", err)
+			}
+			if !refresh && !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("store Get = %v, want the crew expired", err)
+			}
+		})
+	}
+}
+
+func TestFreshReadIsNotRefreshed(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.TTLRefresh = time.Minute
+	b := newTestBusiness(t, cfg)
+	counting := &putCountingStore{store: b.s}
+	b.s = counting
+	mustCreate(t, b, "crew", rowerInput{Name: "Alex", BirthYearOrAge: "44"})
+	counting.puts.Store(0)
+
+	mustGet(t, b, "crew")
+	if n := counting.puts.Load(); n != 0 {
+		t.Errorf("read within TTLRefresh of the save wrote %d times, want 0", n)
+	}
+
+	b.now = func() time.Time { return testNow.Add(time.Minute) }
+	if s := mustGet(t, b, "crew"); len(s.Rowers) != 1 {
+		t.Fatalf("crew has %d rowers, want 1", len(s.Rowers))
+	}
+	if n := counting.puts.Load(); n != 1 {
+		t.Errorf("stale read wrote %d times, want 1", n)
+	}
+	if n := len(mustGet(t, b, "crew").Rowers); n != 1 {
+		t.Errorf("refresh left %d rowers, want 1", n)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// watchCoalescer batches a watcher's updates so that a burst of changes is
+// rendered once, with the latest value, rather than once per change. The first
+// update of a batch starts a window; when it ends, the last value seen is
+// rendered.
+type watchCoalescer struct {
+	window time.Duration
+	render func([]byte) error
+	// cancel stops the watch when a render from the timer fails, as there is
+	// no caller to return the error to.
+	cancel context.CancelFunc
+
+	// renderMu keeps renders in order, whether from the timer or a flush.
+	renderMu sync.Mutex
+
+	mu         sync.Mutex
+	pending    []byte
+	hasPending bool
+	timer      *time.Timer
+	err        error
+	stopped    bool
+}
+
+func newWatchCoalescer(window time.Duration, render func([]byte) error, cancel context.CancelFunc) *watchCoalescer {
+	return &watchCoalescer{window: window, render: render, cancel: cancel}
+}
+
+// update records value as the latest, to be rendered when the window ends.
+// It returns the error of a failed render, ending the watch.
+func (c *watchCoalescer) update(value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.pending, c.hasPending = value, true
+	if c.timer == nil && !c.stopped {
+		c.timer = time.AfterFunc(c.window, c.flushTimer)
+	}
+	return nil
+}
+
+// flush renders the pending value, if any, without waiting for the window.
+func (c *watchCoalescer) flush() error {
+	c.renderMu.Lock()
+	defer c.renderMu.Unlock()
+
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	value, ok := c.pending, c.hasPending
+	c.pending, c.hasPending = nil, false
+	c.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return c.render(value)
+}
+
+func (c *watchCoalescer) flushTimer() {
+	if err := c.flush(); err != nil {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = err
+		}
+		c.mu.Unlock()
+		c.cancel()
+	}
+}
+
+// stop drops any pending value and waits for a render in progress, so nothing
+// is rendered once the watch has returned. It returns the error of a failed
+// render, if any.
+func (c *watchCoalescer) stop() error {
+	c.mu.Lock()
+	c.stopped = true
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.pending, c.hasPending = nil, false
+	c.mu.Unlock()
+
+	c.renderMu.Lock()
+	defer c.renderMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
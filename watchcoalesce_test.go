@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchCoalescesRapidUpdates(t *testing.T) {
+	const updates = 20
+	cfg := testBusinessConfig()
+	cfg.WatchCoalesceWindow = 50 * time.Millisecond
+	b := newTestBusiness(t, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	renders, latest := 0, 0
+	done := make(chan struct{}, 1)
+	initialized := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- b.Watch(ctx, "crew", func(s *state) error {
+			mu.Lock()
+			defer mu.Unlock()
+			renders++
+			latest = len(s.Rowers)
+			if latest == updates {
+				select {
+				case done <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}, func() error { close(initialized); return nil })
+	}()
+	<-initialized
+
+	mu.Lock()
+	initial := renders
+	mu.Unlock()
+	for i := range updates {
+		mustCreate(t, b, "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44"})
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("last render showed %d rowers, want %d", latest, updates)
+	}
+	cancel()
+	if err := <-errs; err != nil {
+		t.Errorf("Watch: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := renders - initial; n >= updates {
+		t.Errorf("%d renders for %d updates, want fewer", n, updates)
+	}
+	if latest != updates {
+		t.Errorf("last render showed %d rowers, want %d", latest, updates)
+	}
+}
+
+func TestWatchCoalescer(t *testing.T) {
+	rendered := make(chan string, 10)
+	c := newWatchCoalescer(20*time.Millisecond, func(value []byte) error {
+		rendered <- string(value)
+		return nil
+	}, func() {})
+
+	for _, v := range []string{"a", "b", "c"} {
+		if err := c.update([]byte(v)); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+	}
+	select {
+	case got := <-rendered:
+		if got != "c" {
+			t.Errorf("rendered %q, want the latest value c", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing rendered once the window ended")
+	}
+
+	// A flush renders at once; stop drops what is pending.
+	_ = c.update([]byte("d"))
+	if err := c.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := <-rendered; got != "d" {
+		t.Errorf("flush rendered %q, want d", got)
+	}
+	_ = c.update([]byte("e"))
+	if err := c.stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if len(rendered) != 0 {
+		t.Errorf("rendered %q after stop", <-rendered)
+	}
+}
+
+func TestWatchCoalescerRenderError(t *testing.T) {
+	errRender := errors.New("client gone")
+	cancelled := make(chan struct{})
+	c := newWatchCoalescer(time.Millisecond, func([]byte) error { return errRender }, func() { close(cancelled) })
+
+	_ = c.update([]byte("a"))
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a failed render did not cancel the watch")
+	}
+	if err := c.update([]byte("b")); !errors.Is(err, errRender) {
+		t.Errorf("update after a failed render = %v, want %v", err, errRender)
+	}
+	if err := c.stop(); !errors.Is(err, errRender) {
+		t.Errorf("stop = %v, want %v", err, errRender)
+	}
+}
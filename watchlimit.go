@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// watchLimiter spaces out the start of watches so that a crowd of clients
+// reconnecting at once, for example after a deploy, doesn't open every watch
+// on the backend at the same moment. Up to burst watches start immediately;
+// beyond that they start at most rate per second, each with some jitter.
+type watchLimiter struct {
+	interval time.Duration
+	burst    int
+	now      func() time.Time
+
+	mu sync.Mutex
+	// tat is the theoretical arrival time of the next watch if watches
+	// started exactly at the rate.
+	tat time.Time
+}
+
+func newWatchLimiter(rate float64, burst int) *watchLimiter {
+	return &watchLimiter{interval: time.Duration(float64(time.Second) / rate), burst: burst, now: time.Now}
+}
+
+// wait blocks until a watch may start, or ctx is cancelled.
+func (l *watchLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := l.now()
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	delay := tat.Sub(now) - time.Duration(l.burst-1)*l.interval
+	l.tat = tat.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	delay += rand.N(l.interval)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// watchLimitStore is a store whose watches start no faster than its limiter
+// allows.
+type watchLimitStore struct {
+	s       store
+	limiter *watchLimiter
+}
+
+func newWatchLimitStore(s store, limiter *watchLimiter) *watchLimitStore {
+	return &watchLimitStore{s: s, limiter: limiter}
+}
+
+func (w *watchLimitStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return w.s.Get(ctx, key)
+}
+
+func (w *watchLimitStore) Put(ctx context.Context, key string, value []byte) error {
+	return w.s.Put(ctx, key, value)
+}
+
+func (w *watchLimitStore) Delete(ctx context.Context, key string) error {
+	return w.s.Delete(ctx, key)
+}
+
+func (w *watchLimitStore) Watch(ctx context.Context, key string, callback func([]byte) error, initialized func() error) error {
+	if err := w.limiter.wait(ctx); err != nil {
+		// The client went away before its turn, which ends the watch as
+		// cleanly as going away during it.
+		return nil
+	}
+	return w.s.Watch(ctx, key, callback, initialized)
+}
+
+func (w *watchLimitStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	return w.s.Keys(ctx, prefix)
+}
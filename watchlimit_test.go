@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchLimiterThrottles(t *testing.T) {
+	const (
+		rate    = 10
+		burst   = 3
+		watches = 5
+	)
+	interval := time.Second / rate
+	l := newWatchLimiter(rate, burst)
+
+	start := time.Now()
+	waited := make([]time.Duration, watches)
+	var wg sync.WaitGroup
+	for i := range watches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.wait(context.Background()); err != nil {
+				t.Errorf("wait: %v", err)
+			}
+			waited[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+
+	immediate := 0
+	for _, d := range waited {
+		if d < interval/2 {
+			immediate++
+		}
+	}
+	if immediate != burst {
+		t.Errorf("%d watches started at once, want the burst of %d: %v", immediate, burst, waited)
+	}
+	// The watches beyond the burst are spaced at the rate, so the last one
+	// waits at least an interval for each of them.
+	if last := slices.Max(waited); last < (watches-burst)*interval {
+		t.Errorf("last watch started after %s, want at least %s", last, (watches-burst)*interval)
+	}
+}
+
+func TestWatchLimitStoreCancelled(t *testing.T) {
+	counting := &watchCountingStore{store: newMemoryStore(time.Hour)}
+	s := newWatchLimitStore(counting, newWatchLimiter(0.001, 1))
+
+	// The first watch takes the only slot for a long while.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Watch(ctx, "crew", func([]byte) error { return nil }, func() error { return nil }); err != nil {
+		t.Fatalf("first Watch: %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Watch(ctx, "crew", func([]byte) error { return nil }, func() error { return nil }); err != nil {
+		t.Errorf("Watch cancelled while waiting = %v, want nil", err)
+	}
+	if n := counting.watches.Load(); n != 1 {
+		t.Errorf("store watched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const webSocketPingInterval = 30 * time.Second
+
+// webSocketMessage mirrors the Datastar SSE events for clients that reach the
+// server through proxies which mishandle event streams.
+type webSocketMessage struct {
+	Type     string        `json:"type"`
+	Elements string        `json:"elements,omitempty"`
+	Signals  *rowerSignals `json:"signals,omitempty"`
+}
+
+func (app *application) watchWebSocket(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Watching rowers over WebSocket")
+
+	release, ok := app.acquireWatcher()
+	if !ok {
+		slog.Warn("Too many watchers, rejecting", "max", app.cfg.MaxWatchers)
+		http.Error(w, "Too many watchers, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	view, err := parseTableView(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID, err := app.upsertSessionID(r, w)
+	if err != nil {
+		http.Error(w, "Error managing session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		slog.Error("Error accepting WebSocket", "error", err)
+		return
+	}
+	defer func() { _ = conn.CloseNow() }()
+
+	// Clients only listen, so discard anything they send. The returned context
+	// is cancelled once the connection closes.
+	ctx := conn.CloseRead(r.Context())
+
+	var tracked *trackedWatcher
+	tracked, untrack := app.janitor.track(func() { _ = conn.CloseNow() }, func() {
+		err := app.janitor.write(tracked, func() error {
+			return writeWebSocketMessage(ctx, conn, webSocketMessage{Type: "restarting"})
+		})
+		if err != nil {
+			slog.Warn("Error sending restart notice", "error", err)
+		}
+		_ = conn.Close(websocket.StatusGoingAway, "server restarting")
+	})
+	defer untrack()
+
+	go func() {
+		ticker := time.NewTicker(webSocketPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := conn.Ping(ctx); err != nil {
+					slog.Info("WebSocket ping failed", "error", err)
+					_ = conn.CloseNow()
+					return
+				}
+			}
+		}
+	}()
+
+	callback := func(s *state) error {
+		table, err := app.renderTable(s, view)
+		if err != nil {
+			return err
+		}
+
+		return app.janitor.write(tracked, func() error {
+			if err := writeWebSocketMessage(ctx, conn, webSocketMessage{Type: "patch-elements", Elements: table}); err != nil {
+				return fmt.Errorf("could not patch elements: %w", err)
+			}
+
+			if err := writeWebSocketMessage(ctx, conn, webSocketMessage{Type: "patch-signals", Signals: &s.Signals}); err != nil {
+				return fmt.Errorf("could not patch signals: %w", err)
+			}
+			return nil
+		})
+	}
+
+	initialized := func() error {
+		return app.janitor.write(tracked, func() error {
+			return writeWebSocketMessage(ctx, conn, webSocketMessage{Type: "initialized"})
+		})
+	}
+
+	if err := app.bus.Watch(ctx, sessionID, callback, initialized); err != nil {
+		slog.Error("Error while watching", "error", err)
+		_ = conn.Close(websocket.StatusInternalError, "error while watching")
+		return
+	}
+
+	_ = conn.Close(websocket.StatusNormalClosure, "")
+}
+
+func writeWebSocketMessage(ctx context.Context, conn *websocket.Conn, msg webSocketMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("could not marshal message: %w", err)
+	}
+	return conn.Write(ctx, websocket.MessageText, data)
+}
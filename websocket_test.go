@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+func TestWatchWebSocketReceivesCreate(t *testing.T) {
+	srv := httptest.NewServer(newTestApp(t, newTestBusiness(t, testBusinessConfig()), testApplicationConfig()))
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(srv.URL + "/masterscalc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, srv.URL+"/masterscalc/rowers/ws", &websocket.DialOptions{HTTPClient: client})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = conn.CloseNow() }()
+
+	read := func() webSocketMessage {
+		t.Helper()
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		var msg webSocketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("could not unmarshal %s: %v", data, err)
+		}
+		return msg
+	}
+	for read().Type != "initialized" {
+	}
+
+	resp, err = client.Post(srv.URL+"/masterscalc/rowers", "application/json", strings.NewReader(`{"name":"Alex Morgan","birthYearOrAge":"44"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create: status %d", resp.StatusCode)
+	}
+
+	msg := read()
+	if msg.Type != "patch-elements" || !strings.Contains(msg.Elements, "Alex Morgan") {
+		t.Errorf("first message after the create = %+v, want the table with Alex Morgan", msg)
+	}
+	msg = read()
+	if msg.Type != "patch-signals" || msg.Signals == nil || msg.Signals.AverageBand != "C" {
+		t.Errorf("second message after the create = %+v, want signals with band C", msg)
+	}
+
+	if err := conn.Close(websocket.StatusNormalClosure, ""); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// writeBatcher coalesces concurrent writes to the same key. The first write
+// for a key leads a batch: it waits for any earlier batch for that key to
+// finish, plus an optional window, then runs every write that has joined the
+// batch in the meantime as a single unit. Bursts of writes from a chatty
+// client therefore cost one read and one write to the store per batch.
+type writeBatcher struct {
+	window time.Duration
+	locks  *keyedMutex
+
+	mu      sync.Mutex
+	pending map[string]*writeBatch
+}
+
+type writeBatch struct {
+	ops []writeOp
+}
+
+type writeOp struct {
+	fn   func(*state) error
+	done chan error
+}
+
+func newWriteBatcher(window time.Duration) *writeBatcher {
+	return &writeBatcher{
+		window:  window,
+		locks:   newKeyedMutex(),
+		pending: map[string]*writeBatch{},
+	}
+}
+
+// Do runs fn as part of a batch for key and returns its result. The batch
+// leader hands every function in the batch to commit, in arrival order, and
+// commit returns one result per function.
+func (wb *writeBatcher) Do(key string, fn func(*state) error, commit func([]func(*state) error) []error) error {
+	op := writeOp{fn: fn, done: make(chan error, 1)}
+
+	wb.mu.Lock()
+	batch, ok := wb.pending[key]
+	if ok {
+		batch.ops = append(batch.ops, op)
+		wb.mu.Unlock()
+		return <-op.done
+	}
+	batch = &writeBatch{ops: []writeOp{op}}
+	wb.pending[key] = batch
+	wb.mu.Unlock()
+
+	unlock := wb.locks.Lock(key)
+	defer unlock()
+
+	if wb.window > 0 {
+		time.Sleep(wb.window)
+	}
+
+	wb.mu.Lock()
+	delete(wb.pending, key)
+	ops := batch.ops
+	wb.mu.Unlock()
+
+	fns := make([]func(*state) error, len(ops))
+	for i, op := range ops {
+		fns[i] = op.fn
+	}
+	results := commit(fns)
+	for i, op := range ops {
+		op.done <- results[i]
+	}
+	return <-op.done
+}
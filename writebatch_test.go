@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// putCountingStore counts the writes to the store it wraps.
+type putCountingStore struct {
+	store
+	puts atomic.Int32
+}
+
+func (s *putCountingStore) Put(ctx context.Context, key string, value []byte) error {
+	s.puts.Add(1)
+	return s.store.Put(ctx, key, value)
+}
+
+func TestRapidCreatesAreBatched(t *testing.T) {
+	cfg := testBusinessConfig()
+	cfg.WriteBatchWindow = 20 * time.Millisecond
+	b := newTestBusiness(t, cfg)
+	counting := &putCountingStore{store: b.s}
+	b.s = counting
+
+	const rowers = 20
+	var wg sync.WaitGroup
+	for i := range rowers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.Create(context.Background(), "crew", rowerInput{Name: fmt.Sprintf("Rower %d", i), BirthYearOrAge: "44"}); err != nil {
+				t.Errorf("Create: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := mustGet(t, b, "crew")
+	if len(s.Rowers) != rowers {
+		t.Errorf("crew has %d rowers, want %d", len(s.Rowers), rowers)
+	}
+	if s.Signals.AverageAge != "44.0" {
+		t.Errorf("AverageAge = %q, want 44.0", s.Signals.AverageAge)
+	}
+	if n := counting.puts.Load(); n >= rowers {
+		t.Errorf("%d creates took %d writes, want them batched", rowers, n)
+	}
+}
+
+func TestWriteBatcherResults(t *testing.T) {
+	wb := newWriteBatcher(10 * time.Millisecond)
+	errOdd := errors.New("odd")
+
+	var commits atomic.Int32
+	commit := func(fns []func(*state) error) []error {
+		commits.Add(1)
+		s := &state{}
+		results := make([]error, len(fns))
+		for i, fn := range fns {
+			results[i] = fn(s)
+		}
+		return results
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var want error
+			if i%2 == 1 {
+				want = errOdd
+			}
+			err := wb.Do("crew", func(*state) error { return want }, commit)
+			if err != want {
+				t.Errorf("write %d = %v, want %v", i, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := commits.Load(); n >= 10 {
+		t.Errorf("10 writes took %d commits, want them batched", n)
+	}
+	if len(wb.pending) != 0 {
+		t.Errorf("%d batches still pending", len(wb.pending))
+	}
+}